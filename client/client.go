@@ -1,205 +1,274 @@
-package main
+// Package client is a Go library for ChittyChat: connect to a server as a user, join channels,
+// send messages and get what happens in the channels as a Go channel of events.
+// It's what bots and integrations use instead of the command line client.
+//
+//	c, err := client.Connect(ctx, "localhost:8080", "EchoBot")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer c.Close()
+//
+//	events := c.Subscribe(ctx)
+//	if err := c.Join(ctx, "Eepy"); err != nil {
+//		log.Fatal(err)
+//	}
+//	for event := range events {
+//		if event.Kind == client.MessageEvent && event.Message.GetSender() != c.User() {
+//			c.Send(ctx, event.Channel, "echo: "+event.Message.GetMessage())
+//		}
+//	}
+//
+// A Client has no globals, so a program can have as many as it likes, and every call takes a context to cancel it.
+package client
 
 import (
 	pb "ChittyChat/proto"
-	"bufio"
 	"context"
-	"flag"
-	"fmt"
-	"io"
-	"log"
-	"os"
-	"time"
-	"unicode/utf8"
-
-	cursor "atomicgo.dev/cursor"
-	"github.com/inancgumus/screen"
+	"errors"
+	"sync"
+
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-func joinChannel(ctx context.Context, client pb.ChatServiceClient) { //, Lamport int) {
+// The text a client sends on joining; the server turns it into the "Participant ... joined" announcement
+const joinMessage = "9cbf281b855e41b4ad9f97707efdd29d"
 
-	channel := pb.Channel{Name: *channelName, SendersName: *senderName}
-	f := setLog(*senderName)
-	defer f.Close()
-	stream, err := client.JoinChannel(ctx, &channel)
-	
-	if err != nil {
-		log.Fatalf("client.JoinChannel(ctx, &channel) throws: %v", err)
-	}
+// ErrClosed is returned by calls on a Client after Close
+var ErrClosed = errors.New("client: closed")
 
-	// Send the join message to the server
-	sendMessage(ctx, client, "9cbf281b855e41b4ad9f97707efdd29d")
-	// Channel that waits for the stream to close
-	// So when <-waitc is called, it waits for an empty struct to be sent
-	// This is to ensure that joinChannel doesn't exit before the stream's closed
-	waitc := make(chan struct{})
+// Client is a connection to a ChittyChat server as one user. It's safe to use from several goroutines.
+type Client struct {
+	user string
+	conn *grpc.ClientConn
+	rpc  pb.ChatServiceClient
 
-	go func() {
-		// The for loop is an infinite loop: Won't ever exit unless stream is closed
-		for {
-			// Receive message from stream and store it in incoming and possible error in err
-			incoming, err := stream.Recv()
-
-			// The stream closes when the client disconnects from the server, or vice versa
-			// So if err == io.EOF, the stream is closed
-			// If the stream is closed, close() is called on the waitc channel
-			// Causeing <-waitc to exit, thus ending the joinChannel func
-			if err == io.EOF {
-				close(waitc)
-				return
-			}
-
-			if err != nil {
-				log.Fatalf("Failed to receive message from channel joining. \nError: %v", err)
-			}
+	clock  Clock
+	sender *Sender
 
-			incrLamport(incoming)
+	mu     sync.Mutex
+	joined map[string]*membership
+	subs   map[*subscription]bool
+	closed bool
+	done   chan struct{}
+}
 
-			messageFormat := "Received at " + formatClientMessage(incoming)
+// membership is a channel the client is in
+type membership struct {
+	cancel context.CancelFunc
+}
 
-			if *senderName == incoming.GetSender() {
-				if incoming.GetMessage() != fmt.Sprintf("Participant %v joined Chitty-Chat at Lamport time %v", incoming.GetSender(), incoming.GetTimestamp()-3) {
-					clearPreviousConsoleLine()
-				}
-				log.Print(messageFormat)
-				fmt.Print(messageFormat)
-			} else {
-				log.Print(messageFormat)
-				fmt.Print(messageFormat)
-			}
-		}
-	}()
+type options struct {
+	dial []grpc.DialOption
+}
 
-	<-waitc
+// Option changes how Connect connects
+type Option func(*options)
 
+// WithDialOptions adds gRPC dial options, e.g. TLS credentials, or a dialer for an in-process listener.
+// They come after the defaults (no TLS, and waiting for the connection), so they can override them.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.dial = append(o.dial, opts...)
+	}
 }
 
-func sendMessage(ctx context.Context, client pb.ChatServiceClient, message string) { //, Lamport int) {
-	stream, err := client.SendMessage(ctx)
+// Connect connects to the server at target as user, waiting until it's connected or ctx is done.
+func Connect(ctx context.Context, target, user string, opts ...Option) (*Client, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	dial := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock()}, o.dial...)
+	conn, err := grpc.DialContext(ctx, target, dial...)
 	if err != nil {
-		log.Printf("Cannot send message - Error: %v", err)
-		fmt.Printf("Cannot send message - Error: %v", err)
+		return nil, err
 	}
+	rpc := pb.NewChatServiceClient(conn)
+	return &Client{
+		user:   user,
+		conn:   conn,
+		rpc:    rpc,
+		sender: NewSender(rpc),
+		joined: make(map[string]*membership),
+		subs:   make(map[*subscription]bool),
+		done:   make(chan struct{}),
+	}, nil
+}
 
-	// Increase Lamport timestamp before sending
-	Lamport++
-
-	// Create message
-	msg := pb.Message{
-		Channel: &pb.Channel{
-			Name:        *channelName,
-			SendersName: *senderName},
-		Message: message,
-		Sender:  *senderName,
-		//Local Timestamp
-		Timestamp: Lamport,
-	}
+// User returns who the client is connected as
+func (c *Client) User() string {
+	return c.user
+}
+
+// Lamport returns the client's Lamport time
+func (c *Client) Lamport() int32 {
+	return c.clock.Now()
+}
 
-	// Send message to server via stream
-	stream.Send(&msg)
+// RPC returns the gRPC client underneath, for the calls this package has no method for, like Search or Kick
+func (c *Client) RPC() pb.ChatServiceClient {
+	return c.rpc
+}
 
-	// CloseAndRecv() closes the stream and returns the server's response, an ack
-	ack, err := stream.CloseAndRecv()
+// Join joins channel and announces it to the channel. What happens in the channel goes to the subscribers,
+// so Subscribe first to get everything. The client stays in the channel until ctx is done, Leave is called or the client is closed;
+// if the server ends the stream first (e.g. a kick), subscribers get a DisconnectEvent.
+// Joining a channel the client is in already does nothing.
+func (c *Client) Join(ctx context.Context, channel string) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	if _, ok := c.joined[channel]; ok {
+		c.mu.Unlock()
+		return nil
+	}
+	streamCtx, cancel := context.WithCancel(ctx)
+	member := &membership{cancel: cancel}
+	c.joined[channel] = member
+	c.mu.Unlock()
+
+	stream, err := c.rpc.JoinChannel(streamCtx, &pb.Channel{Name: channel, SendersName: c.user})
+	if err == nil {
+		err = c.send(ctx, &pb.Message{Message: joinMessage}, channel)
+	}
 	if err != nil {
-		log.Printf("Cannot send message - Error: %v", err)
-		fmt.Printf("Cannot send message - Error: %v", err)
+		c.leave(channel, member)
+		return err
 	}
-
-	log.Printf("Message  %v \n", ack)
-	fmt.Printf("Message  %v \n", ack)
-	// The prev. line is cleared, so that sent messages is not printed twice for the client
-	clearPreviousConsoleLine()
+	go c.receive(streamCtx, channel, member, stream)
+	return nil
 }
 
-// Function to increment the client's Lamport timestamp; used after receiving a message
-func incrLamport(msg *pb.Message) {
-	if msg.GetTimestamp() > Lamport {
-		Lamport = msg.GetTimestamp() + 1
-	} else {
-		Lamport++
+// Leave leaves channel; the server tells the channel
+func (c *Client) Leave(channel string) {
+	c.mu.Lock()
+	member := c.joined[channel]
+	c.mu.Unlock()
+	if member != nil {
+		c.leave(channel, member)
 	}
-	msg.Timestamp = Lamport
 }
 
-// Function from atomicgo.dev/cursor to clear the previous line in the console
-func clearPreviousConsoleLine() {
-	cursor.ClearLinesUp(1)
-	cursor.StartOfLine()
+// Function to end member's stream and forget it, unless the channel has been joined again since
+func (c *Client) leave(channel string, member *membership) {
+	member.cancel()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.joined[channel] == member {
+		delete(c.joined, channel)
+	}
 }
 
-// Function to format message to be printed to the client
-func formatClientMessage(incoming *pb.Message) string {
-	return fmt.Sprintf("Lamport time: %v\n[%v]: %v\n\n", incoming.GetTimestamp(), incoming.GetSender(), incoming.GetMessage())
+// Function to pass what comes in on a channel's stream to the subscribers, until it ends
+func (c *Client) receive(ctx context.Context, channel string, member *membership, stream pb.ChatService_JoinChannelClient) {
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			c.leave(channel, member)
+			// Leaving on purpose isn't worth an event
+			if ctx.Err() == nil {
+				c.dispatch(Event{Kind: DisconnectEvent, Channel: channel, Err: err})
+			}
+			return
+		}
+		c.clock.Observe(msg.GetTimestamp())
+		c.dispatch(Event{Kind: kindOf(msg), Channel: channel, Message: msg})
+	}
 }
 
-func printWelcome() {
-	fmt.Println("\n ━━━━━⊱⊱ ⋆  CHITTY CHAT ⋆ ⊰⊰━━━━━")
-	fmt.Println("⋆｡˚ ☁︎ ˚｡ Welcome to " + *channelName)
-	fmt.Println("⋆｡˚ ☁︎ ˚｡ Your username's " + *senderName)
-	fmt.Println("⋆｡˚ ☁︎ ˚｡ To exit, press Ctrl + C\n\n")
+// Send sends text to channel. When the server asks to slow down, it waits and tries again, for as long as ctx lets it.
+func (c *Client) Send(ctx context.Context, channel, text string) error {
+	return c.send(ctx, &pb.Message{Message: text}, channel)
 }
 
-var channelName = flag.String("channel", "Eepy", "Channel name for chatting")
-var senderName = flag.String("username", "Anon", "Sender's name")
-var tcpServer = flag.String("server", ":8080", "Tcp server")
-
-var Lamport int32 = 0
-
-func main() {
-	screen.Clear()
-	screen.MoveTopLeft()
-	time.Sleep(time.Second / 60)
-
-	flag.Parse()
+// Reply sends text to channel as a reply to the message with id replyTo
+func (c *Client) Reply(ctx context.Context, channel, replyTo, text string) error {
+	return c.send(ctx, &pb.Message{Message: text, ReplyTo: replyTo}, channel)
+}
 
-	printWelcome()
+// SendMessage sends msg to channel, for messages with more than text, like attachments.
+// The sender, channel and Lamport time are filled in.
+func (c *Client) SendMessage(ctx context.Context, channel string, msg *pb.Message) error {
+	return c.send(ctx, msg, channel)
+}
 
-	var opts []grpc.DialOption
-	opts = append(opts, grpc.WithBlock(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+func (c *Client) send(ctx context.Context, msg *pb.Message, channel string) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	msg.Sender = c.user
+	msg.Channel = &pb.Channel{Name: channel, SendersName: c.user}
+	msg.Timestamp = c.clock.Tick()
 
-	conn, err := grpc.Dial(*tcpServer, opts...)
-	if err != nil {
-		log.Fatalf("Fail to dial: %v", err)
+	// Closing the client stops a send that's waiting to try again
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	_, err := c.sender.Send(ctx, msg)
+	if err != nil && c.isClosed() {
+		return ErrClosed
 	}
+	return err
+}
 
-	ctx := context.Background()
-	client := pb.NewChatServiceClient(conn)
+// Edit replaces the text of the message with id in channel
+func (c *Client) Edit(ctx context.Context, channel, id, text string) error {
+	_, err := c.rpc.EditMessage(ctx, &pb.EditRequest{Channel: &pb.Channel{Name: channel, SendersName: c.user}, Id: id, Message: text, Timestamp: c.clock.Tick()})
+	return err
+}
 
-	defer conn.Close()
+// Delete deletes the message with id in channel
+func (c *Client) Delete(ctx context.Context, channel, id string) error {
+	_, err := c.rpc.DeleteMessage(ctx, &pb.EditRequest{Channel: &pb.Channel{Name: channel, SendersName: c.user}, Id: id, Timestamp: c.clock.Tick()})
+	return err
+}
 
-	go joinChannel(ctx, client)
+// React toggles the client's emoji reaction on the message with id in channel
+func (c *Client) React(ctx context.Context, channel, id, emoji string) error {
+	_, err := c.rpc.React(ctx, &pb.ReactionRequest{Channel: &pb.Channel{Name: channel, SendersName: c.user}, Id: id, Emoji: emoji, Timestamp: c.clock.Tick()})
+	return err
+}
 
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		message := scanner.Text()
-		if !utf8.ValidString(message) {
-			fmt.Printf("\n[Invalid characters.]\n[Please ensure your message is UTF-8 encoded.]\n\n")
-			continue
-		}
-		if len(message) > 128 {
-			fmt.Printf("\n[Brevity is the soul of wit.]\n[Please keep your message under 128 characters.]\n\n")
-			continue
-		}
-		go sendMessage(ctx, client, message)
+// History returns what changed in channel since revision; revision 0 gets its last messages
+func (c *Client) History(ctx context.Context, channel string, revision int64) (*pb.History, error) {
+	return c.rpc.GetHistory(ctx, &pb.HistoryRequest{Channel: &pb.Channel{Name: channel, SendersName: c.user}, SinceRevision: revision})
+}
+
+// Close leaves every channel, closes the subscribers' Go channels and disconnects
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
 	}
+	c.closed = true
+	close(c.done)
+	members := c.joined
+	c.joined = make(map[string]*membership)
+	subs := c.subs
+	c.subs = make(map[*subscription]bool)
+	c.mu.Unlock()
+
+	for _, member := range members {
+		member.cancel()
+	}
+	for sub := range subs {
+		sub.close()
+	}
+	return c.conn.Close()
 }
 
-    // sets the logger to use a log.txt file instead of the console
-    func setLog(name string) *os.File {
-        // Clears the log.txt file when a new server is started
-		
-		if _,err := os.Open(fmt.Sprintf("%s.txt",name)); err == nil {
-        if err := os.Truncate(fmt.Sprintf("%s.txt",name), 0); err != nil {
-            log.Printf("Failed to truncate: %v", err)
-        }}
-
-        // This connects to the log file/changes the output of the log information to the log.txt file.
-        f, err := os.OpenFile(fmt.Sprintf("%s.txt",name), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-        if err != nil {
-            log.Fatalf("error opening file: %v", err)
-        }
-        log.SetOutput(f)
-        return f
-    }
\ No newline at end of file
+func (c *Client) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
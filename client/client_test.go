@@ -0,0 +1,153 @@
+package client_test
+
+import (
+	"ChittyChat/client"
+	pb "ChittyChat/proto"
+	"ChittyChat/server"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Function to start a server on an in-process listener with cfg, and return a function connecting clients to it
+func startServer(t *testing.T, cfg server.Config) func(user string) *client.Client {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv, err := server.New(server.WithConfig(cfg), server.WithListener(lis))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Stop)
+
+	dialer := grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	})
+	return func(user string) *client.Client {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		c, err := client.Connect(ctx, "bufnet", user, client.WithDialOptions(dialer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+}
+
+// Function to wait for a new message with the given text, returning it
+func waitFor(t *testing.T, events <-chan client.Event, text string) *pb.Message {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("events closed waiting for %q", text)
+			}
+			if event.Kind == client.MessageEvent && event.Message.GetMessage() == text {
+				return event.Message
+			}
+		case <-timeout:
+			t.Fatalf("no %q after 5s", text)
+		}
+	}
+}
+
+func TestSendAndReceive(t *testing.T) {
+	cfg := server.DefaultConfig()
+	cfg.UserRate, cfg.UserBurst = 1000, 1000
+	connect := startServer(t, cfg)
+	ctx := context.Background()
+
+	alice, bob := connect("Alice"), connect("Bob")
+	events := bob.Subscribe(ctx)
+	if err := alice.Join(ctx, "Eepy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.Join(ctx, "Eepy"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alice.Send(ctx, "Eepy", "hi Bob"); err != nil {
+		t.Fatal(err)
+	}
+	msg := waitFor(t, events, "hi Bob")
+	if msg.GetSender() != "Alice" || msg.GetId() == "" {
+		t.Errorf("Bob got %v, want a message from Alice with an id", msg)
+	}
+	if bob.Lamport() <= msg.GetTimestamp() {
+		t.Errorf("Bob's clock is at %v after receiving a message from Lamport time %v", bob.Lamport(), msg.GetTimestamp())
+	}
+
+	if err := bob.Reply(ctx, "Eepy", msg.GetId(), "hi Alice"); err != nil {
+		t.Fatal(err)
+	}
+	if reply := waitFor(t, events, "hi Alice"); reply.GetReplyTo() != msg.GetId() {
+		t.Errorf("reply is to %q, want %q", reply.GetReplyTo(), msg.GetId())
+	}
+
+	alice.Close()
+	if err := alice.Send(ctx, "Eepy", "still here?"); err != client.ErrClosed {
+		t.Errorf("Send after Close returned %v, want ErrClosed", err)
+	}
+}
+
+func TestSenderWaitsWhenThrottled(t *testing.T) {
+	cfg := server.DefaultConfig()
+	cfg.UserRate, cfg.UserBurst = 1, 1
+	cfg.Filters = nil
+	connect := startServer(t, cfg)
+	ctx := context.Background()
+
+	// Joining sends the join message, which takes the one message there's room for
+	c := connect("Alice")
+	events := c.Subscribe(ctx)
+	if err := c.Join(ctx, "Eepy"); err != nil {
+		t.Fatal(err)
+	}
+
+	sender := client.NewSender(c.RPC())
+	var waits []time.Duration
+	sender.Throttled = func(wait time.Duration) { waits = append(waits, wait) }
+	msg := &pb.Message{Sender: "Alice", Message: "sent anyway", Channel: &pb.Channel{Name: "Eepy", SendersName: "Alice"}}
+	if _, err := sender.Send(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(waits) != 1 || waits[0] != time.Second {
+		t.Errorf("Throttled was called with %v, want a wait of 1s", waits)
+	}
+	waitFor(t, events, "sent anyway")
+
+	// Sent again right away, it's throttled again, and gives up when the context is done before the wait is over
+	short, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	msg.Message = "given up on"
+	if _, err := sender.Send(short, msg); err != context.DeadlineExceeded {
+		t.Errorf("Send with a context shorter than the wait returned %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestClock(t *testing.T) {
+	var clock client.Clock
+	if got := clock.Tick(); got != 1 {
+		t.Errorf("Tick from 0 = %v, want 1", got)
+	}
+	if got := clock.Observe(10); got != 11 {
+		t.Errorf("Observe(10) at 1 = %v, want 11", got)
+	}
+	if got := clock.Observe(3); got != 12 {
+		t.Errorf("Observe(3) at 11 = %v, want 12", got)
+	}
+	clock.Advance(5)
+	clock.Advance(20)
+	if got := clock.Now(); got != 20 {
+		t.Errorf("Now after Advance(5) and Advance(20) = %v, want 20", got)
+	}
+}
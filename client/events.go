@@ -0,0 +1,141 @@
+package client
+
+import (
+	pb "ChittyChat/proto"
+	"context"
+	"sync"
+)
+
+// EventKind says what an Event is about
+type EventKind int
+
+const (
+	// MessageEvent is a new message
+	MessageEvent EventKind = iota
+	// EditEvent is a message that was edited; Message has the new text, and the old ones in its edits
+	EditEvent
+	// DeleteEvent is a message that was deleted
+	DeleteEvent
+	// ReactionEvent is a message whose reactions changed
+	ReactionEvent
+	// NoticeEvent is an announcement by the server, like someone joining or leaving; it has no id
+	NoticeEvent
+	// DisconnectEvent is the server ending a channel's stream, e.g. on a kick; Err says why
+	DisconnectEvent
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case MessageEvent:
+		return "message"
+	case EditEvent:
+		return "edit"
+	case DeleteEvent:
+		return "delete"
+	case ReactionEvent:
+		return "reaction"
+	case NoticeEvent:
+		return "notice"
+	case DisconnectEvent:
+		return "disconnect"
+	}
+	return "unknown"
+}
+
+// Event is something that happened in a channel the client is in
+type Event struct {
+	Kind    EventKind
+	Channel string
+	// Message is nil for a DisconnectEvent
+	Message *pb.Message
+	// Err is only set for a DisconnectEvent
+	Err error
+}
+
+// Function to tell what kind of event a received message is
+func kindOf(msg *pb.Message) EventKind {
+	switch {
+	case msg.GetId() == "":
+		return NoticeEvent
+	case msg.GetEvent() == pb.Event_EDITED:
+		return EditEvent
+	case msg.GetEvent() == pb.Event_DELETED:
+		return DeleteEvent
+	case msg.GetEvent() == pb.Event_REACTED:
+		return ReactionEvent
+	}
+	return MessageEvent
+}
+
+// subscription is a Go channel handed out by Subscribe
+type subscription struct {
+	ctx    context.Context
+	events chan Event
+	mu     sync.Mutex
+	closed bool
+}
+
+// Subscribe returns a Go channel with everything that happens in the channels the client is in, from now on.
+// It's closed when ctx is done or the client is closed. Events wait for the subscriber to take them,
+// so keep reading it; a subscriber that stops reading holds up the others.
+func (c *Client) Subscribe(ctx context.Context) <-chan Event {
+	sub := &subscription{ctx: ctx, events: make(chan Event, 64)}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		close(sub.events)
+		return sub.events
+	}
+	c.subs[sub] = true
+	c.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.done:
+		}
+		c.mu.Lock()
+		delete(c.subs, sub)
+		c.mu.Unlock()
+		sub.close()
+	}()
+	return sub.events
+}
+
+// Function to hand an event to every subscriber
+func (c *Client) dispatch(event Event) {
+	c.mu.Lock()
+	subs := make([]*subscription, 0, len(c.subs))
+	for sub := range c.subs {
+		subs = append(subs, sub)
+	}
+	c.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.deliver(event, c.done)
+	}
+}
+
+// Function to give the subscriber an event, unless it goes away first
+func (s *subscription) deliver(event Event, done <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.events <- event:
+	case <-s.ctx.Done():
+	case <-done:
+	}
+}
+
+func (s *subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+}
@@ -0,0 +1,155 @@
+package client
+
+import (
+	pb "ChittyChat/proto"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Clock is a Lamport clock. The zero value is a clock at time 0, and it's safe to use from several goroutines.
+type Clock struct {
+	mu sync.Mutex
+	t  int32
+}
+
+// Now returns the clock's time
+func (c *Clock) Now() int32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// Tick moves the clock on for something that happens here, like sending a message, and returns the new time
+func (c *Clock) Tick() int32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t++
+	return c.t
+}
+
+// Observe moves the clock past a time that's been received, and returns the new time
+func (c *Clock) Observe(t int32) int32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = max(c.t, t) + 1
+	return c.t
+}
+
+// Advance moves the clock up to t, if it's behind, without a tick of its own; for times seen before, like a stored message's
+func (c *Clock) Advance(t int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = max(c.t, t)
+}
+
+// Sender sends messages, waiting and trying again for as long as the server asks it to slow down.
+// The wait the server asks for holds up every message going through the same Sender, not just the one that was throttled.
+type Sender struct {
+	rpc pb.ChatServiceClient
+
+	// Throttled, if set, is called each time the server asks to slow down, with how long the Sender waits
+	Throttled func(wait time.Duration)
+
+	mu           sync.Mutex
+	backoffUntil time.Time
+}
+
+// NewSender returns a Sender that sends with rpc
+func NewSender(rpc pb.ChatServiceClient) *Sender {
+	return &Sender{rpc: rpc}
+}
+
+// Send sends msg as it is, once any wait the server asked for has passed, and returns the server's ack.
+// It gives up when ctx is done; errors other than being throttled are returned right away.
+func (s *Sender) Send(ctx context.Context, msg *pb.Message) (*pb.MessageAck, error) {
+	for {
+		if err := s.waitForBackoff(ctx); err != nil {
+			return nil, err
+		}
+
+		stream, err := s.rpc.SendMessage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// If sending fails, CloseAndRecv tells why
+		stream.Send(msg)
+		ack, err := stream.CloseAndRecv()
+		if status.Code(err) != codes.ResourceExhausted {
+			return ack, err
+		}
+
+		// The server rate limits senders; wait as long as it says
+		wait := retryAfter(stream.Trailer())
+		if s.Throttled != nil {
+			s.Throttled(wait)
+		}
+		s.startBackoff(wait)
+	}
+}
+
+// Function to make every send wait for at least d
+func (s *Sender) startBackoff(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if until := time.Now().Add(d); until.After(s.backoffUntil) {
+		s.backoffUntil = until
+	}
+}
+
+// Function to wait until the current backoff, if any, has passed, or ctx is done
+func (s *Sender) waitForBackoff(ctx context.Context) error {
+	s.mu.Lock()
+	wait := time.Until(s.backoffUntil)
+	s.mu.Unlock()
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Function to read the server's retry-after trailer; falls back to a second if it's missing
+func retryAfter(trailer metadata.MD) time.Duration {
+	values := trailer.Get("retry-after")
+	if len(values) == 0 {
+		return time.Second
+	}
+	seconds, err := strconv.Atoi(values[0])
+	if err != nil || seconds < 1 {
+		return time.Second
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Token returns credentials that send token with every call, as the "token" metadata servers started with -tokens know users by
+func Token(token string) credentials.PerRPCCredentials {
+	return tokenCredentials(token)
+}
+
+// WithToken has the client send token with every call, so the server knows who it is; see Token
+func WithToken(token string) Option {
+	return WithDialOptions(grpc.WithPerRPCCredentials(Token(token)))
+}
+
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"token": string(t)}, nil
+}
+
+// Tokens are sent without TLS too, as the server doesn't use it
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	pb "ChittyChat/proto"
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"os"
+
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Longest line read from an archive; messages with big edit histories make long lines
+const maxArchiveLine = 16 * 1024 * 1024
+
+// Function to save this channel's archive to path, one JSON record per line
+func exportChannel(ctx context.Context, client pb.ChatServiceClient, path string) {
+	channel := currentChannel()
+	if path == "" {
+		path = channel + ".jsonl"
+	}
+	records, err := writeArchive(ctx, client, path)
+	if err != nil {
+		log.Printf("Cannot export %v to %v - Error: %v", channel, path, err)
+		display.Printf("\n[Cannot export %v.]\n[%v]\n\n", channel, status.Convert(err).Message())
+		return
+	}
+	display.Printf("\n[Exported %v to %v (%v records).]\n\n", channel, path, records)
+}
+
+func writeArchive(ctx context.Context, client pb.ChatServiceClient, path string) (int, error) {
+	stream, err := client.ExportChannel(ctx, currentRef())
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(f)
+	records := 0
+	for {
+		record, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			os.Remove(path)
+			return 0, err
+		}
+		line, err := protojson.Marshal(record)
+		if err != nil {
+			f.Close()
+			return 0, err
+		}
+		w.Write(line)
+		w.WriteString("\n")
+		records++
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return records, f.Close()
+}
+
+// Function to restore an archive saved by /export into channel, this one if it's empty
+func importChannel(ctx context.Context, client pb.ChatServiceClient, path, channel string) {
+	if channel == "" {
+		channel = currentChannel()
+	}
+	result, err := readArchive(ctx, client, path, channel)
+	if err != nil {
+		log.Printf("Cannot import %v into %v - Error: %v", path, channel, err)
+		display.Printf("\n[Cannot import %v into %v.]\n[%v]\n\n", path, channel, status.Convert(err).Message())
+		return
+	}
+	display.Printf("\n[Imported %v messages and %v members into %v.]\n\n", result.GetMessages(), result.GetMembers(), result.GetChannel())
+}
+
+func readArchive(ctx context.Context, client pb.ChatServiceClient, path, channel string) (*pb.ImportResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Cancelled rather than closed when the file turns out broken, so the server doesn't import half of it
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.ImportChannel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The first chunk says where the archive goes, the rest carry it
+	if err := stream.Send(&pb.ImportChunk{Channel: &pb.Channel{Name: channel, SendersName: currentUser()}}); err != nil {
+		_, err = stream.CloseAndRecv()
+		return nil, err
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxArchiveLine)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		record := &pb.ArchiveRecord{}
+		if err := protojson.Unmarshal(scanner.Bytes(), record); err != nil {
+			return nil, err
+		}
+		if err := stream.Send(&pb.ImportChunk{Record: record}); err != nil {
+			// The server said why it stopped taking the archive
+			_, err = stream.CloseAndRecv()
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return stream.CloseAndRecv()
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	pb "ChittyChat/proto"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/grpc/status"
+)
+
+// Size of the chunks files are uploaded in
+const uploadChunkSize = 32 * 1024
+
+// Function to upload a file, then send a message with it attached
+func sendFile(ctx context.Context, client pb.ChatServiceClient, path, text string) {
+	attachment, err := uploadFile(ctx, client, path)
+	if err != nil {
+		log.Printf("Cannot upload %v - Error: %v", path, err)
+		display.Printf("\n[Cannot upload %v.]\n[%v]\n\n", path, status.Convert(err).Message())
+		return
+	}
+	sendMessage(ctx, client, text, "", attachment)
+}
+
+// Function to compute the hex SHA-256 checksum and size of a file
+func checksumFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// Function to upload a file in chunks, showing progress; returns what to attach to a message
+func uploadFile(ctx context.Context, client pb.ChatServiceClient, path string) (*pb.Attachment, error) {
+	sum, size, err := checksumFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stream, err := client.UploadAttachment(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(path)
+	chunk := &pb.AttachmentChunk{
+		Channel: currentRef(),
+		Info:    &pb.Attachment{Name: name, Size: size, Sha256: sum},
+	}
+	buf := make([]byte, uploadChunkSize)
+	var sent int64
+	for {
+		n, readErr := f.Read(buf)
+		if n > 0 || chunk.Info != nil {
+			chunk.Data = buf[:n]
+			// The server stops reading early when it already has the file or refuses it;
+			// either way, what it says comes from CloseAndRecv
+			if err := stream.Send(chunk); err != nil {
+				break
+			}
+			sent += int64(n)
+			showProgress("Uploading", name, sent, size)
+			chunk = &pb.AttachmentChunk{}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+	display.EndStatus()
+
+	return stream.CloseAndRecv()
+}
+
+// Function to download a file into the current folder, showing progress and checking its checksum.
+// The file gets a new name if one with the same name is already there.
+func downloadFile(ctx context.Context, client pb.ChatServiceClient, attachment *pb.Attachment) {
+	stream, err := client.DownloadAttachment(ctx, &pb.AttachmentRef{Sha256: attachment.GetSha256(), User: currentUser()})
+	if err != nil {
+		log.Printf("Cannot download %v - Error: %v", attachment.GetName(), err)
+		display.Printf("\n[%v]\n\n", status.Convert(err).Message())
+		return
+	}
+
+	path := freeFileName(attachment.GetName())
+	tmp, err := os.CreateTemp(".", ".download-*")
+	if err != nil {
+		display.Printf("\n[Cannot save %v: %v]\n\n", path, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	out := io.MultiWriter(tmp, hash)
+	size := attachment.GetSize()
+	var received int64
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			display.EndStatus()
+			log.Printf("Cannot download %v - Error: %v", attachment.GetName(), err)
+			display.Printf("\n[%v]\n\n", status.Convert(err).Message())
+			return
+		}
+		if chunk.GetInfo() != nil {
+			size = chunk.GetInfo().GetSize()
+		}
+		if _, err := out.Write(chunk.GetData()); err != nil {
+			display.Printf("\n[Cannot save %v: %v]\n\n", path, err)
+			return
+		}
+		received += int64(len(chunk.GetData()))
+		showProgress("Downloading", attachment.GetName(), received, size)
+	}
+	display.EndStatus()
+
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != attachment.GetSha256() {
+		log.Printf("Checksum mismatch for %v: got %v, want %v", attachment.GetName(), sum, attachment.GetSha256())
+		display.Printf("\n[%v was damaged on the way (checksum doesn't match), not saved.]\n\n", attachment.GetName())
+		return
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		display.Printf("\n[Cannot save %v: %v]\n\n", path, err)
+		return
+	}
+	log.Printf("Downloaded %v to %v", attachment.GetName(), path)
+	display.Printf("[Saved %v, checksum OK.]\n\n", path)
+}
+
+// Function to find a file name that's not taken yet: name, then name (1), name (2)...
+func freeFileName(name string) string {
+	name = filepath.Base(name)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	path := name
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = fmt.Sprintf("%v (%v)%v", base, i, ext)
+	}
+}
+
+// Function to get the files of a message we've received, or a file by its checksum, and download them
+func getAttachments(ctx context.Context, client pb.ChatServiceClient, ref string) {
+	ref = strings.TrimPrefix(ref, "#")
+	if len(ref) == sha256.Size*2 {
+		downloadFile(ctx, client, &pb.Attachment{Name: ref[:12], Sha256: ref})
+		return
+	}
+	msg := recallMessage(ref)
+	if msg == nil || len(msg.GetAttachments()) == 0 {
+		display.Printf("\n[There are no files attached to message #%v.]\n\n", ref)
+		return
+	}
+	for _, attachment := range msg.GetAttachments() {
+		downloadFile(ctx, client, attachment)
+	}
+}
+
+// Function to show how far along an upload or download is, on a single line
+func showProgress(action, name string, done, total int64) {
+	percent := int64(100)
+	if total > 0 {
+		percent = done * 100 / total
+	}
+	display.Status(fmt.Sprintf("[%v %v: %v / %v (%v%%)]", action, name, formatSize(done), formatSize(total), percent))
+}
+
+// Function to format a size in bytes for people, e.g. 12.3 KiB
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%v B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// Function to format the files attached to a message, one per line
+func formatAttachments(msg *pb.Message) string {
+	var b strings.Builder
+	for _, attachment := range msg.GetAttachments() {
+		fmt.Fprintf(&b, "  📎 %v (%v), /get %v\n", attachment.GetName(), formatSize(attachment.GetSize()), msg.GetId())
+	}
+	return b.String()
+}
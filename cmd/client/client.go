@@ -0,0 +1,476 @@
+package main
+
+import (
+	chat "ChittyChat/client"
+	pb "ChittyChat/proto"
+	"ChittyChat/render"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	cursor "atomicgo.dev/cursor"
+	"github.com/inancgumus/screen"
+	"golang.org/x/term"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// Function to stay in the channel: when the connection to the server is lost, it joins again
+// (waiting longer each time it can't) and catches up on what it missed
+func joinChannel(ctx context.Context, client pb.ChatServiceClient) { //, Lamport int) {
+	wait := time.Second
+	notified := false
+	for {
+		joined, err := followChannel(ctx, client)
+
+		// We left the channel for another one
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Kicked or banned by a moderator
+		if status.Code(err) == codes.PermissionDenied {
+			exitf("Removed from channel: %v", status.Convert(err).Message())
+		}
+
+		// The stream closes when the server stops (io.EOF), or can't be reached; anything else is a real problem
+		if err != io.EOF && status.Code(err) != codes.Unavailable {
+			exitf("Failed to receive message from channel joining. \nError: %v", err)
+		}
+
+		if joined {
+			wait = time.Second
+			notified = false
+		}
+		log.Printf("Lost connection to the server, trying again in %v: %v", wait, err)
+		if !notified {
+			display.Printf("\n[Can't reach the server, trying again until it's back.]\n[Messages from last time are still there with /history.]\n\n")
+			notified = true
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, 30*time.Second)
+	}
+}
+
+// Function to join the channel and show what comes in until the stream ends.
+// Returns whether it got to join, and why the stream ended.
+func followChannel(ctx context.Context, client pb.ChatServiceClient) (bool, error) {
+	stream, err := client.JoinChannel(ctx, currentRef())
+	if err != nil {
+		return false, err
+	}
+
+	// Send the join message to the server. It's only for this connection, so it doesn't wait in the outbox;
+	// what does gets its turn now that the server's back.
+	deliver(ctx, newMessage("9cbf281b855e41b4ad9f97707efdd29d", ""))
+	outgoing.retryNow()
+
+	// Catch up on what was said while we were away, and who mentioned us
+	catchUp(ctx, client)
+	showMentions(ctx, client, true)
+
+	// The for loop is an infinite loop: Won't ever exit unless stream is closed
+	for {
+		// Receive message from stream and store it in incoming and possible error in err
+		incoming, err := stream.Recv()
+
+		// The stream closes when the client disconnects from the server, or vice versa
+		if err != nil {
+			return true, err
+		}
+
+		incrLamport(incoming)
+		rememberMessage(incoming)
+		storeMessage(incoming)
+
+		// The log gets the message as typed, the terminal gets it styled
+		messageFormat := "Received at " + formatClientMessage(incoming, plain)
+		styledFormat := "Received at " + formatClientMessage(incoming, styled)
+
+		if currentUser() == incoming.GetSender() {
+			if incoming.GetMessage() != fmt.Sprintf("Participant %v joined Chitty-Chat at Lamport time %v", incoming.GetSender(), incoming.GetTimestamp()-3) {
+				display.ClearTyped()
+			}
+			log.Print(messageFormat)
+			display.Print(styledFormat)
+		} else {
+			log.Print(messageFormat)
+			display.Print(styledFormat)
+			if mentionsMe(incoming) {
+				notifyMention(incoming)
+			}
+		}
+	}
+}
+
+// Function to get what changed in the channel since we were last in it, and show it.
+// The first time in a channel, that's its last messages.
+func catchUp(ctx context.Context, client pb.ChatServiceClient) {
+	channel := currentRef()
+	since := storedRevision(currentChannel())
+	history, err := client.GetHistory(ctx, &pb.HistoryRequest{Channel: channel, SinceRevision: since})
+	if err == nil && history.GetRevision() < since {
+		// The server has forgotten its messages (it was restarted), so the ids we kept mean something else now
+		log.Printf("Server is at revision %v, we were at %v; starting over", history.GetRevision(), since)
+		resetStore(currentChannel())
+		since = 0
+		history, err = client.GetHistory(ctx, &pb.HistoryRequest{Channel: channel})
+	}
+	if err != nil {
+		log.Printf("Cannot catch up - Error: %v", err)
+		return
+	}
+
+	var missed []*pb.Message
+	for _, msg := range history.GetMessages() {
+		known := recallMessage(msg.GetId())
+		// Already here, e.g. it came in on the stream since we joined
+		if known != nil && known.GetRevision() >= msg.GetRevision() {
+			continue
+		}
+		if known == nil && (msg.GetEvent() == pb.Event_DELETED || expired(msg)) {
+			storeMessage(msg)
+			continue
+		}
+		missed = append(missed, msg)
+	}
+	if len(missed) == 0 {
+		return
+	}
+
+	if since == 0 {
+		display.Printf("\n ━━━━━⊱⊱ Recently in %v ⊰⊰━━━━━\n", currentChannel())
+	} else {
+		changes := "changes"
+		if len(missed) == 1 {
+			changes = "change"
+		}
+		display.Printf("\n ━━━━━⊱⊱ %v %v while you were away ⊰⊰━━━━━\n", len(missed), changes)
+	}
+	for _, msg := range missed {
+		known := recallMessage(msg.GetId())
+		clock.Advance(msg.GetTimestamp())
+		log.Print("Caught up on " + formatCatchUp(msg, known, plain))
+		display.Print(formatCatchUp(msg, known, styled))
+		rememberMessage(msg)
+		storeMessage(msg)
+	}
+	display.Printf(" ━━━━━⊱⊱ Up to date ⊰⊰━━━━━\n\n")
+}
+
+// Function to leave the channel we're in, if any, and join channel as name
+func switchChannel(ctx context.Context, client pb.ChatServiceClient, channel, name string) {
+	joinMu.Lock()
+	defer joinMu.Unlock()
+	if leaveChannel != nil {
+		leaveChannel()
+	}
+	here.Lock()
+	here.channel, here.user = channel, name
+	here.Unlock()
+	styled = render.New(useColor(), name)
+	plain = render.New(false, name)
+	useStore(channel)
+
+	var joinCtx context.Context
+	joinCtx, leaveChannel = context.WithCancel(ctx)
+	go joinChannel(joinCtx, client)
+}
+
+// replyTo is the id of the message this one replies to, or empty.
+// The message waits in the outbox until the server has it, so it isn't lost when the server can't be reached.
+func sendMessage(ctx context.Context, client pb.ChatServiceClient, message, replyTo string, attachments ...*pb.Attachment) { //, Lamport int) {
+	outgoing.add(newMessage(message, replyTo, attachments...))
+}
+
+// Function to send an ephemeral message, which the server deletes after ttl
+func sendEphemeral(text string, ttl time.Duration) {
+	msg := newMessage(text, "")
+	msg.TtlSeconds = int64(ttl / time.Second)
+	outgoing.add(msg)
+}
+
+// Function to make a message from us to the channel we're in, stamped with our Lamport time
+func newMessage(message, replyTo string, attachments ...*pb.Attachment) *pb.Message {
+	// Create message, with the Lamport time increased for sending it
+	channel := currentRef()
+	return &pb.Message{
+		Channel: channel,
+		Message: message,
+		Sender:  channel.GetSendersName(),
+		//Local Timestamp
+		Timestamp:   clock.Tick(),
+		ReplyTo:     replyTo,
+		Attachments: attachments,
+	}
+}
+
+// Function to send a message to the server, waiting and trying again while it's asking us to slow down.
+// Messages the server refuses are reported to the user; other errors are left to the caller.
+func deliver(ctx context.Context, msg *pb.Message) error {
+	ack, err := sender.Send(ctx, msg)
+
+	// The server validates messages (length, names, empty text, what they reply to) and enforces
+	// bans and mutes; tell the user why it was refused
+	if refused(err) {
+		log.Printf("Message rejected: %v", status.Convert(err).Message())
+		display.Printf("\n[Message not sent.]\n[%v]\n\n", status.Convert(err).Message())
+		return err
+	}
+
+	if err != nil {
+		log.Printf("Cannot send message - Error: %v", err)
+		return err
+	}
+
+	log.Printf("Message  %v \n", ack)
+	display.Sent(ack)
+	return nil
+}
+
+// Function to tell the user the server has asked us to slow down; the message is sent once the wait is over
+func throttled(wait time.Duration) {
+	log.Printf("Throttled by server, retrying in %v", wait)
+	display.Printf("\n[Whoa, slow down!]\n[Your message will be sent in %v.]\n\n", wait)
+}
+
+// Function to check whether the server refused a message, so sending it again won't help
+func refused(err error) bool {
+	code := status.Code(err)
+	return code == codes.InvalidArgument || code == codes.PermissionDenied || code == codes.NotFound
+}
+
+// Function to increment the client's Lamport timestamp; used after receiving a message
+func incrLamport(msg *pb.Message) {
+	msg.Timestamp = clock.Observe(msg.GetTimestamp())
+}
+
+// Where we are: the channel we're in and who we're in it as. switchChannel changes them while the other goroutines read them.
+var here struct {
+	sync.Mutex
+	channel, user string
+}
+
+// Function to get the channel we're in
+func currentChannel() string {
+	here.Lock()
+	defer here.Unlock()
+	return here.channel
+}
+
+// Function to get who we are
+func currentUser() string {
+	here.Lock()
+	defer here.Unlock()
+	return here.user
+}
+
+// Function to get the channel we're in and who we are, as requests send them
+func currentRef() *pb.Channel {
+	here.Lock()
+	defer here.Unlock()
+	return &pb.Channel{Name: here.channel, SendersName: here.user}
+}
+
+// Function to check whether to style output: not when asked not to, or when it's not going to a terminal
+func useColor() bool {
+	return render.Wanted(*noColor, term.IsTerminal(int(os.Stdout.Fd())))
+}
+
+// Function from atomicgo.dev/cursor to clear the previous line in the console
+func clearPreviousConsoleLine() {
+	cursor.ClearLinesUp(1)
+	cursor.StartOfLine()
+}
+
+// Function to format message to be printed to the client, styled by r
+func formatClientMessage(incoming *pb.Message, r *render.Renderer) string {
+	switch incoming.GetEvent() {
+	case pb.Event_EDITED:
+		return fmt.Sprintf("%v\n[%v] edited message #%v from %v: %v\n\n", r.Dim(fmt.Sprintf("Lamport time: %v", incoming.GetTimestamp())), r.Sender(lastEditor(incoming)), incoming.GetId(), r.Sender(incoming.GetSender()), r.Message(incoming.GetMessage()))
+	case pb.Event_DELETED:
+		if expired(incoming) {
+			return fmt.Sprintf("%v\n[message #%v from %v has disappeared]\n\n", r.Dim(fmt.Sprintf("Lamport time: %v", incoming.GetTimestamp())), incoming.GetId(), r.Sender(incoming.GetSender()))
+		}
+		return fmt.Sprintf("%v\n[%v] deleted message #%v from %v\n\n", r.Dim(fmt.Sprintf("Lamport time: %v", incoming.GetTimestamp())), r.Sender(lastEditor(incoming)), incoming.GetId(), r.Sender(incoming.GetSender()))
+	case pb.Event_REACTED:
+		return fmt.Sprintf("%v\n  #%v [%v]: %v\n  %v\n\n", r.Dim(fmt.Sprintf("Lamport time: %v", incoming.GetTimestamp())), incoming.GetId(), r.Sender(incoming.GetSender()), r.Message(shorten(incoming.GetMessage(), 40)), formatReactions(incoming))
+	}
+	if incoming.GetReplyTo() != "" {
+		return fmt.Sprintf("%v\n%v[%v]: %v\n%v\n", r.Dim(fmt.Sprintf("Lamport time: %v  #%v%v", incoming.GetTimestamp(), incoming.GetId(), expiryNote(incoming))), formatQuote(incoming.GetReplyTo(), r), r.Sender(incoming.GetSender()), r.Message(incoming.GetMessage()), formatAttachments(incoming))
+	}
+	if incoming.GetId() != "" {
+		return fmt.Sprintf("%v\n[%v]: %v\n%v\n", r.Dim(fmt.Sprintf("Lamport time: %v  #%v%v", incoming.GetTimestamp(), incoming.GetId(), expiryNote(incoming))), r.Sender(incoming.GetSender()), r.Message(incoming.GetMessage()), formatAttachments(incoming))
+	}
+	return fmt.Sprintf("%v\n[%v]: %v\n\n", r.Dim(fmt.Sprintf("Lamport time: %v", incoming.GetTimestamp())), r.Sender(incoming.GetSender()), r.Message(incoming.GetMessage()))
+}
+
+// Function to say when an ephemeral message disappears, e.g. "  disappears at 15:04"; empty for other messages
+func expiryNote(msg *pb.Message) string {
+	if msg.GetExpiresAt() == 0 {
+		return ""
+	}
+	return "  disappears at " + time.Unix(msg.GetExpiresAt(), 0).Format("15:04:05")
+}
+
+// Function to format the reactions to a message, e.g. "👍 2  ❤️ 1"
+func formatReactions(msg *pb.Message) string {
+	var counts []string
+	for _, reaction := range msg.GetReactions() {
+		counts = append(counts, fmt.Sprintf("%v %v", reaction.GetEmoji(), len(reaction.GetUsers())))
+	}
+	if len(counts) == 0 {
+		return "(no reactions)"
+	}
+	return strings.Join(counts, "  ")
+}
+
+// Function to get who last edited or deleted a message
+func lastEditor(msg *pb.Message) string {
+	if len(msg.GetEdits()) == 0 {
+		return msg.GetSender()
+	}
+	return msg.GetEdits()[len(msg.GetEdits())-1].GetEditor()
+}
+
+func printWelcome() {
+	display.Println("\n ━━━━━⊱⊱ ⋆  CHITTY CHAT ⋆ ⊰⊰━━━━━")
+	display.Println("⋆｡˚ ☁︎ ˚｡ Welcome to " + currentChannel())
+	display.Println("⋆｡˚ ☁︎ ˚｡ Your username's " + currentUser())
+	display.Print("⋆｡˚ ☁︎ ˚｡ To exit, press Ctrl + C\n\n\n")
+}
+
+var channelName = flag.String("channel", "Eepy", "Channel name for chatting")
+var senderName = flag.String("username", "Anon", "Sender's name")
+var tcpServer = flag.String("server", ":8080", "Tcp server")
+var token = flag.String("token", "", "Token the server knows you by, which you need to moderate channels")
+var noColor = flag.Bool("no-color", false, "Show messages without colors or styling (also when NO_COLOR is set)")
+
+// Renderers for what's shown in the terminal, and for what's written to the log
+var styled, plain *render.Renderer
+
+// The client's Lamport clock
+var clock chat.Clock
+
+// Sends messages, holding back while the server has asked us to slow down
+var sender *chat.Sender
+
+// Ends the stream of the channel we're in, when switching to another
+var leaveChannel context.CancelFunc
+var joinMu sync.Mutex
+
+func main() {
+	flag.Parse()
+
+	styled = render.New(useColor(), *senderName)
+	plain = render.New(false, *senderName)
+
+	if *historyFile == "" {
+		*historyFile = *senderName + ".history"
+	}
+
+	var err error
+	display, err = newDisplay(loadHistory(*historyFile))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer display.Close()
+
+	// The full-screen interface draws its own screen
+	if _, ok := display.(*tuiUI); !ok {
+		screen.Clear()
+		screen.MoveTopLeft()
+		time.Sleep(time.Second / 60)
+	}
+
+	printWelcome()
+
+	f := setLog(*senderName)
+	defer f.Close()
+
+	// Show what we have from last time right away, before the server's even there
+	if *storeDir == "" {
+		*storeDir = *senderName + ".messages"
+	}
+	useStore(*channelName)
+
+	// Messages that couldn't be sent last time are sent first
+	if *outboxFile == "" {
+		*outboxFile = *senderName + ".outbox"
+	}
+	outgoing = openOutbox(*outboxFile)
+	if waiting := len(outgoing.pending()); waiting > 0 {
+		display.Printf("\n[%v messages from last time are waiting to be sent.]\n\n", waiting)
+	}
+
+	// Not waiting for the connection: the client works without the server, and joins once it's there
+	var opts []grpc.DialOption
+	opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if *token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(chat.Token(*token)))
+	}
+
+	conn, err := grpc.Dial(*tcpServer, opts...)
+	if err != nil {
+		exitf("Fail to dial: %v", err)
+	}
+
+	ctx := context.Background()
+	client := pb.NewChatServiceClient(conn)
+	sender = chat.NewSender(client)
+	sender.Throttled = throttled
+
+	defer conn.Close()
+
+	go outgoing.run(ctx, client)
+	switchChannel(ctx, client, *channelName, *senderName)
+	if _, ok := display.(*tuiUI); ok {
+		go pollChannels(ctx, client)
+	}
+
+	display.Run(func(message string) {
+		if !utf8.ValidString(message) {
+			display.Printf("\n[Invalid characters.]\n[Please ensure your message is UTF-8 encoded.]\n\n")
+			return
+		}
+		// A line starting with // sends a message starting with /
+		if strings.HasPrefix(message, "//") {
+			message = message[1:]
+		} else if strings.HasPrefix(message, "/") {
+			runCommand(ctx, client, message)
+			return
+		}
+		sendMessage(ctx, client, message, "")
+	})
+}
+
+    // sets the logger to use a log.txt file instead of the console
+    func setLog(name string) *os.File {
+        // Clears the log.txt file when a new server is started
+		
+		if _,err := os.Open(fmt.Sprintf("%s.txt",name)); err == nil {
+        if err := os.Truncate(fmt.Sprintf("%s.txt",name), 0); err != nil {
+            log.Printf("Failed to truncate: %v", err)
+        }}
+
+        // This connects to the log file/changes the output of the log information to the log.txt file.
+        f, err := os.OpenFile(fmt.Sprintf("%s.txt",name), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+        if err != nil {
+            log.Fatalf("error opening file: %v", err)
+        }
+        log.SetOutput(f)
+        return f
+    }
\ No newline at end of file
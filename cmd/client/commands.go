@@ -0,0 +1,465 @@
+package main
+
+import (
+	pb "ChittyChat/proto"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// command is a slash command the client knows. Commands are registered once, in init,
+// so adding one doesn't touch the input loop.
+type command struct {
+	name  string
+	usage string // the arguments, e.g. "<user> [reason]"
+	help  string
+	// How many arguments it takes; max -1 is no limit
+	minArgs, maxArgs int
+	// What each argument is completed with on Tab; the last one is used for any after it
+	complete []completion
+	run      func(ctx context.Context, client pb.ChatServiceClient, args commandArgs)
+}
+
+// completion lists the words an argument can be completed with
+type completion func() []string
+
+// commandArgs is what was typed after the command
+type commandArgs struct {
+	line   string
+	fields []string
+}
+
+// Function to get the nth argument, counting from 0
+func (a commandArgs) get(n int) string {
+	if n < len(a.fields) {
+		return a.fields[n]
+	}
+	return ""
+}
+
+// Function to get everything after the first n arguments, spacing as typed
+func (a commandArgs) rest(n int) string {
+	return restOfLine(a.line, n+1)
+}
+
+// The registered commands, by name with the '/'
+var commands = make(map[string]*command)
+
+// Function to add a command, panics if the name is taken
+func registerCommand(c *command) {
+	if _, ok := commands[c.name]; ok {
+		panic("command " + c.name + " registered twice")
+	}
+	commands[c.name] = c
+}
+
+// Function to run a line starting with '/' as a command
+func runCommand(ctx context.Context, client pb.ChatServiceClient, line string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+	c, ok := commands[fields[0]]
+	if !ok {
+		display.Printf("\n[Unknown command %v, type /help to see them all.]\n[Start with // to send a message starting with /.]\n\n", fields[0])
+		return
+	}
+	args := commandArgs{line: line, fields: fields[1:]}
+	if len(args.fields) < c.minArgs || (c.maxArgs >= 0 && len(args.fields) > c.maxArgs) {
+		display.Printf("\n[Usage: %v]\n[%v]\n\n", commandUsage(c), c.help)
+		return
+	}
+	c.run(ctx, client, args)
+}
+
+// Function to get how a command is used, e.g. "/kick <user> [reason]"
+func commandUsage(c *command) string {
+	if c.usage == "" {
+		return c.name
+	}
+	return c.name + " " + c.usage
+}
+
+// Function to list every command, or explain one
+func showHelp(name string) {
+	if name != "" {
+		if !strings.HasPrefix(name, "/") {
+			name = "/" + name
+		}
+		c, ok := commands[name]
+		if !ok {
+			display.Printf("\n[Unknown command %v.]\n\n", name)
+			return
+		}
+		display.Printf("\n[Usage: %v]\n[%v]\n\n", commandUsage(c), c.help)
+		return
+	}
+	display.Printf("\n ━━━━━⊱⊱ Commands ⊰⊰━━━━━\n")
+	for _, name := range commandNames() {
+		display.Printf("  %v\n      %v\n", commandUsage(commands[name]), styled.Dim(commands[name].help))
+	}
+	display.Printf("[Tab completes commands, users and channels in full-screen mode.]\n\n")
+}
+
+// Function to get the names of all commands, sorted
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Function to find what the word being typed could be completed to; before is the text before the word.
+// Commands complete at the start of the line, their arguments as the command says,
+// and @mentions in messages complete to usernames.
+func completions(before, word string) []string {
+	var options []string
+	fields := strings.Fields(before)
+	switch {
+	case len(fields) == 0 && strings.HasPrefix(word, "/"):
+		options = commandNames()
+	case len(fields) > 0 && strings.HasPrefix(before, "/"):
+		c, ok := commands[fields[0]]
+		if !ok || len(c.complete) == 0 {
+			return nil
+		}
+		n := len(fields) - 1
+		if n >= len(c.complete) {
+			n = len(c.complete) - 1
+		}
+		if c.complete[n] == nil {
+			return nil
+		}
+		options = c.complete[n]()
+	case strings.HasPrefix(word, "@"):
+		for _, user := range completeUsers() {
+			options = append(options, "@"+user)
+		}
+	}
+
+	var matches []string
+	for _, option := range options {
+		if strings.HasPrefix(option, word) {
+			matches = append(matches, option)
+		}
+	}
+	return matches
+}
+
+// Channels and their members, as last listed by the server
+var knownChannels []*pb.ChannelInfo
+var knownChannelsMu sync.Mutex
+
+// Function to get the users we know of: who's in a channel, and who sent what we've seen
+func completeUsers() []string {
+	seen := make(map[string]bool)
+	knownChannelsMu.Lock()
+	for _, channel := range knownChannels {
+		for _, member := range channel.GetMembers() {
+			seen[member] = true
+		}
+	}
+	knownChannelsMu.Unlock()
+	seenMu.Lock()
+	for _, msg := range seenMessages {
+		seen[msg.GetSender()] = true
+	}
+	seenMu.Unlock()
+
+	users := make([]string, 0, len(seen))
+	for user := range seen {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// Function to get the channels someone is in
+func completeChannels() []string {
+	knownChannelsMu.Lock()
+	defer knownChannelsMu.Unlock()
+	var channels []string
+	for _, channel := range knownChannels {
+		channels = append(channels, channel.GetName())
+	}
+	return channels
+}
+
+// Function to get the ids of messages we've seen, newest first
+func completeIDs() []string {
+	var ids []string
+	for _, msg := range recentMessages("", 50) {
+		ids = append([]string{msg.GetId()}, ids...)
+	}
+	return ids
+}
+
+func init() {
+	users := []completion{completeUsers}
+	ids := []completion{completeIDs, nil}
+
+	registerCommand(&command{name: "/help", usage: "[command]", help: "Lists the commands, or explains one.", maxArgs: 1,
+		complete: []completion{commandNames},
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			showHelp(args.get(0))
+		}})
+	registerCommand(&command{name: "/quit", help: "Leaves the chat.", maxArgs: 0,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			display.Close()
+			os.Exit(0)
+		}})
+	registerCommand(&command{name: "/join", usage: "<channel>", help: "Leaves this channel and joins another.", minArgs: 1, maxArgs: 1,
+		complete: []completion{completeChannels},
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			switchChannel(ctx, client, args.get(0), currentUser())
+		}})
+	registerCommand(&command{name: "/nick", usage: "<name>", help: "Rejoins the channel under another name.", minArgs: 1, maxArgs: 1,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			switchChannel(ctx, client, currentChannel(), args.get(0))
+		}})
+	registerCommand(&command{name: "/me", usage: "<action>", help: "Says what you're doing, e.g. /me waves.", minArgs: 1, maxArgs: -1,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			sendMessage(ctx, client, "* "+currentUser()+" "+args.rest(0), "")
+		}})
+	registerCommand(&command{name: "/clear", help: "Clears the screen.", maxArgs: 0,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			display.Clear()
+		}})
+	registerCommand(&command{name: "/history", usage: "[count]", help: "Shows the last messages in this channel, 20 unless told otherwise.", maxArgs: 1,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			showHistory(args.get(0))
+		}})
+
+	registerCommand(&command{name: "/outbox", usage: "[clear]", help: "Shows the messages waiting to be sent while the server can't be reached, or drops them.", maxArgs: 1,
+		complete: []completion{func() []string { return []string{"clear"} }},
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			switch args.get(0) {
+			case "":
+				showOutbox()
+			case "clear":
+				display.Printf("\n[Dropped %v waiting messages.]\n\n", outgoing.clear())
+			default:
+				display.Printf("\n[Usage: /outbox [clear]]\n\n")
+			}
+		}})
+
+	registerCommand(&command{name: "/kick", usage: "<user> [reason]", help: "Removes someone from the channel (operators only).", minArgs: 1, maxArgs: -1,
+		complete: users,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			moderate(ctx, client.Kick, args.get(0), 0, args.rest(1))
+		}})
+	registerCommand(&command{name: "/ban", usage: "<user> <duration|forever> [reason]", help: "Keeps someone out of the channel, e.g. /ban Anon 10m spamming (operators only).", minArgs: 2, maxArgs: -1,
+		complete: users,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			restrict(ctx, client.Ban, args)
+		}})
+	registerCommand(&command{name: "/mute", usage: "<user> <duration|forever> [reason]", help: "Stops someone from sending, e.g. /mute Anon 10m spamming (operators only).", minArgs: 2, maxArgs: -1,
+		complete: users,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			restrict(ctx, client.Mute, args)
+		}})
+	registerCommand(&command{name: "/op", usage: "<user>", help: "Makes someone an operator (the owner only).", minArgs: 1, maxArgs: 1,
+		complete: users,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			moderate(ctx, client.Op, args.get(0), 0, "")
+		}})
+	registerCommand(&command{name: "/ephemeral", usage: "<duration> <text>", help: "Sends a message that disappears after a while, e.g. /ephemeral 10m back soon.", minArgs: 2, maxArgs: -1,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			ttl, err := time.ParseDuration(args.get(0))
+			if err != nil || ttl < time.Second {
+				display.Printf("\n[Invalid duration %q, try e.g. 30s, 10m or 24h.]\n\n", args.get(0))
+				return
+			}
+			sendEphemeral(args.rest(1), ttl)
+		}})
+	registerCommand(&command{name: "/edit", usage: "<id> <new text>", help: "Changes a message you sent.", minArgs: 2, maxArgs: -1,
+		complete: ids,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			editMessage(ctx, client.EditMessage, args.get(0), args.rest(1))
+		}})
+	registerCommand(&command{name: "/delete", usage: "<id>", help: "Deletes a message you sent.", minArgs: 1, maxArgs: 1,
+		complete: ids,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			editMessage(ctx, client.DeleteMessage, args.get(0), "")
+		}})
+	registerCommand(&command{name: "/reply", usage: "<id> <text>", help: "Replies to a message, starting or continuing its thread.", minArgs: 2, maxArgs: -1,
+		complete: ids,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			sendMessage(ctx, client, args.rest(1), strings.TrimPrefix(args.get(0), "#"))
+		}})
+	registerCommand(&command{name: "/thread", usage: "<id>", help: "Shows the whole thread a message is in.", minArgs: 1, maxArgs: 1,
+		complete: ids,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			showThread(ctx, client, strings.TrimPrefix(args.get(0), "#"))
+		}})
+	registerCommand(&command{name: "/react", usage: "<id> <emoji>", help: "Reacts to a message; reacting again with the same emoji takes it back.", minArgs: 2, maxArgs: 2,
+		complete: ids,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			react(ctx, client, strings.TrimPrefix(args.get(0), "#"), args.get(1))
+		}})
+	registerCommand(&command{name: "/mentions", help: "Shows the messages that mention you.", maxArgs: 0,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			showMentions(ctx, client, false)
+		}})
+	registerCommand(&command{name: "/search", usage: "[from:<user>] [in:<channel>|in:*] [after:<date>] [before:<date>] [since:<Lamport>] [until:<Lamport>] words \"a phrase\"", help: "Searches old messages.", minArgs: 1, maxArgs: -1,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			search(ctx, client, args.rest(0))
+		}})
+	registerCommand(&command{name: "/more", help: "Shows the next page of search results.", maxArgs: 0,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			searchMore(ctx, client)
+		}})
+	registerCommand(&command{name: "/send-file", usage: "<path> [text]", help: "Sends a file, with a message if you like.", minArgs: 1, maxArgs: -1,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			go sendFile(ctx, client, args.get(0), args.rest(1))
+		}})
+	registerCommand(&command{name: "/get", usage: "<message id or checksum>", help: "Downloads the files attached to a message.", minArgs: 1, maxArgs: 1,
+		complete: ids,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			go getAttachments(ctx, client, args.get(0))
+		}})
+	registerCommand(&command{name: "/export", usage: "[file]", help: "Saves this channel's messages, members and audit log to a file, <channel>.jsonl unless told otherwise (operators only).", maxArgs: 1,
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			go exportChannel(ctx, client, args.get(0))
+		}})
+	registerCommand(&command{name: "/import", usage: "<file> [channel]", help: "Restores a file saved by /export into an empty channel, this one unless told otherwise.", minArgs: 1, maxArgs: 2,
+		complete: []completion{nil, completeChannels},
+		run: func(ctx context.Context, client pb.ChatServiceClient, args commandArgs) {
+			go importChannel(ctx, client, args.get(0), args.get(1))
+		}})
+}
+
+// Function to get what's left of line after its first n words, keeping the spacing as typed
+func restOfLine(line string, n int) string {
+	rest := strings.TrimSpace(line)
+	for i := 0; i < n; i++ {
+		j := strings.IndexAny(rest, " \t")
+		if j < 0 {
+			return ""
+		}
+		rest = strings.TrimLeft(rest[j:], " \t")
+	}
+	return rest
+}
+
+// moderationRPC is one of the Kick, Ban, Mute or Op calls of the chat client
+type moderationRPC = func(ctx context.Context, req *pb.ModerationRequest, opts ...grpc.CallOption) (*pb.MessageAck, error)
+
+// Function to ban or mute, as in /ban <user> <duration|forever> [reason]
+func restrict(ctx context.Context, rpc moderationRPC, args commandArgs) {
+	d, err := parseModerationDuration(args.get(1))
+	if err != nil {
+		display.Printf("\n[%v]\n\n", err)
+		return
+	}
+	moderate(ctx, rpc, args.get(0), d, args.rest(2))
+}
+
+// Function to send a moderation request for target in the current channel
+func moderate(ctx context.Context, rpc moderationRPC, target string, d time.Duration, reason string) {
+	req := &pb.ModerationRequest{
+		Channel:         currentRef(),
+		Target:          target,
+		DurationSeconds: int64(d / time.Second),
+		Reason:          reason,
+	}
+
+	ack, err := rpc(ctx, req)
+	if err != nil {
+		log.Printf("Moderation failed - Error: %v", err)
+		display.Printf("\n[%v]\n\n", status.Convert(err).Message())
+		return
+	}
+	log.Printf("Moderation  %v \n", ack)
+}
+
+// editRPC is either the EditMessage or DeleteMessage call of the chat client
+type editRPC = func(ctx context.Context, req *pb.EditRequest, opts ...grpc.CallOption) (*pb.MessageAck, error)
+
+// Function to edit or delete the message with the given id ("12" or "#12")
+func editMessage(ctx context.Context, rpc editRPC, id, text string) {
+	req := &pb.EditRequest{
+		Channel: currentRef(),
+		Id:      strings.TrimPrefix(id, "#"),
+		Message: text,
+		// Changing a message is an event, so the Lamport time goes up like when sending
+		Timestamp: clock.Tick(),
+	}
+
+	ack, err := rpc(ctx, req)
+	if err != nil {
+		log.Printf("Cannot change message - Error: %v", err)
+		display.Printf("\n[%v]\n\n", status.Convert(err).Message())
+		return
+	}
+	log.Printf("Message  %v \n", ack)
+}
+
+// Function to toggle our reaction on the message with the given id
+func react(ctx context.Context, client pb.ChatServiceClient, id, emoji string) {
+	ack, err := client.React(ctx, &pb.ReactionRequest{
+		Channel: currentRef(),
+		Id:      id,
+		Emoji:   emoji,
+		// Reacting is an event, so the Lamport time goes up like when sending
+		Timestamp: clock.Tick(),
+	})
+	if err != nil {
+		log.Printf("Cannot react - Error: %v", err)
+		display.Printf("\n[%v]\n\n", status.Convert(err).Message())
+		return
+	}
+	log.Printf("Reaction  %v \n", ack)
+}
+
+// Function to print every message in the thread of the message with the given id
+func showThread(ctx context.Context, client pb.ChatServiceClient, id string) {
+	thread, err := client.GetThread(ctx, &pb.MessageRef{
+		Channel: currentRef(),
+		Id:      id,
+	})
+	if err != nil {
+		log.Printf("Cannot get thread - Error: %v", err)
+		display.Printf("\n[%v]\n\n", status.Convert(err).Message())
+		return
+	}
+
+	display.Printf("\n ━━━━━⊱⊱ Thread #%v ⊰⊰━━━━━\n", id)
+	for _, msg := range thread.GetMessages() {
+		if msg.GetEvent() == pb.Event_DELETED {
+			display.Printf("  #%v [deleted]\n", msg.GetId())
+			continue
+		}
+		indent := ""
+		if msg.GetReplyTo() != "" {
+			indent = "  ↳ "
+		}
+		display.Printf("%v#%v [%v]: %v\n", indent, msg.GetId(), styled.Sender(msg.GetSender()), styled.Message(msg.GetMessage()))
+		if len(msg.GetReactions()) > 0 {
+			display.Printf("%v    %v\n", indent, formatReactions(msg))
+		}
+	}
+	display.Println()
+}
+
+// Function to parse a ban or mute duration like "10m"; "forever" (or 0) never expires
+func parseModerationDuration(value string) (time.Duration, error) {
+	if value == "forever" || value == "0" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < time.Second {
+		return 0, fmt.Errorf("Invalid duration %q, use e.g. 30s, 10m, 2h or forever", value)
+	}
+	return d, nil
+}
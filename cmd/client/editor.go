@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// How many typed lines are kept in the history file
+const historySize = 500
+
+// lineEditor holds what the user is typing and handles the keys that edit it, readline style.
+// The full-screen interface and the line interface (when it's in a terminal) both use it.
+type lineEditor struct {
+	text   []rune
+	cursor int
+
+	history  *inputHistory
+	browsing int    // where we are in the history with Up and Down; len(entries) when not browsing
+	draft    []rune // what was typed before going through the history
+
+	pasting bool   // between the start and end of a bracketed paste
+	hint    string // e.g. the options when Tab can't decide; shown until the next key
+}
+
+// editorEvent is something the interface has to act on after feeding keys to the editor
+type editorEvent struct {
+	kind editorEventKind
+	text string // the line for editorLine, the escape sequence for editorKey
+}
+
+type editorEventKind int
+
+const (
+	editorLine   editorEventKind = iota // the user pressed Enter
+	editorQuit                          // Ctrl+C, or Ctrl+D on an empty line
+	editorRedraw                        // Ctrl+L
+	editorKey                           // a key the editor doesn't use, like PgUp
+)
+
+func newLineEditor(history *inputHistory) *lineEditor {
+	return &lineEditor{history: history, browsing: len(history.entries)}
+}
+
+// Function to handle the keys in data. Returns what's left of an unfinished key, to be fed again with what comes next.
+// Enter only sends when it's the last thing read: a newline with more after it was pasted,
+// so it goes into the message instead of sending every pasted line on its own.
+func (e *lineEditor) feed(data []byte) ([]byte, []editorEvent) {
+	var events []editorEvent
+	e.hint = ""
+	for len(data) > 0 {
+		b := data[0]
+		switch {
+		case b == 0x1b:
+			seq, n, complete := escapeSequence(data)
+			if !complete {
+				return data, events
+			}
+			data = data[n:]
+			if event, ok := e.escape(seq); ok {
+				events = append(events, event)
+			}
+		case e.pasting && (b == '\r' || b == '\n'):
+			e.insert('\n')
+			data = data[1:]
+		case b == '\r' || b == '\n':
+			data = data[1:]
+			if len(data) > 0 && b == '\r' && data[0] == '\n' {
+				data = data[1:]
+			}
+			if len(data) > 0 && data[0] != 0x1b {
+				e.insert('\n')
+				continue
+			}
+			events = append(events, editorEvent{kind: editorLine, text: e.submit()})
+		case b == 3:
+			return nil, append(events, editorEvent{kind: editorQuit})
+		case b == 4 && len(e.text) == 0:
+			return nil, append(events, editorEvent{kind: editorQuit})
+		case b == 0x0c:
+			events = append(events, editorEvent{kind: editorRedraw})
+			data = data[1:]
+		case b < 0x20 || b == 0x7f:
+			e.control(b)
+			data = data[1:]
+		default:
+			if !utf8.FullRune(data) {
+				return data, events
+			}
+			r, size := utf8.DecodeRune(data)
+			e.insert(r)
+			data = data[size:]
+		}
+	}
+	return nil, events
+}
+
+// Function to find the escape sequence at the start of data: Esc [ ... final, Esc O x, or Esc and one key (Alt+key).
+// Returns the sequence without the Esc, its length and whether it's all there.
+func escapeSequence(data []byte) (string, int, bool) {
+	if len(data) < 2 {
+		return "", 0, false
+	}
+	switch data[1] {
+	case '[':
+		end := 2
+		for end < len(data) && (data[end] < 0x40 || data[end] > 0x7e) {
+			end++
+		}
+		if end == len(data) {
+			return "", 0, false
+		}
+		return string(data[1 : end+1]), end + 1, true
+	case 'O':
+		if len(data) < 3 {
+			return "", 0, false
+		}
+		return string(data[1:3]), 3, true
+	}
+	return string(data[1:2]), 2, true
+}
+
+// Function to handle an escape sequence; returns an event for keys the editor doesn't use
+func (e *lineEditor) escape(seq string) (editorEvent, bool) {
+	switch seq {
+	case "[200~":
+		e.pasting = true
+	case "[201~":
+		e.pasting = false
+	case "[C", "OC":
+		e.cursor = min(e.cursor+1, len(e.text))
+	case "[D", "OD":
+		e.cursor = max(e.cursor-1, 0)
+	case "[1;3C", "[1;5C", "f":
+		e.cursor = e.wordEnd()
+	case "[1;3D", "[1;5D", "b":
+		e.cursor = e.wordStart()
+	case "[H", "OH", "[1~", "[7~":
+		e.cursor = e.lineStart()
+	case "[F", "OF", "[4~", "[8~":
+		e.cursor = e.lineEnd()
+	case "[3~":
+		if e.cursor < len(e.text) {
+			e.delete(e.cursor, e.cursor+1)
+		}
+	case "[A", "OA":
+		e.up()
+	case "[B", "OB":
+		e.down()
+	case "\r", "\n":
+		// Alt+Enter starts a new line in the message
+		e.insert('\n')
+	case "\x7f", "\b":
+		e.delete(e.wordStart(), e.cursor)
+	case "d":
+		e.delete(e.cursor, e.wordEnd())
+	default:
+		return editorEvent{kind: editorKey, text: seq}, true
+	}
+	return editorEvent{}, false
+}
+
+// Function to handle a Ctrl key
+func (e *lineEditor) control(b byte) {
+	switch b {
+	case 0x7f, 0x08: // Backspace
+		if e.cursor > 0 {
+			e.delete(e.cursor-1, e.cursor)
+		}
+	case 0x04: // Ctrl+D
+		if e.cursor < len(e.text) {
+			e.delete(e.cursor, e.cursor+1)
+		}
+	case 0x01: // Ctrl+A
+		e.cursor = e.lineStart()
+	case 0x05: // Ctrl+E
+		e.cursor = e.lineEnd()
+	case 0x02: // Ctrl+B
+		e.cursor = max(e.cursor-1, 0)
+	case 0x06: // Ctrl+F
+		e.cursor = min(e.cursor+1, len(e.text))
+	case 0x17: // Ctrl+W
+		e.delete(e.wordStart(), e.cursor)
+	case 0x15: // Ctrl+U
+		e.delete(e.lineStart(), e.cursor)
+	case 0x0b: // Ctrl+K
+		e.delete(e.cursor, e.lineEnd())
+	case 0x10: // Ctrl+P
+		e.up()
+	case 0x0e: // Ctrl+N
+		e.down()
+	case 0x0a: // Ctrl+J
+		e.insert('\n')
+	case 0x09: // Tab
+		e.complete()
+	}
+}
+
+func (e *lineEditor) insert(r rune) {
+	e.text = append(e.text[:e.cursor], append([]rune{r}, e.text[e.cursor:]...)...)
+	e.cursor++
+}
+
+// Function to remove text[from:to] and put the cursor there
+func (e *lineEditor) delete(from, to int) {
+	e.text = append(e.text[:from], e.text[to:]...)
+	e.cursor = from
+}
+
+// Function to take what's typed, add it to the history and start over
+func (e *lineEditor) submit() string {
+	line := string(e.text)
+	e.history.add(line)
+	e.text, e.cursor, e.draft = nil, 0, nil
+	e.browsing = len(e.history.entries)
+	return line
+}
+
+// Function to find where the word before the cursor starts
+func (e *lineEditor) wordStart() int {
+	i := e.cursor
+	for i > 0 && unicode.IsSpace(e.text[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(e.text[i-1]) {
+		i--
+	}
+	return i
+}
+
+// Function to find where the word after the cursor ends
+func (e *lineEditor) wordEnd() int {
+	i := e.cursor
+	for i < len(e.text) && unicode.IsSpace(e.text[i]) {
+		i++
+	}
+	for i < len(e.text) && !unicode.IsSpace(e.text[i]) {
+		i++
+	}
+	return i
+}
+
+// Functions to find the start and end of the line the cursor is on, in a message of more than one line
+func (e *lineEditor) lineStart() int {
+	i := e.cursor
+	for i > 0 && e.text[i-1] != '\n' {
+		i--
+	}
+	return i
+}
+
+func (e *lineEditor) lineEnd() int {
+	i := e.cursor
+	for i < len(e.text) && e.text[i] != '\n' {
+		i++
+	}
+	return i
+}
+
+// Functions for Up and Down: they move between the lines of a message, and past its first or last line through the history
+func (e *lineEditor) up() {
+	if start := e.lineStart(); start > 0 {
+		column := e.cursor - start
+		e.cursor = e.lineStart()
+		e.cursor--
+		e.cursor = min(e.lineStart()+column, e.cursor)
+		return
+	}
+	if e.browsing == 0 {
+		return
+	}
+	if e.browsing == len(e.history.entries) {
+		e.draft = e.text
+	}
+	e.browsing--
+	e.text = []rune(e.history.entries[e.browsing])
+	e.cursor = len(e.text)
+}
+
+func (e *lineEditor) down() {
+	if end := e.lineEnd(); end < len(e.text) {
+		column := e.cursor - e.lineStart()
+		e.cursor = end + 1
+		e.cursor = min(e.cursor+column, e.lineEnd())
+		return
+	}
+	if e.browsing == len(e.history.entries) {
+		return
+	}
+	e.browsing++
+	if e.browsing == len(e.history.entries) {
+		e.text = e.draft
+	} else {
+		e.text = []rune(e.history.entries[e.browsing])
+	}
+	e.cursor = len(e.text)
+}
+
+// Function to complete the word before the cursor. With more than one option,
+// it completes as far as they agree and hints at the options.
+func (e *lineEditor) complete() {
+	start := e.cursor
+	for start > 0 && !unicode.IsSpace(e.text[start-1]) {
+		start--
+	}
+	word := string(e.text[start:e.cursor])
+	options := completions(string(e.text[:start]), word)
+	if len(options) == 0 {
+		return
+	}
+	completed := options[0]
+	for _, option := range options[1:] {
+		for !strings.HasPrefix(option, completed) {
+			completed = completed[:len(completed)-1]
+		}
+	}
+	if len(options) == 1 {
+		completed += " "
+	} else {
+		e.hint = strings.Join(options, " ")
+	}
+	e.delete(start, e.cursor)
+	for _, r := range completed {
+		e.insert(r)
+	}
+}
+
+// inputHistory is what the user typed before, oldest first, kept in a file between sessions
+type inputHistory struct {
+	path    string
+	entries []string
+}
+
+// Function to load the history in path; a missing file is an empty history.
+// Each entry is a quoted string on its own line, so messages of more than one line fit too.
+func loadHistory(path string) *inputHistory {
+	h := &inputHistory{path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if entry, err := strconv.Unquote(scanner.Text()); err == nil {
+			h.entries = append(h.entries, entry)
+		}
+	}
+	f.Close()
+
+	// Keep the file from growing forever
+	if len(h.entries) > historySize {
+		h.entries = h.entries[len(h.entries)-historySize:]
+		h.save()
+	}
+	return h
+}
+
+// Function to add a line to the history, unless it's empty or the same as the last one
+func (h *inputHistory) add(line string) {
+	if strings.TrimSpace(line) == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == line) {
+		return
+	}
+	h.entries = append(h.entries, line)
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		log.Printf("Cannot save input history: %v", err)
+		return
+	}
+	defer f.Close()
+	f.WriteString(strconv.Quote(line) + "\n")
+}
+
+// Function to write the whole history to its file
+func (h *inputHistory) save() {
+	var b strings.Builder
+	for _, entry := range h.entries {
+		b.WriteString(strconv.Quote(entry) + "\n")
+	}
+	if err := os.WriteFile(h.path, []byte(b.String()), 0600); err != nil {
+		log.Printf("Cannot save input history: %v", err)
+	}
+}
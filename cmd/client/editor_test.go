@@ -0,0 +1,97 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Function to feed keys to a new editor with history, one read at a time, returning it and the lines it sent
+func typed(history *inputHistory, keys ...string) (*lineEditor, []string) {
+	e := newLineEditor(history)
+	var lines []string
+	var rest []byte
+	for _, key := range keys {
+		var events []editorEvent
+		rest, events = e.feed(append(rest, key...))
+		for _, event := range events {
+			if event.kind == editorLine {
+				lines = append(lines, event.text)
+			}
+		}
+	}
+	return e, lines
+}
+
+func TestLineEditing(t *testing.T) {
+	for _, tt := range []struct {
+		why    string
+		keys   []string
+		text   string
+		cursor int
+	}{
+		{why: "typing", keys: []string{"hello"}, text: "hello", cursor: 5},
+		{why: "Backspace", keys: []string{"hello", "\x7f"}, text: "hell", cursor: 4},
+		{why: "Left and insert", keys: []string{"helo", "\x1b[D", "l"}, text: "hello", cursor: 4},
+		{why: "Ctrl+A and Ctrl+E", keys: []string{"ello", "\x01", "h", "\x05", "!"}, text: "hello!", cursor: 6},
+		{why: "Ctrl+W", keys: []string{"hello big world", "\x17"}, text: "hello big ", cursor: 10},
+		{why: "Ctrl+U", keys: []string{"hello world", "\x1b[D", "\x15"}, text: "d", cursor: 0},
+		{why: "Ctrl+K", keys: []string{"hello world", "\x01", "\x1b[1;5C", "\x0b"}, text: "hello", cursor: 5},
+		{why: "Alt+B and Alt+D", keys: []string{"hello big world", "\x1bb", "\x1bb", "\x1bd"}, text: "hello  world", cursor: 6},
+		{why: "Delete", keys: []string{"hello", "\x01", "\x1b[3~"}, text: "ello", cursor: 0},
+		{why: "a key split over two reads", keys: []string{"ab\x1b[", "D", "c"}, text: "acb", cursor: 2},
+		{why: "UTF-8 split over two reads", keys: []string{"\xc3", "\xb8"}, text: "ø", cursor: 1},
+		{why: "Alt+Enter", keys: []string{"one", "\x1b\r", "two"}, text: "one\ntwo", cursor: 7},
+		{why: "a bracketed paste", keys: []string{"\x1b[200~one\rtwo\x1b[201~"}, text: "one\ntwo", cursor: 7},
+		{why: "Up between lines", keys: []string{"one\x1b\rtwo", "\x1b[A"}, text: "one\ntwo", cursor: 3},
+		{why: "Tab completing a command", keys: []string{"/edi", "\t"}, text: "/edit ", cursor: 6},
+		{why: "Tab completing as far as it can", keys: []string{"/re", "\t"}, text: "/re", cursor: 3},
+	} {
+		e, lines := typed(&inputHistory{path: filepath.Join(t.TempDir(), "history")}, tt.keys...)
+		if len(lines) > 0 {
+			t.Errorf("%v: sent %q", tt.why, lines)
+		}
+		if string(e.text) != tt.text || e.cursor != tt.cursor {
+			t.Errorf("%v: text is %q with the cursor at %v, want %q at %v", tt.why, string(e.text), e.cursor, tt.text, tt.cursor)
+		}
+	}
+}
+
+func TestEnterSendsAndPastedLinesDont(t *testing.T) {
+	history := &inputHistory{path: filepath.Join(t.TempDir(), "history")}
+	_, lines := typed(history, "first\r", "pasted\rtogether\r")
+	if want := []string{"first", "pasted\ntogether"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("sent %q, want %q", lines, want)
+	}
+}
+
+func TestInputHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	history := loadHistory(path)
+	_, lines := typed(history, "one\r", "one\r", "  \r", "two\x1b\rlines\r")
+	if len(lines) != 4 {
+		t.Fatalf("sent %q", lines)
+	}
+	if want := []string{"one", "two\nlines"}; !reflect.DeepEqual(history.entries, want) {
+		t.Errorf("history is %q, want %q, without repeats or blank lines", history.entries, want)
+	}
+
+	// Up goes back through the history, and Down comes back to what was being typed
+	e, _ := typed(history, "draft", "\x1b[A")
+	if string(e.text) != "two\nlines" {
+		t.Errorf("Up shows %q, want the last entry", string(e.text))
+	}
+	e.feed([]byte("\x1b[A\x1b[A"))
+	if string(e.text) != "one" {
+		t.Errorf("Up past the lines of an entry shows %q, want the entry before", string(e.text))
+	}
+	e.feed([]byte("\x1b[B\x1b[B\x1b[B"))
+	if string(e.text) != "draft" {
+		t.Errorf("Down at the end shows %q, want what was being typed", string(e.text))
+	}
+
+	// The history is there again in the next session, lines and all
+	if again := loadHistory(path); !reflect.DeepEqual(again.entries, history.entries) {
+		t.Errorf("loaded history is %q, want %q", again.entries, history.entries)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	pb "ChittyChat/proto"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/inancgumus/screen"
+	"golang.org/x/term"
+)
+
+// editingUI is the line by line interface in a terminal: messages scroll by like in lineUI,
+// with what's being typed kept below them and edited with the keys of lineEditor.
+type editingUI struct {
+	mu       sync.Mutex
+	in, out  *os.File
+	oldState *term.State
+	closed   bool
+
+	editor    *lineEditor
+	status    string
+	cursorRow int // how many rows below the top of the input the cursor is
+}
+
+// Function to switch the terminal to reading keys one by one
+func newEditingUI(history *inputHistory) (*editingUI, error) {
+	e := &editingUI{in: os.Stdin, out: os.Stdout, editor: newLineEditor(history)}
+	state, err := term.MakeRaw(int(e.in.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read keys from the terminal: %v", err)
+	}
+	e.oldState = state
+	e.out.WriteString("\x1b[?2004h")
+	e.redraw()
+	return e, nil
+}
+
+func (e *editingUI) Printf(format string, a ...interface{}) { e.write(fmt.Sprintf(format, a...)) }
+func (e *editingUI) Print(a ...interface{})                 { e.write(fmt.Sprint(a...)) }
+func (e *editingUI) Println(a ...interface{})               { e.write(fmt.Sprintln(a...)) }
+
+// What's typed is cleared when it's entered, so there's nothing to clear when it comes back, nor an ack to show
+func (e *editingUI) ClearTyped()                            {}
+func (e *editingUI) Sent(ack *pb.MessageAck)                {}
+func (e *editingUI) SetChannels(channels []*pb.ChannelInfo) {}
+
+func (e *editingUI) Status(text string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.status = text
+	e.drawInput()
+}
+
+// The last status stays on screen, like in lineUI
+func (e *editingUI) EndStatus() {
+	e.mu.Lock()
+	status := e.status
+	e.status = ""
+	e.mu.Unlock()
+	e.write(status + "\n")
+}
+
+func (e *editingUI) Bell() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.closed {
+		e.out.WriteString("\a")
+	}
+}
+
+func (e *editingUI) Clear() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	screen.Clear()
+	screen.MoveTopLeft()
+	e.cursorRow = 0
+	e.drawInput()
+}
+
+func (e *editingUI) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	e.clearInput()
+	e.closed = true
+	e.out.WriteString("\x1b[?2004l")
+	term.Restore(int(e.in.Fd()), e.oldState)
+}
+
+// Function to print text above what's being typed
+func (e *editingUI) write(text string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		fmt.Print(text)
+		return
+	}
+	e.clearInput()
+	// The terminal doesn't turn \n into \r\n while it's reading keys one by one
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n")
+	if !strings.HasSuffix(text, "\n") {
+		text += "\r\n"
+	}
+	e.out.WriteString(text)
+	e.drawInput()
+}
+
+// Run reads keys and passes on each line the user enters, until they quit
+func (e *editingUI) Run(onLine func(line string)) {
+	buf := make([]byte, 4096)
+	var pending []byte
+	for {
+		n, err := e.in.Read(buf)
+		if err != nil {
+			return
+		}
+		pending = append(pending, buf[:n]...)
+
+		e.mu.Lock()
+		var events []editorEvent
+		pending, events = e.editor.feed(pending)
+		var typed []string
+		quit := false
+		for _, event := range events {
+			switch event.kind {
+			case editorLine:
+				typed = append(typed, event.text)
+			case editorQuit:
+				quit = true
+			case editorRedraw:
+				screen.Clear()
+				screen.MoveTopLeft()
+				e.cursorRow = 0
+			}
+		}
+		e.drawInput()
+		e.mu.Unlock()
+
+		for _, line := range typed {
+			onLine(line)
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+func (e *editingUI) redraw() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.drawInput()
+}
+
+// Function to remove the status and what's being typed from the screen; the lock must be held
+func (e *editingUI) clearInput() {
+	if e.cursorRow > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dA", e.cursorRow)
+	}
+	e.out.WriteString("\r\x1b[J")
+	e.cursorRow = 0
+}
+
+// Function to draw the status, Tab's hint and what's being typed, with the cursor where it belongs; the lock must be held
+func (e *editingUI) drawInput() {
+	if e.closed {
+		return
+	}
+	width, _, err := term.GetSize(int(e.out.Fd()))
+	if err != nil || width < 1 {
+		width = 80
+	}
+	// How many rows a line takes up once the terminal has wrapped it
+	rowsOf := func(line string) int {
+		return max(visibleWidth(line)-1, 0)/width + 1
+	}
+
+	var lines []string
+	if e.status != "" {
+		lines = append(lines, e.status)
+	}
+	if e.editor.hint != "" {
+		lines = append(lines, styled.Dim(e.editor.hint))
+	}
+	above := len(lines)
+	for i, line := range strings.Split(string(e.editor.text), "\n") {
+		if i == 0 {
+			lines = append(lines, "> "+line)
+		} else {
+			lines = append(lines, "  "+line)
+		}
+	}
+
+	// Where the cursor goes, counting rows from the top of what's drawn
+	row, column := cursorPosition(e.editor.text, e.editor.cursor)
+	cursorRow := 0
+	for _, line := range lines[:above+row] {
+		cursorRow += rowsOf(line)
+	}
+	offset := 2 + visibleWidth(string([]rune(strings.Split(string(e.editor.text), "\n")[row])[:column]))
+	cursorRow += offset / width
+	cursorColumn := offset % width
+
+	lastRow := -1
+	for _, line := range lines {
+		lastRow += rowsOf(line)
+	}
+
+	e.clearInput()
+	var out strings.Builder
+	out.WriteString(strings.Join(lines, "\x1b[0m\r\n") + "\x1b[0m")
+	// A cursor right after a full row goes at the start of the next one
+	if cursorRow > lastRow {
+		out.WriteString("\r\n")
+		lastRow = cursorRow
+	}
+	if up := lastRow - cursorRow; up > 0 {
+		fmt.Fprintf(&out, "\x1b[%dA", up)
+	}
+	out.WriteString("\r")
+	if cursorColumn > 0 {
+		fmt.Fprintf(&out, "\x1b[%dC", cursorColumn)
+	}
+	e.out.WriteString(out.String())
+	e.cursorRow = cursorRow
+}
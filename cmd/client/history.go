@@ -0,0 +1,115 @@
+package main
+
+import (
+	pb "ChittyChat/proto"
+	"ChittyChat/render"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Messages received in this session, by id, so replies can quote what they reply to
+var seenMessages = make(map[string]*pb.Message)
+var seenMu sync.Mutex
+
+// The ids in seenMessages, in the order they first came in
+var seenOrder []string
+
+// Function to remember a received message, or apply an edit or delete to the one we have
+func rememberMessage(msg *pb.Message) {
+	if msg.GetId() == "" {
+		return
+	}
+	seenMu.Lock()
+	defer seenMu.Unlock()
+	if _, ok := seenMessages[msg.GetId()]; !ok {
+		seenOrder = append(seenOrder, msg.GetId())
+	}
+	seenMessages[msg.GetId()] = msg
+}
+
+// Function to forget the messages of channel
+func forgetChannel(channel string) {
+	seenMu.Lock()
+	defer seenMu.Unlock()
+	kept := seenOrder[:0]
+	for _, id := range seenOrder {
+		if seenMessages[id].GetChannel().GetName() == channel {
+			delete(seenMessages, id)
+		} else {
+			kept = append(kept, id)
+		}
+	}
+	seenOrder = kept
+}
+
+// Function to get a message received earlier; nil if we haven't seen it
+func recallMessage(id string) *pb.Message {
+	seenMu.Lock()
+	defer seenMu.Unlock()
+	return seenMessages[id]
+}
+
+// Function to check whether an ephemeral message has expired; it's hidden then, even before the server deletes it
+func expired(msg *pb.Message) bool {
+	return msg.GetExpiresAt() > 0 && time.Now().Unix() >= msg.GetExpiresAt()
+}
+
+// Function to get the last n messages received in channel, oldest first; all channels if it's empty.
+// Deleted and expired messages are left out.
+func recentMessages(channel string, n int) []*pb.Message {
+	seenMu.Lock()
+	defer seenMu.Unlock()
+	var recent []*pb.Message
+	for i := len(seenOrder) - 1; i >= 0 && len(recent) < n; i-- {
+		msg := seenMessages[seenOrder[i]]
+		if msg.GetEvent() == pb.Event_DELETED || expired(msg) || (channel != "" && msg.GetChannel().GetName() != channel) {
+			continue
+		}
+		recent = append([]*pb.Message{msg}, recent...)
+	}
+	return recent
+}
+
+// Function to print the last messages of this channel; count is how many, 20 if it's empty
+func showHistory(count string) {
+	n := 20
+	if count != "" {
+		var err error
+		if n, err = strconv.Atoi(count); err != nil || n < 1 {
+			display.Printf("\n[Invalid count %q.]\n\n", count)
+			return
+		}
+	}
+	recent := recentMessages(currentChannel(), n)
+	if len(recent) == 0 {
+		display.Printf("\n[No messages yet.]\n\n")
+		return
+	}
+	display.Printf("\n ━━━━━⊱⊱ Last %v messages in %v ⊰⊰━━━━━\n", len(recent), currentChannel())
+	for _, msg := range recent {
+		display.Printf("  %v\n", formatSearchLine(msg))
+	}
+	display.Println()
+}
+
+// Function to format the quote shown above a reply, styled by r
+func formatQuote(replyTo string, r *render.Renderer) string {
+	parent := recallMessage(replyTo)
+	if parent == nil {
+		return "  ┃ reply to #" + replyTo + "\n"
+	}
+	if parent.GetEvent() == pb.Event_DELETED {
+		return "  ┃ reply to deleted message #" + replyTo + "\n"
+	}
+	return "  ┃ [" + r.Sender(parent.GetSender()) + "]: " + r.Message(shorten(parent.GetMessage(), 40)) + "\n"
+}
+
+// Function to cut text down to max characters
+func shorten(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	return string([]rune(text)[:max-1]) + "…"
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	pb "ChittyChat/proto"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os/exec"
+
+	"google.golang.org/grpc/status"
+)
+
+var notifyCommand = flag.String("notify", "", "Command run when you're @mentioned, with a title and the message as arguments, e.g. notify-send")
+
+// Function to check whether a message from someone else @mentions us
+func mentionsMe(msg *pb.Message) bool {
+	me := currentUser()
+	if msg.GetSender() == me || msg.GetEvent() != pb.Event_MESSAGE {
+		return false
+	}
+	for _, user := range msg.GetMentions() {
+		if user == me {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to ring the terminal bell, and run the -notify command if there is one
+func notifyMention(msg *pb.Message) {
+	display.Bell()
+	if *notifyCommand == "" {
+		return
+	}
+	go func() {
+		title := fmt.Sprintf("%v mentioned you in %v", msg.GetSender(), msg.GetChannel().GetName())
+		if err := exec.Command(*notifyCommand, title, msg.GetMessage()).Run(); err != nil {
+			log.Printf("Notify command failed - Error: %v", err)
+		}
+	}()
+}
+
+// Function to print the mentions of us; with unreadOnly, only those we haven't seen, e.g. while away
+func showMentions(ctx context.Context, client pb.ChatServiceClient, unreadOnly bool) {
+	mentions, err := client.ListMentions(ctx, &pb.MentionsRequest{User: currentUser(), UnreadOnly: unreadOnly, MarkRead: true})
+	if err != nil {
+		log.Printf("Cannot list mentions - Error: %v", err)
+		display.Printf("\n[%v]\n\n", status.Convert(err).Message())
+		return
+	}
+
+	messages := mentions.GetMessages()
+	if len(messages) == 0 {
+		if !unreadOnly {
+			display.Printf("\n[Nobody has mentioned you yet.]\n\n")
+		}
+		return
+	}
+
+	if unreadOnly {
+		display.Printf("\n ━━━━━⊱⊱ %v new mentions while you were away ⊰⊰━━━━━\n", len(messages))
+	} else {
+		display.Printf("\n ━━━━━⊱⊱ Mentions ⊰⊰━━━━━\n")
+	}
+	for _, msg := range messages {
+		display.Printf("%v #%v [%v]: %v\n", msg.GetChannel().GetName(), msg.GetId(), styled.Sender(msg.GetSender()), styled.Message(msg.GetMessage()))
+	}
+	display.Println()
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	pb "ChittyChat/proto"
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var outboxFile = flag.String("outbox", "", "File messages wait in until the server has them (default <username>.outbox)")
+
+// outbox holds the messages waiting to be sent, in the order they were written. It's kept on disk,
+// so messages written while the server can't be reached are sent once it's back, also after a restart.
+// A message keeps the Lamport time it was written at, so it's placed right when it's sent later.
+// One goroutine (run) sends them, so they arrive in order.
+type outbox struct {
+	mu    sync.Mutex
+	path  string
+	queue []*pb.Message
+	wake  chan struct{}
+}
+
+// The outbox of this client
+var outgoing *outbox
+
+// Function to open the outbox in path, with the messages still waiting in it
+func openOutbox(path string) *outbox {
+	o := &outbox{path: path, wake: make(chan struct{}, 1)}
+	f, err := os.Open(path)
+	if err != nil {
+		return o
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		msg := &pb.Message{}
+		if err := protojson.Unmarshal(scanner.Bytes(), msg); err == nil {
+			o.queue = append(o.queue, msg)
+			// Messages from last time happened before anything we do now
+			clock.Advance(msg.GetTimestamp())
+		}
+	}
+	return o
+}
+
+// Function to add a message to the end of the outbox
+func (o *outbox) add(msg *pb.Message) {
+	o.mu.Lock()
+	o.queue = append(o.queue, msg)
+	o.save()
+	o.mu.Unlock()
+	o.retryNow()
+}
+
+// Function to have the outbox try sending right away, e.g. once the server is back
+func (o *outbox) retryNow() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Function to get the messages waiting, oldest first
+func (o *outbox) pending() []*pb.Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]*pb.Message(nil), o.queue...)
+}
+
+func (o *outbox) front() *pb.Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.queue) == 0 {
+		return nil
+	}
+	return o.queue[0]
+}
+
+// Function to take msg out, once it's sent or can't be; it may have been cleared out already
+func (o *outbox) pop(msg *pb.Message) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.queue) > 0 && o.queue[0] == msg {
+		o.queue = o.queue[1:]
+		o.save()
+	}
+}
+
+// Function to drop every waiting message; returns how many there were
+func (o *outbox) clear() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := len(o.queue)
+	o.queue = nil
+	o.save()
+	return n
+}
+
+// Function to write the outbox to its file; the lock must be held
+func (o *outbox) save() {
+	if len(o.queue) == 0 {
+		if err := os.Remove(o.path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Cannot empty the outbox: %v", err)
+		}
+		return
+	}
+	var lines []byte
+	for _, msg := range o.queue {
+		line, err := protojson.Marshal(msg)
+		if err != nil {
+			continue
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	tmp := o.path + ".tmp"
+	if err := os.WriteFile(tmp, lines, 0600); err != nil {
+		log.Printf("Cannot save the outbox: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		log.Printf("Cannot save the outbox: %v", err)
+	}
+}
+
+// Function to send the messages in the outbox, in order, for as long as ctx lasts.
+// While the server can't be reached, the messages are pending and it tries again, waiting longer each time.
+// A message the server refuses has failed and is dropped.
+func (o *outbox) run(ctx context.Context, client pb.ChatServiceClient) {
+	wait := time.Second
+	waiting := false
+	for {
+		msg := o.front()
+		if msg == nil {
+			select {
+			case <-o.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		err := deliver(ctx, msg)
+		switch {
+		case err == nil:
+			o.pop(msg)
+			if waiting {
+				display.Printf("\n[Sent: %v]\n\n", shorten(msg.GetMessage(), 40))
+			}
+			wait = time.Second
+			if len(o.pending()) == 0 {
+				waiting = false
+			}
+			continue
+		case refused(err):
+			// deliver has told the user why
+			o.pop(msg)
+			continue
+		case status.Code(err) != codes.Unavailable && status.Code(err) != codes.DeadlineExceeded:
+			o.pop(msg)
+			display.Printf("\n[Message not sent: %v]\n[%v]\n\n", shorten(msg.GetMessage(), 40), status.Convert(err).Message())
+			continue
+		}
+
+		if !waiting {
+			n := len(o.pending())
+			display.Printf("\n[Pending: can't reach the server. %v waiting, they'll be sent in order once it's back.]\n[/outbox shows them.]\n\n", n)
+			waiting = true
+		}
+		select {
+		case <-o.wake:
+		case <-time.After(wait):
+			wait = min(wait*2, 30*time.Second)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Function to list the messages waiting to be sent
+func showOutbox() {
+	pending := outgoing.pending()
+	if len(pending) == 0 {
+		display.Printf("\n[Nothing waiting to be sent.]\n\n")
+		return
+	}
+	display.Printf("\n ━━━━━⊱⊱ %v waiting to be sent ⊰⊰━━━━━\n", len(pending))
+	for i, msg := range pending {
+		display.Printf("  %v. %v %v [%v]: %v\n", i+1, msg.GetChannel().GetName(), styled.Dim(fmt.Sprintf("(pending, Lamport time %v)", msg.GetTimestamp())), styled.Sender(msg.GetSender()), styled.Message(msg.GetMessage()))
+	}
+	display.Printf("[/outbox clear drops them.]\n\n")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	chat "ChittyChat/client"
+	pb "ChittyChat/proto"
+	"ChittyChat/server"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func waiting(channel, text string, timestamp int32) *pb.Message {
+	return &pb.Message{Channel: &pb.Channel{Name: channel, SendersName: "Anon"}, Sender: "Anon", Message: text, Timestamp: timestamp}
+}
+
+func TestOutboxKeepsMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Anon.outbox")
+	o := openOutbox(path)
+	o.add(waiting("Eepy", "one", 7))
+	o.add(waiting("Eepy", "two", 8))
+
+	// Opened again, e.g. after a restart: the messages are there in order, and our clock is past their times
+	o = openOutbox(path)
+	pending := o.pending()
+	if texts(pending) != "one,two" || pending[1].GetTimestamp() != 8 {
+		t.Fatalf("reopened outbox has %v, want one and two as written", pending)
+	}
+	if clock.Now() < 8 {
+		t.Errorf("clock is at %v after opening the outbox, want at least 8", clock.Now())
+	}
+
+	// Only the message in front is taken out, and that stays so
+	o.pop(pending[1])
+	o.pop(pending[0])
+	if got := texts(openOutbox(path).pending()); got != "two" {
+		t.Errorf("outbox after sending one is %q, want two", got)
+	}
+
+	if n := o.clear(); n != 1 {
+		t.Errorf("clearing the outbox dropped %v messages, want 1", n)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("empty outbox still has a file: %v", err)
+	}
+}
+
+func TestOutboxSendsOnceServerIsBack(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	srv, err := server.New(server.WithListener(lis))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Stop)
+
+	// The server can't be reached until down is cleared
+	var down atomic.Bool
+	down.Store(true)
+	dialer := grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		if down.Load() {
+			return nil, errors.New("server down")
+		}
+		return lis.DialContext(ctx)
+	})
+	retry := grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoff.Config{BaseDelay: 10 * time.Millisecond, Multiplier: 1, MaxDelay: 10 * time.Millisecond}})
+	conn, err := grpc.Dial("bufnet", dialer, retry, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := pb.NewChatServiceClient(conn)
+	sender = chat.NewSender(client)
+
+	o := openOutbox(filepath.Join(t.TempDir(), "Anon.outbox"))
+	o.add(waiting("Eepy", "one", 40))
+	o.add(waiting("Eepy", "", 41))
+	o.add(waiting("Eepy", "two", 42))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.run(ctx, client)
+
+	time.Sleep(50 * time.Millisecond)
+	if got := texts(o.pending()); got != "one,,two" {
+		t.Fatalf("outbox while the server is down is %q, want all three waiting", got)
+	}
+
+	// Once it's back they're sent in order; the empty one is refused and dropped
+	down.Store(false)
+	for i := 0; len(o.pending()) > 0; i++ {
+		if i == 500 {
+			t.Fatalf("outbox still has %q", texts(o.pending()))
+		}
+		o.retryNow()
+		time.Sleep(10 * time.Millisecond)
+	}
+	history, err := client.GetHistory(context.Background(), &pb.HistoryRequest{Channel: &pb.Channel{Name: "Eepy", SendersName: "Anon"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := texts(history.GetMessages()); got != "one,two" {
+		t.Fatalf("server has %q, want one, two", got)
+	}
+	// They're placed after the time they were written at, not when they were sent
+	if first := history.GetMessages()[0]; first.GetTimestamp() <= 40 {
+		t.Errorf("one has Lamport time %v, want after 40", first.GetTimestamp())
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	pb "ChittyChat/proto"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Results shown per page, and messages shown around each result
+const searchPageSize = 5
+const searchContext = 1
+
+// The last search, so /more can get its next page
+var lastSearch *pb.SearchRequest
+var lastSearchMu sync.Mutex
+
+// Function to build a search from what was typed after /search.
+// Words like from:alice, in:Dev, after:2024-01-31, before:2024-02-01, since:<Lamport> and until:<Lamport>
+// narrow the search down; the rest is the query.
+func parseSearch(args string) (*pb.SearchRequest, error) {
+	req := &pb.SearchRequest{
+		Channel:  currentRef(),
+		PageSize: searchPageSize,
+		Context:  searchContext,
+	}
+
+	var query []string
+	for _, word := range strings.Fields(args) {
+		key, value, ok := strings.Cut(word, ":")
+		if !ok || value == "" {
+			query = append(query, word)
+			continue
+		}
+		var err error
+		switch key {
+		case "from":
+			req.Sender = value
+		case "in":
+			if value == "*" {
+				value = ""
+			}
+			req.Channel.Name = value
+		case "after":
+			req.FromUnixTime, err = parseDate(value, 0)
+		case "before":
+			req.ToUnixTime, err = parseDate(value, 24*time.Hour-time.Second)
+		case "since", "until":
+			var n int
+			n, err = strconv.Atoi(value)
+			if key == "since" {
+				req.FromTimestamp = int32(n)
+			} else {
+				req.ToTimestamp = int32(n)
+			}
+		default:
+			query = append(query, word)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Can't read %v", word)
+		}
+	}
+	req.Query = strings.Join(query, " ")
+	return req, nil
+}
+
+// Function to turn a date like 2024-01-31 into unix time, in local time, plus offset
+func parseDate(value string, offset time.Duration) (int64, error) {
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return 0, err
+	}
+	return day.Add(offset).Unix(), nil
+}
+
+// Function to run a search and print the first page of results
+func search(ctx context.Context, client pb.ChatServiceClient, args string) {
+	req, err := parseSearch(args)
+	if err != nil {
+		display.Printf("\n[%v]\n[Usage: /search [from:<user>] [in:<channel>|in:*] [after:<date>] [before:<date>] [since:<Lamport>] [until:<Lamport>] words \"a phrase\"]\n\n", err)
+		return
+	}
+	showSearchPage(ctx, client, req)
+}
+
+// Function to print the next page of the last search
+func searchMore(ctx context.Context, client pb.ChatServiceClient) {
+	lastSearchMu.Lock()
+	req := lastSearch
+	lastSearchMu.Unlock()
+	if req == nil || req.GetPageToken() == "" {
+		display.Printf("\n[No more results.]\n\n")
+		return
+	}
+	showSearchPage(ctx, client, req)
+}
+
+func showSearchPage(ctx context.Context, client pb.ChatServiceClient, req *pb.SearchRequest) {
+	results, err := client.Search(ctx, req)
+	if err != nil {
+		log.Printf("Cannot search - Error: %v", err)
+		display.Printf("\n[%v]\n\n", status.Convert(err).Message())
+		return
+	}
+
+	// Remember where this page ended, for /more
+	next := proto.Clone(req).(*pb.SearchRequest)
+	next.PageToken = results.GetNextPageToken()
+	lastSearchMu.Lock()
+	lastSearch = next
+	lastSearchMu.Unlock()
+
+	if results.GetTotal() == 0 {
+		display.Printf("\n[Nothing found.]\n\n")
+		return
+	}
+
+	first, _ := strconv.Atoi(req.GetPageToken())
+	display.Printf("\n ━━━━━⊱⊱ Results %v-%v of %v ⊰⊰━━━━━\n", first+1, first+len(results.GetHits()), results.GetTotal())
+	for _, hit := range results.GetHits() {
+		for _, msg := range hit.GetBefore() {
+			display.Printf("  ┊ %v\n", formatSearchLine(msg))
+		}
+		display.Printf("  ▶ %v\n", formatSearchLine(hit.GetMessage()))
+		for _, msg := range hit.GetAfter() {
+			display.Printf("  ┊ %v\n", formatSearchLine(msg))
+		}
+		display.Println()
+	}
+	if results.GetNextPageToken() != "" {
+		display.Printf("[Type /more for the next page.]\n\n")
+	}
+}
+
+// Function to format a message found by a search on a single line
+func formatSearchLine(msg *pb.Message) string {
+	sent := time.Unix(msg.GetUnixTime(), 0).Format("Jan 2 15:04")
+	return fmt.Sprintf("%v #%v %v [%v]: %v", msg.GetChannel().GetName(), msg.GetId(), styled.Dim(fmt.Sprintf("(Lamport time %v, %v)", msg.GetTimestamp(), sent)), styled.Sender(msg.GetSender()), styled.Message(msg.GetMessage()))
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	pb "ChittyChat/proto"
+	"ChittyChat/render"
+	"bufio"
+	"flag"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var storeDir = flag.String("store", "", "Folder the messages you receive are kept in, to show them again next time (default <username>.messages)")
+
+// messageStore keeps the messages received in a channel on disk, a JSON message a line,
+// so they're there when the client starts again, also without a server.
+// A changed message is written again; the last line with an id wins.
+type messageStore struct {
+	mu       sync.Mutex
+	channel  string
+	file     *os.File
+	revision int64 // the latest revision seen, to catch up from
+}
+
+// The store of the channel we're in
+var store *messageStore
+var storeMu sync.Mutex
+
+// Function to open the store of channel, returning the messages in it, oldest first
+func openStore(dir, channel string) (*messageStore, []*pb.Message, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, err
+	}
+	path := filepath.Join(dir, url.PathEscape(channel)+".jsonl")
+
+	s := &messageStore{channel: channel}
+	var messages []*pb.Message
+	at := make(map[string]int)
+	lines := 0
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			lines++
+			msg := &pb.Message{}
+			if err := protojson.Unmarshal(scanner.Bytes(), msg); err != nil || msg.GetId() == "" {
+				continue
+			}
+			if i, ok := at[msg.GetId()]; ok {
+				messages[i] = msg
+			} else {
+				at[msg.GetId()] = len(messages)
+				messages = append(messages, msg)
+			}
+			s.revision = max(s.revision, msg.GetRevision())
+		}
+		f.Close()
+	}
+
+	// Write the file again without the old versions once they take up more than half of it
+	if lines > 2*len(messages) {
+		if err := rewriteStore(path, messages); err != nil {
+			log.Printf("Cannot compact %v: %v", path, err)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.file = f
+	return s, messages, nil
+}
+
+// Function to write messages to path, replacing what's there
+func rewriteStore(path string, messages []*pb.Message) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, msg := range messages {
+		line, err := protojson.Marshal(msg)
+		if err != nil {
+			continue
+		}
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Function to keep a message; messages without an id (like join notices) aren't kept
+func (s *messageStore) save(msg *pb.Message) {
+	if msg.GetId() == "" {
+		return
+	}
+	line, err := protojson.Marshal(msg)
+	if err != nil {
+		log.Printf("Cannot store message #%v: %v", msg.GetId(), err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revision = max(s.revision, msg.GetRevision())
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		log.Printf("Cannot store message #%v: %v", msg.GetId(), err)
+	}
+}
+
+// Function to get the latest revision kept
+func (s *messageStore) latest() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.revision
+}
+
+// Function to empty the store
+func (s *messageStore) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.file.Truncate(0); err != nil {
+		log.Printf("Cannot empty the message store: %v", err)
+	}
+	s.revision = 0
+}
+
+func (s *messageStore) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.file.Close()
+}
+
+// Function to switch to the store of channel, unless we're in it already, and show the last messages kept in it
+func useStore(channel string) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if store != nil && store.channel == channel {
+		return
+	}
+	if store != nil {
+		store.close()
+		store = nil
+	}
+
+	s, messages, err := openStore(*storeDir, channel)
+	if err != nil {
+		log.Printf("Cannot open the message store: %v", err)
+		display.Printf("\n[Cannot keep messages for next time: %v]\n\n", err)
+		return
+	}
+	store = s
+
+	for _, msg := range messages {
+		rememberMessage(msg)
+	}
+	recent := recentMessages(channel, 10)
+	if len(recent) == 0 {
+		return
+	}
+	display.Printf("\n ━━━━━⊱⊱ Last time in %v ⊰⊰━━━━━\n", channel)
+	for _, msg := range recent {
+		display.Printf("  %v\n", formatSearchLine(msg))
+	}
+	display.Printf("[/history shows more.]\n\n")
+}
+
+// Function to keep a received message in the store of the channel we're in
+func storeMessage(msg *pb.Message) {
+	storeMu.Lock()
+	s := store
+	storeMu.Unlock()
+	if s != nil && s.channel == msg.GetChannel().GetName() {
+		s.save(msg)
+	}
+}
+
+// Function to start over in channel, forgetting what we kept: the server doesn't have those messages anymore
+func resetStore(channel string) {
+	storeMu.Lock()
+	s := store
+	storeMu.Unlock()
+	if s != nil && s.channel == channel {
+		s.reset()
+	}
+	forgetChannel(channel)
+}
+
+// Function to get the revision to catch up on channel from
+func storedRevision(channel string) int64 {
+	storeMu.Lock()
+	s := store
+	storeMu.Unlock()
+	if s == nil || s.channel != channel {
+		return 0
+	}
+	return s.latest()
+}
+
+// Function to format a message we missed, for catching up. One we've never seen is shown as it is now,
+// whatever happened to it since; for one we have, known, what changed is shown: its text, or its reactions.
+func formatCatchUp(msg, known *pb.Message, r *render.Renderer) string {
+	shown := proto.Clone(msg).(*pb.Message)
+	switch {
+	case known == nil:
+		shown.Event = pb.Event_MESSAGE
+	case msg.GetEvent() == pb.Event_DELETED:
+	case msg.GetMessage() != known.GetMessage():
+		shown.Event = pb.Event_EDITED
+	default:
+		shown.Event = pb.Event_REACTED
+	}
+	return formatClientMessage(shown, r)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	pb "ChittyChat/proto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Function to get the texts of messages, in order
+func texts(messages []*pb.Message) string {
+	var texts []string
+	for _, msg := range messages {
+		texts = append(texts, msg.GetMessage())
+	}
+	return strings.Join(texts, ",")
+}
+
+func TestStoreKeepsMessages(t *testing.T) {
+	dir := t.TempDir()
+	s, messages, err := openStore(dir, "Eepy/Dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 0 || s.latest() != 0 {
+		t.Fatalf("a new store has %v messages at revision %v, want none", len(messages), s.latest())
+	}
+	s.save(&pb.Message{Id: "1", Message: "one", Revision: 1})
+	s.save(&pb.Message{Id: "2", Message: "two", Revision: 2})
+	s.save(&pb.Message{Message: "Anon joined", Revision: 3})
+	s.save(&pb.Message{Id: "1", Message: "one!", Revision: 4})
+	if s.latest() != 4 {
+		t.Errorf("latest revision is %v, want 4", s.latest())
+	}
+	s.close()
+
+	// Opened again, a changed message is where it first was, with its last text, and notices without an id aren't there
+	s, messages, err = openStore(dir, "Eepy/Dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if texts(messages) != "one!,two" || s.latest() != 4 {
+		t.Errorf("reopened store has %q at revision %v, want one!, two at 4", texts(messages), s.latest())
+	}
+
+	// Emptied when the server has forgotten the channel
+	s.reset()
+	if s.latest() != 0 {
+		t.Errorf("latest revision after a reset is %v, want 0", s.latest())
+	}
+	s.close()
+	if _, messages, _ := openStore(dir, "Eepy/Dev"); len(messages) != 0 {
+		t.Errorf("store after a reset has %q, want nothing", texts(messages))
+	}
+}
+
+func TestStoreIsCompacted(t *testing.T) {
+	dir := t.TempDir()
+	s, _, err := openStore(dir, "Eepy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for revision := int64(1); revision <= 5; revision++ {
+		s.save(&pb.Message{Id: "1", Message: strings.Repeat("!", int(revision)), Revision: revision})
+	}
+	s.save(&pb.Message{Id: "2", Message: "two", Revision: 6})
+	s.close()
+
+	// Old versions take up more than half of the file, so opening it writes it again with one line a message
+	s, messages, err := openStore(dir, "Eepy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.close()
+	if texts(messages) != "!!!!!,two" {
+		t.Errorf("store has %q, want !!!!!, two", texts(messages))
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "Eepy.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("compacted store has %v lines, want 2", lines)
+	}
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	pb "ChittyChat/proto"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// How many lines the message pane keeps for scrolling back
+const scrollback = 2000
+
+// Widths of the channel sidebar and the member list, including their borders
+const (
+	sidebarWidth = 20
+	membersWidth = 20
+)
+
+// tuiUI is the full-screen interface: a status bar on top, the channels on the left,
+// who's in this channel on the right, messages in the middle and the input line at the bottom.
+// It only needs a terminal that understands the usual ANSI escape sequences.
+type tuiUI struct {
+	mu       sync.Mutex
+	in, out  *os.File
+	oldState *term.State
+	closed   bool
+
+	width, height int
+
+	lines    []string // the message pane, a line each; may contain styling
+	partial  string   // text printed without a newline yet
+	scroll   int      // how many rows the message pane is scrolled back
+	status   string
+	channels []*pb.ChannelInfo
+
+	editor *lineEditor
+}
+
+// Function to switch the terminal to the full-screen interface
+func newTUI(history *inputHistory) (*tuiUI, error) {
+	t := &tuiUI{in: os.Stdin, out: os.Stdout, editor: newLineEditor(history)}
+	state, err := term.MakeRaw(int(t.in.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("cannot start the full-screen interface: %v", err)
+	}
+	t.oldState = state
+	// The alternate screen gives the terminal's contents back when we're done.
+	// Bracketed paste tells pasted text apart from typed text.
+	t.out.WriteString("\x1b[?1049h\x1b[?2004h")
+	t.width, t.height = t.size()
+	t.redraw()
+	go t.watchSize()
+	return t, nil
+}
+
+func (t *tuiUI) Printf(format string, a ...interface{}) { t.write(fmt.Sprintf(format, a...)) }
+func (t *tuiUI) Print(a ...interface{})                 { t.write(fmt.Sprint(a...)) }
+func (t *tuiUI) Println(a ...interface{})               { t.write(fmt.Sprintln(a...)) }
+
+// The typed line is never echoed into the message pane, so there's nothing to clear
+func (t *tuiUI) ClearTyped() {}
+
+func (t *tuiUI) Clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lines, t.partial, t.scroll = nil, "", 0
+	t.draw()
+}
+
+func (t *tuiUI) Bell() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.out.WriteString("\a")
+	}
+}
+
+func (t *tuiUI) Status(text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status = text
+	t.draw()
+}
+
+func (t *tuiUI) EndStatus() { t.Status("") }
+
+func (t *tuiUI) Sent(ack *pb.MessageAck) { t.Status(ack.GetStatus()) }
+
+func (t *tuiUI) SetChannels(channels []*pb.ChannelInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channels = channels
+	t.draw()
+}
+
+func (t *tuiUI) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	t.closed = true
+	t.out.WriteString("\x1b[?2004l\x1b[?25h\x1b[?1049l")
+	term.Restore(int(t.in.Fd()), t.oldState)
+}
+
+// Function to add text to the message pane
+func (t *tuiUI) write(text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	text = strings.ReplaceAll(t.partial+text, "\t", "    ")
+	text = strings.ReplaceAll(text, "\r", "")
+	parts := strings.Split(text, "\n")
+	added := parts[:len(parts)-1]
+	t.partial = parts[len(parts)-1]
+	t.lines = append(t.lines, added...)
+	if len(t.lines) > scrollback {
+		t.lines = t.lines[len(t.lines)-scrollback:]
+	}
+
+	// Stay on what the user scrolled back to, rather than jumping along with new messages
+	if t.scroll > 0 {
+		for _, line := range added {
+			t.scroll += len(wrapANSI(line, t.paneWidth()))
+		}
+	}
+	t.draw()
+}
+
+// Run reads keys and passes on each line the user enters, until they quit
+func (t *tuiUI) Run(onLine func(line string)) {
+	buf := make([]byte, 4096)
+	var pending []byte
+	for {
+		n, err := t.in.Read(buf)
+		if err != nil {
+			return
+		}
+		pending = append(pending, buf[:n]...)
+
+		t.mu.Lock()
+		var events []editorEvent
+		pending, events = t.editor.feed(pending)
+		var typed []string
+		quit := false
+		for _, event := range events {
+			switch event.kind {
+			case editorLine:
+				typed = append(typed, event.text)
+				t.scroll = 0
+			case editorQuit:
+				quit = true
+			case editorRedraw:
+				t.out.WriteString("\x1b[2J")
+			case editorKey:
+				t.scrollKey(event.text)
+			}
+		}
+		t.draw()
+		t.mu.Unlock()
+
+		// Commands print to the screen themselves, so they run without the lock
+		for _, line := range typed {
+			onLine(line)
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+// Function to scroll the message pane: PgUp and PgDn a page, Shift+Up and Shift+Down a line
+func (t *tuiUI) scrollKey(seq string) {
+	page := max(t.height-4, 1)
+	switch seq {
+	case "[1;2A":
+		t.scroll++
+	case "[1;2B":
+		t.scroll--
+	case "[5~":
+		t.scroll += page
+	case "[6~":
+		t.scroll -= page
+	}
+	t.scroll = max(t.scroll, 0)
+}
+
+// Function to get the terminal's size, or the classic 80x24 if it can't tell
+func (t *tuiUI) size() (int, int) {
+	width, height, err := term.GetSize(int(t.out.Fd()))
+	if err != nil || width < 1 || height < 1 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// Function to redraw the screen when the terminal is resized
+func (t *tuiUI) watchSize() {
+	for range time.Tick(250 * time.Millisecond) {
+		t.mu.Lock()
+		if t.closed {
+			t.mu.Unlock()
+			return
+		}
+		if width, height := t.size(); width != t.width || height != t.height {
+			t.width, t.height = width, height
+			t.out.WriteString("\x1b[2J")
+			t.draw()
+		}
+		t.mu.Unlock()
+	}
+}
+
+func (t *tuiUI) redraw() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.draw()
+}
+
+// Functions to get how wide the sidebar and member list are; they're left out on narrow terminals
+func (t *tuiUI) sideWidth() int {
+	if t.width < 50 {
+		return 0
+	}
+	return sidebarWidth
+}
+
+func (t *tuiUI) memberWidth() int {
+	if t.width < 80 {
+		return 0
+	}
+	return membersWidth
+}
+
+func (t *tuiUI) paneWidth() int {
+	return t.width - t.sideWidth() - t.memberWidth()
+}
+
+// Function to draw the whole screen; the lock must be held
+func (t *tuiUI) draw() {
+	if t.closed {
+		return
+	}
+	width, height := t.width, t.height
+	var screen strings.Builder
+	// Hide the cursor while drawing, so it doesn't flicker around
+	screen.WriteString("\x1b[?25l")
+
+	bar := fmt.Sprintf(" ChittyChat ┊ #%v ┊ %v ┊ Lamport time %v", currentChannel(), currentUser(), clock.Now())
+	if t.scroll > 0 {
+		bar += " ┊ scrolled back, PgDn for newer"
+	}
+	if t.editor.hint != "" {
+		bar += " ┊ " + t.editor.hint
+	} else if t.status != "" {
+		bar += " ┊ " + t.status
+	}
+	screen.WriteString("\x1b[1;1H\x1b[7m" + pad(bar, width) + "\x1b[0m")
+
+	// A message of more than one line gets up to five rows to be typed in
+	lines := strings.Split(string(t.editor.text), "\n")
+	row, column := cursorPosition(t.editor.text, t.editor.cursor)
+	inputHeight := min(len(lines), 5, max(height-2, 1))
+	first := max(0, min(row-inputHeight+1, len(lines)-inputHeight))
+
+	paneHeight := height - 2 - inputHeight
+	if paneHeight > 0 {
+		t.drawPanes(&screen, paneHeight)
+		fmt.Fprintf(&screen, "\x1b[%d;1H\x1b[2m%v\x1b[0m", paneHeight+2, strings.Repeat("─", width))
+	}
+
+	room := max(width-3, 1)
+	cursorX := 3
+	for i := 0; i < inputHeight; i++ {
+		line := []rune(lines[first+i])
+		prompt := "  "
+		if first+i == 0 {
+			prompt = "> "
+		}
+		// Scroll the cursor's line sideways so the cursor stays in view
+		start := 0
+		if first+i == row {
+			for start < column && visibleWidth(string(line[start:column])) > room {
+				start++
+			}
+			cursorX = 3 + visibleWidth(string(line[start:column]))
+		}
+		fmt.Fprintf(&screen, "\x1b[%d;1H\x1b[2K%v%v", height-inputHeight+1+i, prompt, wrapANSI(string(line[start:]), room)[0])
+	}
+	fmt.Fprintf(&screen, "\x1b[%d;%dH\x1b[?25h", height-inputHeight+1+row-first, cursorX)
+
+	t.out.WriteString(screen.String())
+}
+
+// Function to find which line of text the cursor is on, and where in that line
+func cursorPosition(text []rune, cursor int) (int, int) {
+	row, column := 0, 0
+	for _, r := range text[:cursor] {
+		if r == '\n' {
+			row++
+			column = 0
+		} else {
+			column++
+		}
+	}
+	return row, column
+}
+
+// Function to draw the sidebar, the messages and the member list, paneHeight rows from the second row
+func (t *tuiUI) drawPanes(screen *strings.Builder, paneHeight int) {
+	sideWidth, memberWidth, paneWidth := t.sideWidth(), t.memberWidth(), t.paneWidth()
+
+	var rows []string
+	for _, line := range t.lines {
+		rows = append(rows, wrapANSI(line, paneWidth)...)
+	}
+	if t.partial != "" {
+		rows = append(rows, wrapANSI(t.partial, paneWidth)...)
+	}
+	if max := len(rows) - paneHeight; t.scroll > max {
+		t.scroll = max
+	}
+	if t.scroll < 0 {
+		t.scroll = 0
+	}
+	end := len(rows) - t.scroll
+	start := end - paneHeight
+	if start < 0 {
+		start = 0
+	}
+	rows = rows[start:end]
+	// The newest messages sit right above the input line
+	top := paneHeight - len(rows)
+
+	side, members := t.channelList(), t.memberList()
+	if memberWidth == 0 {
+		side = append(append(side, ""), members...)
+	}
+
+	for i := 0; i < paneHeight; i++ {
+		fmt.Fprintf(screen, "\x1b[%d;1H", i+2)
+		if sideWidth > 0 {
+			screen.WriteString(pad(" "+cell(side, i), sideWidth-1) + "\x1b[2m│\x1b[0m")
+		}
+		text := ""
+		if i >= top {
+			text = rows[i-top]
+		}
+		screen.WriteString(pad(text, paneWidth))
+		if memberWidth > 0 {
+			screen.WriteString("\x1b[2m│\x1b[0m" + pad(" "+cell(members, i), memberWidth-1))
+		}
+	}
+}
+
+// Function to list the channels for the sidebar, marking the one we're in
+func (t *tuiUI) channelList() []string {
+	list := []string{"\x1b[1mChannels\x1b[0m"}
+	for _, channel := range t.channels {
+		if channel.GetName() == currentChannel() {
+			list = append(list, fmt.Sprintf("\x1b[7m#%v\x1b[0m %v", channel.GetName(), len(channel.GetMembers())))
+		} else {
+			list = append(list, fmt.Sprintf("#%v %v", channel.GetName(), len(channel.GetMembers())))
+		}
+	}
+	return list
+}
+
+// Function to list who's in our channel
+func (t *tuiUI) memberList() []string {
+	list := []string{"\x1b[1mMembers\x1b[0m"}
+	for _, channel := range t.channels {
+		if channel.GetName() != currentChannel() {
+			continue
+		}
+		for _, member := range channel.GetMembers() {
+			list = append(list, styled.Sender(member))
+		}
+	}
+	return list
+}
+
+// Function to get row i of a column, or nothing if it's shorter
+func cell(column []string, i int) string {
+	if i < len(column) {
+		return column[i]
+	}
+	return ""
+}
+
+// Function to cut or fill text with spaces to exactly width columns, ending any styling
+func pad(text string, width int) string {
+	if width < 1 {
+		return ""
+	}
+	text = wrapANSI(text, width)[0]
+	return text + "\x1b[0m" + strings.Repeat(" ", width-visibleWidth(text))
+}
+
+// Function to split text into rows of at most width columns.
+// Styling carries over: a row that starts in the middle of bold text starts bold too.
+func wrapANSI(text string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+	var rows []string
+	var row strings.Builder
+	var active []string
+	used := 0
+	for i := 0; i < len(text); {
+		if text[i] == 0x1b {
+			end := escapeEnd(text, i)
+			seq := text[i:end]
+			row.WriteString(seq)
+			if seq == "\x1b[0m" || seq == "\x1b[m" {
+				active = active[:0]
+			} else if strings.HasSuffix(seq, "m") {
+				active = append(active, seq)
+			}
+			i = end
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		w := runeWidth(r)
+		if used+w > width && used > 0 {
+			rows = append(rows, row.String())
+			row.Reset()
+			row.WriteString(strings.Join(active, ""))
+			used = 0
+		}
+		row.WriteString(text[i : i+size])
+		used += w
+		i += size
+	}
+	return append(rows, row.String())
+}
+
+// Function to find where the escape sequence starting at text[i] ends
+func escapeEnd(text string, i int) int {
+	end := i + 1
+	if end < len(text) && text[end] == '[' {
+		end++
+		for end < len(text) && (text[end] < 0x40 || text[end] > 0x7e) {
+			end++
+		}
+		if end < len(text) {
+			end++
+		}
+	}
+	return end
+}
+
+// Function to get how many columns text takes up in the terminal, not counting styling
+func visibleWidth(text string) int {
+	width := 0
+	for i := 0; i < len(text); {
+		if text[i] == 0x1b {
+			i = escapeEnd(text, i)
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		width += runeWidth(r)
+		i += size
+	}
+	return width
+}
+
+// Function to guess how many columns a character takes up: none for accents and joiners,
+// two for CJK and emoji, one for everything else
+func runeWidth(r rune) int {
+	switch {
+	case r < 0x20, unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf), r >= 0xfe00 && r <= 0xfe0f:
+		return 0
+	case r >= 0x1100 && r <= 0x115f, r >= 0x2e80 && r <= 0xa4cf, r >= 0xac00 && r <= 0xd7a3,
+		r >= 0xf900 && r <= 0xfaff, r >= 0xfe30 && r <= 0xfe4f, r >= 0xff00 && r <= 0xff60,
+		r >= 0xffe0 && r <= 0xffe6, r >= 0x1f300 && r <= 0x1faff, r >= 0x20000 && r <= 0x3fffd:
+		return 2
+	}
+	return 1
+}
+
+// Function to keep the full-screen interface's channel and member lists up to date
+func pollChannels(ctx context.Context, client pb.ChatServiceClient) {
+	for {
+		list, err := client.ListChannels(ctx, currentRef())
+		if err != nil {
+			log.Printf("Cannot list channels - Error: %v", err)
+		} else {
+			knownChannelsMu.Lock()
+			knownChannels = list.GetChannels()
+			knownChannelsMu.Unlock()
+			display.SetChannels(list.GetChannels())
+		}
+		time.Sleep(3 * time.Second)
+	}
+}
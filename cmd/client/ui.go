@@ -0,0 +1,103 @@
+package main
+
+import (
+	pb "ChittyChat/proto"
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/inancgumus/screen"
+	"golang.org/x/term"
+)
+
+// chatUI is where the client shows things and reads what the user types.
+// lineUI prints to the terminal line by line, which also works when piping in and out;
+// tuiUI is a full-screen interface.
+type chatUI interface {
+	// Printf, Print and Println show text, like their fmt counterparts
+	Printf(format string, a ...interface{})
+	Print(a ...interface{})
+	Println(a ...interface{})
+	// Status shows something that changes in place, like upload progress; EndStatus is called when it's done
+	Status(text string)
+	EndStatus()
+	// Sent shows that the server got a message we sent
+	Sent(ack *pb.MessageAck)
+	// ClearTyped removes the line the user just typed, once it has been sent
+	ClearTyped()
+	// Clear empties the screen
+	Clear()
+	// Bell gets the user's attention
+	Bell()
+	// SetChannels updates the channels and their members, for interfaces that show them
+	SetChannels(channels []*pb.ChannelInfo)
+	// Run reads lines typed by the user and passes them to onLine, until the input ends or the user quits
+	Run(onLine func(line string))
+	// Close gives the terminal back the way it was
+	Close()
+}
+
+var uiMode = flag.String("ui", "auto", "User interface: tui (full-screen), line, or auto to use tui when in a terminal")
+var historyFile = flag.String("history-file", "", "File to keep what you type in between sessions (default <username>.history)")
+
+// Where the client shows things; line by line until main has picked the interface
+var display chatUI = &lineUI{}
+
+// Function to pick the user interface from the -ui flag
+func newDisplay(history *inputHistory) (chatUI, error) {
+	switch *uiMode {
+	case "line":
+		if term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())) {
+			return newEditingUI(history)
+		}
+		return &lineUI{}, nil
+	case "tui":
+		return newTUI(history)
+	case "auto":
+		if term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())) {
+			return newTUI(history)
+		}
+		return &lineUI{}, nil
+	}
+	return nil, fmt.Errorf("unknown -ui %q, use tui, line or auto", *uiMode)
+}
+
+// Function to leave the user interface, then log the error and quit
+func exitf(format string, a ...interface{}) {
+	display.Close()
+	log.Printf(format, a...)
+	if log.Writer() != os.Stderr {
+		fmt.Fprintf(os.Stderr, format+"\n", a...)
+	}
+	os.Exit(1)
+}
+
+// lineUI is the plain line by line interface: output goes straight to stdout, input is read a line at a time.
+// It's used when the input or output isn't a terminal; in a terminal, -ui line gets editingUI.
+type lineUI struct{}
+
+func (l *lineUI) Printf(format string, a ...interface{}) { fmt.Printf(format, a...) }
+func (l *lineUI) Print(a ...interface{})                 { fmt.Print(a...) }
+func (l *lineUI) Println(a ...interface{})               { fmt.Println(a...) }
+func (l *lineUI) Status(text string)                     { fmt.Print("\r" + text) }
+func (l *lineUI) EndStatus()                             { fmt.Println() }
+func (l *lineUI) ClearTyped()                            { clearPreviousConsoleLine() }
+func (l *lineUI) Clear()                                 { screen.Clear(); screen.MoveTopLeft() }
+func (l *lineUI) Bell()                                  { fmt.Print("\a") }
+func (l *lineUI) SetChannels(channels []*pb.ChannelInfo) {}
+func (l *lineUI) Close()                                 {}
+
+// The ack's line is cleared right away, so that sent messages are not printed twice for the client
+func (l *lineUI) Sent(ack *pb.MessageAck) {
+	fmt.Printf("Message  %v \n", ack)
+	clearPreviousConsoleLine()
+}
+
+func (l *lineUI) Run(onLine func(line string)) {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		onLine(scanner.Text())
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"ChittyChat/server"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+var userRate = flag.Float64("user-rate", 1, "Messages per second each user may send")
+var userBurst = flag.Float64("user-burst", 5, "Messages a user may send in a burst")
+var channelRate = flag.Float64("channel-rate", 10, "Messages per second allowed in each channel")
+var channelBurst = flag.Float64("channel-burst", 20, "Messages a channel may receive in a burst")
+var maxLength = flag.Int("max-length", 128, "Maximum message length in characters")
+var channelMaxLength = make(server.ChannelLengths)
+var defaultFilters = flag.String("filters", "spam", "Comma separated filters messages go through: blocklist, links, spam, or none")
+var channelFilters = make(server.ChannelFilters)
+var attachmentDir = flag.String("attachments", "attachments", "Folder uploaded files are stored in")
+var maxFileSize = flag.Int64("max-file-size", 10, "Largest file that can be uploaded, in MiB")
+var userQuota = flag.Int64("user-quota", 100, "How much each user may upload, in MiB")
+var historyDir = flag.String("history", "history", "Folder the messages, channels and users are kept in; empty keeps them in memory only")
+var retention server.Retention
+var channelRetention = make(server.ChannelRetention)
+var compactInterval = flag.Duration("compact-interval", time.Minute, "How often expired messages are deleted and history past its retention purged")
+var blocklist = flag.String("blocklist", "", "Comma separated words masked by the blocklist filter")
+var tokenFile = flag.String("tokens", "", "JSON file with the token of each user who may moderate, like {\"s3cret\": \"Anon\"}")
+var webhookFile = flag.String("webhooks", "", "JSON file with the incoming and outgoing webhooks")
+var httpAddr = flag.String("http-addr", "localhost:8081", "Address the gateway, web client and incoming webhooks are served on over HTTP")
+var ircAddr = flag.String("irc-addr", "", "Address to accept IRC clients on, e.g. localhost:6667; empty for none")
+var web = flag.Bool("web", false, "Serve the web client on -http-addr")
+var gateway = flag.Bool("gateway", false, "Serve ChatService as JSON over HTTP and WebSockets on -http-addr")
+
+func main() {
+	flag.Var(channelMaxLength, "channel-max-length", "Per-channel maximum message length, e.g. Eepy=256,Dev=512")
+	flag.Var(channelFilters, "channel-filters", "Filters for a single channel, e.g. Kids=blocklist,links,spam (repeatable)")
+	flag.Var(&retention, "retention", "How much history each channel keeps, e.g. max-age=720h,max-count=10000,max-bytes=10485760 (default everything)")
+	flag.Var(channelRetention, "channel-retention", "Retention for a single channel, e.g. Eepy=max-age=24h,max-count=100 (repeatable)")
+	flag.Parse()
+
+	filters, err := server.ParseFilterList(*defaultFilters)
+	if err != nil {
+		log.Fatalf("Invalid -filters: %v", err)
+	}
+	cfg := server.Config{
+		UserRate:         *userRate,
+		UserBurst:        *userBurst,
+		ChannelRate:      *channelRate,
+		ChannelBurst:     *channelBurst,
+		MaxLength:        *maxLength,
+		ChannelMaxLength: channelMaxLength,
+		Filters:          filters,
+		ChannelFilters:   channelFilters,
+		AttachmentDir:    *attachmentDir,
+		MaxFileSize:      *maxFileSize << 20,
+		UserQuota:        *userQuota << 20,
+		HistoryDir:       *historyDir,
+		Retention:        retention,
+		ChannelRetention: channelRetention,
+		CompactInterval:  *compactInterval,
+	}
+	if *blocklist != "" {
+		cfg.Blocklist = strings.Split(*blocklist, ",")
+	}
+
+	opts := []server.Option{server.WithConfig(cfg), server.WithOutput(os.Stdout)}
+	serveHTTP := *gateway || *web
+	if *gateway {
+		opts = append(opts, server.WithGateway())
+	}
+	if *web {
+		opts = append(opts, server.WithWebUI())
+	}
+	if *tokenFile != "" {
+		tokens, err := readTokens(*tokenFile)
+		if err != nil {
+			log.Fatalf("Cannot read -tokens: %v", err)
+		}
+		opts = append(opts, server.WithIdentity(tokenIdentity(tokens)))
+	}
+	if *webhookFile != "" {
+		hooks, err := readWebhooks(*webhookFile)
+		if err != nil {
+			log.Fatalf("Cannot read -webhooks: %v", err)
+		}
+		opts = append(opts, server.WithWebhooks(hooks))
+		serveHTTP = serveHTTP || len(hooks.Incoming) > 0
+	}
+	if *ircAddr != "" {
+		opts = append(opts, server.WithIRCAddress(*ircAddr))
+	}
+	if serveHTTP {
+		opts = append(opts, server.WithHTTPAddress(*httpAddr))
+	}
+
+	srv, err := server.New(opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Sets the logger to use a log.txt file instead of the console
+	f := setLog()
+	defer f.Close()
+
+	if err := srv.Start(); err != nil {
+		log.Fatalf("Failed to start the server: %v", err)
+	}
+	fmt.Println("--- CHITTY CHAT ---")
+
+	// After a restart, the clock goes on from the history it loaded
+	fmt.Printf("Server started at Lamport time: %v\n", srv.Lamport())
+	log.Printf("Server started at Lamport time: %v\n", srv.Lamport())
+
+	if err := srv.Wait(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Function to read the webhooks from a JSON file like
+// {"incoming": [{"name": "CI", "channel": "Dev", "token": "..."}], "outgoing": [{"channel": "Dev", "match": "^!deploy", "url": "http://localhost:9000/"}]}
+func readWebhooks(path string) (server.Webhooks, error) {
+	var hooks server.Webhooks
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return hooks, err
+	}
+	err = json.Unmarshal(data, &hooks)
+	return hooks, err
+}
+
+// Function to read which user each token belongs to from a JSON file like {"s3cret": "Anon"}
+func readTokens(path string) (map[string]string, error) {
+	var tokens map[string]string
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &tokens)
+	return tokens, err
+}
+
+// Function to tell who's calling by the token the client sends as the "token" metadata (the client's -token flag)
+func tokenIdentity(tokens map[string]string) server.IdentityFunc {
+	return func(ctx context.Context) (string, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, token := range md.Get("token") {
+			if user, ok := tokens[token]; ok {
+				return user, nil
+			}
+		}
+		return "", errors.New("no known token")
+	}
+}
+
+// sets the logger to use a log.txt file instead of the console
+func setLog() *os.File {
+	// Clears the log.txt file when a new server is started
+	if _, err := os.Open("Server.txt"); err == nil {
+		if err := os.Truncate("Server.txt", 0); err != nil {
+			log.Printf("Failed to truncate: %v", err)
+		}
+	}
+
+	// This connects to the log file/changes the output of the log information to the log.txt file.
+	f, err := os.OpenFile("Server.txt", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		log.Fatalf("error opening file: %v", err)
+	}
+	log.SetOutput(f)
+	return f
+}
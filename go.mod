@@ -5,6 +5,8 @@ go 1.21.0
 require (
 	atomicgo.dev/cursor v0.2.0
 	github.com/inancgumus/screen v0.0.0-20190314163918-06e984b86ed3
+	golang.org/x/net v0.17.0
+	golang.org/x/term v0.13.0
 	google.golang.org/grpc v1.59.0
 	google.golang.org/protobuf v1.31.0
 )
@@ -12,9 +14,7 @@ require (
 require (
 	github.com/golang/protobuf v1.5.3 // indirect
 	golang.org/x/crypto v0.14.0 // indirect
-	golang.org/x/net v0.17.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
-	golang.org/x/term v0.13.0 // indirect
 	golang.org/x/text v0.13.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20231030173426-d783a09b4405 // indirect
 )
@@ -24,6 +24,23 @@ const _ = grpc.SupportPackageIsVersion7
 type ChatServiceClient interface {
 	JoinChannel(ctx context.Context, in *Channel, opts ...grpc.CallOption) (ChatService_JoinChannelClient, error)
 	SendMessage(ctx context.Context, opts ...grpc.CallOption) (ChatService_SendMessageClient, error)
+	Kick(ctx context.Context, in *ModerationRequest, opts ...grpc.CallOption) (*MessageAck, error)
+	Ban(ctx context.Context, in *ModerationRequest, opts ...grpc.CallOption) (*MessageAck, error)
+	Mute(ctx context.Context, in *ModerationRequest, opts ...grpc.CallOption) (*MessageAck, error)
+	Op(ctx context.Context, in *ModerationRequest, opts ...grpc.CallOption) (*MessageAck, error)
+	GetAuditLog(ctx context.Context, in *Channel, opts ...grpc.CallOption) (*AuditLog, error)
+	EditMessage(ctx context.Context, in *EditRequest, opts ...grpc.CallOption) (*MessageAck, error)
+	DeleteMessage(ctx context.Context, in *EditRequest, opts ...grpc.CallOption) (*MessageAck, error)
+	GetThread(ctx context.Context, in *MessageRef, opts ...grpc.CallOption) (*Thread, error)
+	React(ctx context.Context, in *ReactionRequest, opts ...grpc.CallOption) (*MessageAck, error)
+	ListMentions(ctx context.Context, in *MentionsRequest, opts ...grpc.CallOption) (*Mentions, error)
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResults, error)
+	UploadAttachment(ctx context.Context, opts ...grpc.CallOption) (ChatService_UploadAttachmentClient, error)
+	DownloadAttachment(ctx context.Context, in *AttachmentRef, opts ...grpc.CallOption) (ChatService_DownloadAttachmentClient, error)
+	ListChannels(ctx context.Context, in *Channel, opts ...grpc.CallOption) (*ChannelList, error)
+	GetHistory(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*History, error)
+	ExportChannel(ctx context.Context, in *Channel, opts ...grpc.CallOption) (ChatService_ExportChannelClient, error)
+	ImportChannel(ctx context.Context, opts ...grpc.CallOption) (ChatService_ImportChannelClient, error)
 }
 
 type chatServiceClient struct {
@@ -100,12 +117,278 @@ func (x *chatServiceSendMessageClient) CloseAndRecv() (*MessageAck, error) {
 	return m, nil
 }
 
+func (c *chatServiceClient) Kick(ctx context.Context, in *ModerationRequest, opts ...grpc.CallOption) (*MessageAck, error) {
+	out := new(MessageAck)
+	err := c.cc.Invoke(ctx, "/proto.ChatService/Kick", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) Ban(ctx context.Context, in *ModerationRequest, opts ...grpc.CallOption) (*MessageAck, error) {
+	out := new(MessageAck)
+	err := c.cc.Invoke(ctx, "/proto.ChatService/Ban", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) Mute(ctx context.Context, in *ModerationRequest, opts ...grpc.CallOption) (*MessageAck, error) {
+	out := new(MessageAck)
+	err := c.cc.Invoke(ctx, "/proto.ChatService/Mute", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) Op(ctx context.Context, in *ModerationRequest, opts ...grpc.CallOption) (*MessageAck, error) {
+	out := new(MessageAck)
+	err := c.cc.Invoke(ctx, "/proto.ChatService/Op", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) GetAuditLog(ctx context.Context, in *Channel, opts ...grpc.CallOption) (*AuditLog, error) {
+	out := new(AuditLog)
+	err := c.cc.Invoke(ctx, "/proto.ChatService/GetAuditLog", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) EditMessage(ctx context.Context, in *EditRequest, opts ...grpc.CallOption) (*MessageAck, error) {
+	out := new(MessageAck)
+	err := c.cc.Invoke(ctx, "/proto.ChatService/EditMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) DeleteMessage(ctx context.Context, in *EditRequest, opts ...grpc.CallOption) (*MessageAck, error) {
+	out := new(MessageAck)
+	err := c.cc.Invoke(ctx, "/proto.ChatService/DeleteMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) GetThread(ctx context.Context, in *MessageRef, opts ...grpc.CallOption) (*Thread, error) {
+	out := new(Thread)
+	err := c.cc.Invoke(ctx, "/proto.ChatService/GetThread", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) React(ctx context.Context, in *ReactionRequest, opts ...grpc.CallOption) (*MessageAck, error) {
+	out := new(MessageAck)
+	err := c.cc.Invoke(ctx, "/proto.ChatService/React", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) ListMentions(ctx context.Context, in *MentionsRequest, opts ...grpc.CallOption) (*Mentions, error) {
+	out := new(Mentions)
+	err := c.cc.Invoke(ctx, "/proto.ChatService/ListMentions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResults, error) {
+	out := new(SearchResults)
+	err := c.cc.Invoke(ctx, "/proto.ChatService/Search", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) UploadAttachment(ctx context.Context, opts ...grpc.CallOption) (ChatService_UploadAttachmentClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ChatService_ServiceDesc.Streams[2], "/proto.ChatService/UploadAttachment", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &chatServiceUploadAttachmentClient{stream}
+	return x, nil
+}
+
+type ChatService_UploadAttachmentClient interface {
+	Send(*AttachmentChunk) error
+	CloseAndRecv() (*Attachment, error)
+	grpc.ClientStream
+}
+
+type chatServiceUploadAttachmentClient struct {
+	grpc.ClientStream
+}
+
+func (x *chatServiceUploadAttachmentClient) Send(m *AttachmentChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *chatServiceUploadAttachmentClient) CloseAndRecv() (*Attachment, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(Attachment)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *chatServiceClient) DownloadAttachment(ctx context.Context, in *AttachmentRef, opts ...grpc.CallOption) (ChatService_DownloadAttachmentClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ChatService_ServiceDesc.Streams[3], "/proto.ChatService/DownloadAttachment", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &chatServiceDownloadAttachmentClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ChatService_DownloadAttachmentClient interface {
+	Recv() (*AttachmentChunk, error)
+	grpc.ClientStream
+}
+
+type chatServiceDownloadAttachmentClient struct {
+	grpc.ClientStream
+}
+
+func (x *chatServiceDownloadAttachmentClient) Recv() (*AttachmentChunk, error) {
+	m := new(AttachmentChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *chatServiceClient) ListChannels(ctx context.Context, in *Channel, opts ...grpc.CallOption) (*ChannelList, error) {
+	out := new(ChannelList)
+	err := c.cc.Invoke(ctx, "/proto.ChatService/ListChannels", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) GetHistory(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*History, error) {
+	out := new(History)
+	err := c.cc.Invoke(ctx, "/proto.ChatService/GetHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatServiceClient) ExportChannel(ctx context.Context, in *Channel, opts ...grpc.CallOption) (ChatService_ExportChannelClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ChatService_ServiceDesc.Streams[4], "/proto.ChatService/ExportChannel", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &chatServiceExportChannelClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ChatService_ExportChannelClient interface {
+	Recv() (*ArchiveRecord, error)
+	grpc.ClientStream
+}
+
+type chatServiceExportChannelClient struct {
+	grpc.ClientStream
+}
+
+func (x *chatServiceExportChannelClient) Recv() (*ArchiveRecord, error) {
+	m := new(ArchiveRecord)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *chatServiceClient) ImportChannel(ctx context.Context, opts ...grpc.CallOption) (ChatService_ImportChannelClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ChatService_ServiceDesc.Streams[5], "/proto.ChatService/ImportChannel", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &chatServiceImportChannelClient{stream}
+	return x, nil
+}
+
+type ChatService_ImportChannelClient interface {
+	Send(*ImportChunk) error
+	CloseAndRecv() (*ImportResult, error)
+	grpc.ClientStream
+}
+
+type chatServiceImportChannelClient struct {
+	grpc.ClientStream
+}
+
+func (x *chatServiceImportChannelClient) Send(m *ImportChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *chatServiceImportChannelClient) CloseAndRecv() (*ImportResult, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ImportResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // ChatServiceServer is the server API for ChatService service.
 // All implementations must embed UnimplementedChatServiceServer
 // for forward compatibility
 type ChatServiceServer interface {
 	JoinChannel(*Channel, ChatService_JoinChannelServer) error
 	SendMessage(ChatService_SendMessageServer) error
+	Kick(context.Context, *ModerationRequest) (*MessageAck, error)
+	Ban(context.Context, *ModerationRequest) (*MessageAck, error)
+	Mute(context.Context, *ModerationRequest) (*MessageAck, error)
+	Op(context.Context, *ModerationRequest) (*MessageAck, error)
+	GetAuditLog(context.Context, *Channel) (*AuditLog, error)
+	EditMessage(context.Context, *EditRequest) (*MessageAck, error)
+	DeleteMessage(context.Context, *EditRequest) (*MessageAck, error)
+	GetThread(context.Context, *MessageRef) (*Thread, error)
+	React(context.Context, *ReactionRequest) (*MessageAck, error)
+	ListMentions(context.Context, *MentionsRequest) (*Mentions, error)
+	Search(context.Context, *SearchRequest) (*SearchResults, error)
+	UploadAttachment(ChatService_UploadAttachmentServer) error
+	DownloadAttachment(*AttachmentRef, ChatService_DownloadAttachmentServer) error
+	ListChannels(context.Context, *Channel) (*ChannelList, error)
+	GetHistory(context.Context, *HistoryRequest) (*History, error)
+	ExportChannel(*Channel, ChatService_ExportChannelServer) error
+	ImportChannel(ChatService_ImportChannelServer) error
 	mustEmbedUnimplementedChatServiceServer()
 }
 
@@ -119,6 +402,57 @@ func (UnimplementedChatServiceServer) JoinChannel(*Channel, ChatService_JoinChan
 func (UnimplementedChatServiceServer) SendMessage(ChatService_SendMessageServer) error {
 	return status.Errorf(codes.Unimplemented, "method SendMessage not implemented")
 }
+func (UnimplementedChatServiceServer) Kick(context.Context, *ModerationRequest) (*MessageAck, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Kick not implemented")
+}
+func (UnimplementedChatServiceServer) Ban(context.Context, *ModerationRequest) (*MessageAck, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ban not implemented")
+}
+func (UnimplementedChatServiceServer) Mute(context.Context, *ModerationRequest) (*MessageAck, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Mute not implemented")
+}
+func (UnimplementedChatServiceServer) Op(context.Context, *ModerationRequest) (*MessageAck, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Op not implemented")
+}
+func (UnimplementedChatServiceServer) GetAuditLog(context.Context, *Channel) (*AuditLog, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAuditLog not implemented")
+}
+func (UnimplementedChatServiceServer) EditMessage(context.Context, *EditRequest) (*MessageAck, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EditMessage not implemented")
+}
+func (UnimplementedChatServiceServer) DeleteMessage(context.Context, *EditRequest) (*MessageAck, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMessage not implemented")
+}
+func (UnimplementedChatServiceServer) GetThread(context.Context, *MessageRef) (*Thread, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetThread not implemented")
+}
+func (UnimplementedChatServiceServer) React(context.Context, *ReactionRequest) (*MessageAck, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method React not implemented")
+}
+func (UnimplementedChatServiceServer) ListMentions(context.Context, *MentionsRequest) (*Mentions, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMentions not implemented")
+}
+func (UnimplementedChatServiceServer) Search(context.Context, *SearchRequest) (*SearchResults, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedChatServiceServer) UploadAttachment(ChatService_UploadAttachmentServer) error {
+	return status.Errorf(codes.Unimplemented, "method UploadAttachment not implemented")
+}
+func (UnimplementedChatServiceServer) DownloadAttachment(*AttachmentRef, ChatService_DownloadAttachmentServer) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadAttachment not implemented")
+}
+func (UnimplementedChatServiceServer) ListChannels(context.Context, *Channel) (*ChannelList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListChannels not implemented")
+}
+func (UnimplementedChatServiceServer) GetHistory(context.Context, *HistoryRequest) (*History, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetHistory not implemented")
+}
+func (UnimplementedChatServiceServer) ExportChannel(*Channel, ChatService_ExportChannelServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExportChannel not implemented")
+}
+func (UnimplementedChatServiceServer) ImportChannel(ChatService_ImportChannelServer) error {
+	return status.Errorf(codes.Unimplemented, "method ImportChannel not implemented")
+}
 func (UnimplementedChatServiceServer) mustEmbedUnimplementedChatServiceServer() {}
 
 // UnsafeChatServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -179,13 +513,394 @@ func (x *chatServiceSendMessageServer) Recv() (*Message, error) {
 	return m, nil
 }
 
+func _ChatService_Kick_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModerationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).Kick(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.ChatService/Kick",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).Kick(ctx, req.(*ModerationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_Ban_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModerationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).Ban(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.ChatService/Ban",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).Ban(ctx, req.(*ModerationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_Mute_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModerationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).Mute(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.ChatService/Mute",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).Mute(ctx, req.(*ModerationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_Op_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModerationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).Op(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.ChatService/Op",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).Op(ctx, req.(*ModerationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_GetAuditLog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Channel)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).GetAuditLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.ChatService/GetAuditLog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).GetAuditLog(ctx, req.(*Channel))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_EditMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EditRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).EditMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.ChatService/EditMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).EditMessage(ctx, req.(*EditRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_DeleteMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EditRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).DeleteMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.ChatService/DeleteMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).DeleteMessage(ctx, req.(*EditRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_GetThread_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MessageRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).GetThread(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.ChatService/GetThread",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).GetThread(ctx, req.(*MessageRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_React_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).React(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.ChatService/React",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).React(ctx, req.(*ReactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_ListMentions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MentionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).ListMentions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.ChatService/ListMentions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).ListMentions(ctx, req.(*MentionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.ChatService/Search",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).Search(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_UploadAttachment_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ChatServiceServer).UploadAttachment(&chatServiceUploadAttachmentServer{stream})
+}
+
+type ChatService_UploadAttachmentServer interface {
+	SendAndClose(*Attachment) error
+	Recv() (*AttachmentChunk, error)
+	grpc.ServerStream
+}
+
+type chatServiceUploadAttachmentServer struct {
+	grpc.ServerStream
+}
+
+func (x *chatServiceUploadAttachmentServer) SendAndClose(m *Attachment) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *chatServiceUploadAttachmentServer) Recv() (*AttachmentChunk, error) {
+	m := new(AttachmentChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _ChatService_DownloadAttachment_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(AttachmentRef)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ChatServiceServer).DownloadAttachment(m, &chatServiceDownloadAttachmentServer{stream})
+}
+
+type ChatService_DownloadAttachmentServer interface {
+	Send(*AttachmentChunk) error
+	grpc.ServerStream
+}
+
+type chatServiceDownloadAttachmentServer struct {
+	grpc.ServerStream
+}
+
+func (x *chatServiceDownloadAttachmentServer) Send(m *AttachmentChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ChatService_ListChannels_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Channel)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).ListChannels(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.ChatService/ListChannels",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).ListChannels(ctx, req.(*Channel))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_GetHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatServiceServer).GetHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.ChatService/GetHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatServiceServer).GetHistory(ctx, req.(*HistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatService_ExportChannel_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Channel)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ChatServiceServer).ExportChannel(m, &chatServiceExportChannelServer{stream})
+}
+
+type ChatService_ExportChannelServer interface {
+	Send(*ArchiveRecord) error
+	grpc.ServerStream
+}
+
+type chatServiceExportChannelServer struct {
+	grpc.ServerStream
+}
+
+func (x *chatServiceExportChannelServer) Send(m *ArchiveRecord) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ChatService_ImportChannel_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ChatServiceServer).ImportChannel(&chatServiceImportChannelServer{stream})
+}
+
+type ChatService_ImportChannelServer interface {
+	SendAndClose(*ImportResult) error
+	Recv() (*ImportChunk, error)
+	grpc.ServerStream
+}
+
+type chatServiceImportChannelServer struct {
+	grpc.ServerStream
+}
+
+func (x *chatServiceImportChannelServer) SendAndClose(m *ImportResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *chatServiceImportChannelServer) Recv() (*ImportChunk, error) {
+	m := new(ImportChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // ChatService_ServiceDesc is the grpc.ServiceDesc for ChatService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
 var ChatService_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "proto.ChatService",
 	HandlerType: (*ChatServiceServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Kick",
+			Handler:    _ChatService_Kick_Handler,
+		},
+		{
+			MethodName: "Ban",
+			Handler:    _ChatService_Ban_Handler,
+		},
+		{
+			MethodName: "Mute",
+			Handler:    _ChatService_Mute_Handler,
+		},
+		{
+			MethodName: "Op",
+			Handler:    _ChatService_Op_Handler,
+		},
+		{
+			MethodName: "GetAuditLog",
+			Handler:    _ChatService_GetAuditLog_Handler,
+		},
+		{
+			MethodName: "EditMessage",
+			Handler:    _ChatService_EditMessage_Handler,
+		},
+		{
+			MethodName: "DeleteMessage",
+			Handler:    _ChatService_DeleteMessage_Handler,
+		},
+		{
+			MethodName: "GetThread",
+			Handler:    _ChatService_GetThread_Handler,
+		},
+		{
+			MethodName: "React",
+			Handler:    _ChatService_React_Handler,
+		},
+		{
+			MethodName: "ListMentions",
+			Handler:    _ChatService_ListMentions_Handler,
+		},
+		{
+			MethodName: "Search",
+			Handler:    _ChatService_Search_Handler,
+		},
+		{
+			MethodName: "ListChannels",
+			Handler:    _ChatService_ListChannels_Handler,
+		},
+		{
+			MethodName: "GetHistory",
+			Handler:    _ChatService_GetHistory_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "JoinChannel",
@@ -197,6 +912,26 @@ var ChatService_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _ChatService_SendMessage_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "UploadAttachment",
+			Handler:       _ChatService_UploadAttachment_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadAttachment",
+			Handler:       _ChatService_DownloadAttachment_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ExportChannel",
+			Handler:       _ChatService_ExportChannel_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ImportChannel",
+			Handler:       _ChatService_ImportChannel_Handler,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "proto/chat.proto",
 }
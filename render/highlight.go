@@ -0,0 +1,145 @@
+package render
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Colors of the parts of highlighted code
+const (
+	keywordColor = "\033[35m"
+	stringColor  = "\033[32m"
+	numberColor  = "\033[33m"
+	commentColor = "\033[90m"
+)
+
+// Keywords of the languages code blocks can be highlighted as.
+// Code blocks without a (known) language get the keywords of all of them.
+var keywords = map[string][]string{
+	"go": {"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough", "for", "func",
+		"go", "goto", "if", "import", "interface", "map", "package", "range", "return", "select", "struct", "switch",
+		"type", "var", "nil", "true", "false"},
+	"python": {"and", "as", "assert", "async", "await", "break", "class", "continue", "def", "del", "elif", "else",
+		"except", "finally", "for", "from", "global", "if", "import", "in", "is", "lambda", "not", "or", "pass",
+		"raise", "return", "try", "while", "with", "yield", "None", "True", "False"},
+	"js": {"async", "await", "break", "case", "catch", "class", "const", "continue", "default", "delete", "do", "else",
+		"export", "extends", "finally", "for", "function", "if", "import", "in", "instanceof", "let", "new", "return",
+		"switch", "this", "throw", "try", "typeof", "var", "while", "yield", "null", "undefined", "true", "false"},
+	"sh": {"case", "do", "done", "elif", "else", "esac", "export", "fi", "for", "function", "if", "in", "local",
+		"return", "then", "while"},
+}
+
+// Other names languages go by
+var languageAliases = map[string]string{
+	"golang": "go", "py": "python", "javascript": "js", "ts": "js", "typescript": "js", "bash": "sh", "shell": "sh",
+}
+
+// Line comment markers, per language
+var lineComments = map[string][]string{
+	"go": {"//"}, "python": {"#"}, "js": {"//"}, "sh": {"#"},
+}
+
+// Function to check whether name is a language we can highlight
+func isLanguage(name string) bool {
+	name = strings.ToLower(name)
+	_, ok := keywords[name]
+	_, alias := languageAliases[name]
+	return ok || alias
+}
+
+// Function to get the keywords and comment markers of a language; all of them if the language is unknown
+func language(name string) (map[string]bool, []string) {
+	name = strings.ToLower(name)
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+	words := make(map[string]bool)
+	if list, ok := keywords[name]; ok {
+		for _, word := range list {
+			words[word] = true
+		}
+		return words, lineComments[name]
+	}
+	for _, list := range keywords {
+		for _, word := range list {
+			words[word] = true
+		}
+	}
+	return words, []string{"//", "#"}
+}
+
+// Function to highlight a single line of code: keywords, strings, numbers and comments
+func highlight(line, lang string) string {
+	words, comments := language(lang)
+	var b strings.Builder
+	for len(line) > 0 {
+		if startsWithAny(line, comments) {
+			b.WriteString(commentColor + line + colorOff)
+			break
+		}
+
+		c := line[0]
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			end := closingQuote(line)
+			b.WriteString(stringColor + line[:end] + colorOff)
+			line = line[end:]
+		case c >= '0' && c <= '9':
+			end := strings.IndexFunc(line, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' && r != 'x' && r != '_' })
+			if end < 0 {
+				end = len(line)
+			}
+			b.WriteString(numberColor + line[:end] + colorOff)
+			line = line[end:]
+		case isWordStart(rune(c)) || c >= 0x80:
+			end := strings.IndexFunc(line, func(r rune) bool { return !isWordStart(r) && !unicode.IsDigit(r) })
+			if end < 0 {
+				end = len(line)
+			}
+			if end == 0 {
+				// a non-ASCII rune that isn't a letter
+				_, end = utf8.DecodeRuneInString(line)
+			}
+			word := line[:end]
+			if words[word] {
+				b.WriteString(keywordColor + word + colorOff)
+			} else {
+				b.WriteString(word)
+			}
+			line = line[end:]
+		default:
+			b.WriteByte(c)
+			line = line[1:]
+		}
+	}
+	return b.String()
+}
+
+func isWordStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+// Function to find the end of a string starting at line[0], backslash escapes included; the end of the line if it's not closed
+func closingQuote(line string) int {
+	quote := line[0]
+	for i := 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(line)
+}
+
+// Function to check whether text starts with any of prefixes
+func startsWithAny(text string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,232 @@
+// Package render turns chat messages into text for the terminal.
+// It understands a small, safe subset of markup: **bold**, *italics* or _italics_,
+// `inline code`, ```code blocks``` (with syntax highlighting), [links](https://...) and bare links.
+// Nothing in a message can produce escape sequences of its own; control characters are dropped.
+package render
+
+import (
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ANSI escape sequences used for styling. Each style has its own "off" sequence,
+// so styles can be nested without one ending the other.
+const (
+	bold         = "\033[1m"
+	boldOff      = "\033[22m"
+	dim          = "\033[2m"
+	italic       = "\033[3m"
+	italicOff    = "\033[23m"
+	underline    = "\033[4m"
+	underlineOff = "\033[24m"
+	reverse      = "\033[7m"
+	reverseOff   = "\033[27m"
+	colorOff     = "\033[39m"
+	reset        = "\033[0m"
+)
+
+// Colors sender names are picked from; all readable on dark and light backgrounds
+var senderColors = []int{33, 37, 71, 72, 99, 130, 133, 136, 166, 168, 172, 178}
+
+// Renderer renders messages for the terminal.
+// With Color off, text is passed through as typed (markup included), with control characters dropped.
+// Me is the local user's name; @mentions of them are highlighted.
+type Renderer struct {
+	Color bool
+	Me    string
+}
+
+// New returns a Renderer for the local user me
+func New(color bool, me string) *Renderer {
+	return &Renderer{Color: color, Me: me}
+}
+
+// Wanted tells whether to style output: not when asked not to, when NO_COLOR is set to anything (see no-color.org),
+// or when it's not going to a terminal
+func Wanted(disabled, terminal bool) bool {
+	return !disabled && os.Getenv("NO_COLOR") == "" && terminal
+}
+
+// Sender renders a sender's name, in a color of its own that's the same every time
+func (r *Renderer) Sender(name string) string {
+	name = Sanitize(name)
+	if !r.Color {
+		return name
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	color := senderColors[h.Sum32()%uint32(len(senderColors))]
+	return bold + "\033[38;5;" + strconv.Itoa(color) + "m" + name + colorOff + boldOff
+}
+
+// Dim renders text that's less important, like timestamps
+func (r *Renderer) Dim(text string) string {
+	text = Sanitize(text)
+	if !r.Color {
+		return text
+	}
+	return dim + text + boldOff
+}
+
+// Message renders the text of a message, markup and all
+func (r *Renderer) Message(text string) string {
+	text = Sanitize(text)
+	if !r.Color {
+		return text
+	}
+	var b strings.Builder
+	r.blocks(&b, text)
+	return b.String()
+}
+
+// Sanitize drops control characters (escape sequences included), keeping newlines and turning tabs into spaces
+func Sanitize(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n':
+			return r
+		case r == '\t':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// Function to render fenced code blocks, and everything between them as inline markup
+func (r *Renderer) blocks(b *strings.Builder, text string) {
+	for {
+		start := strings.Index(text, "```")
+		if start < 0 {
+			r.inline(b, text)
+			return
+		}
+		end := strings.Index(text[start+3:], "```")
+		if end < 0 {
+			r.inline(b, text)
+			return
+		}
+		r.inline(b, text[:start])
+		r.codeBlock(b, text[start+3:start+3+end])
+		text = text[start+3+end+3:]
+	}
+}
+
+// Function to render a code block; a language name right after the opening fence picks the highlighting
+func (r *Renderer) codeBlock(b *strings.Builder, code string) {
+	lang := ""
+	if i := strings.IndexAny(code, " \n"); i > 0 && isLanguage(code[:i]) {
+		lang, code = code[:i], code[i+1:]
+	}
+	code = strings.Trim(code, "\n")
+	multiline := strings.Contains(code, "\n")
+	if multiline {
+		b.WriteString("\n")
+	}
+	for i, line := range strings.Split(code, "\n") {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if multiline {
+			b.WriteString(dim + "│ " + boldOff)
+		}
+		b.WriteString(highlight(line, lang))
+	}
+	if multiline {
+		b.WriteString("\n")
+	}
+}
+
+// Function to render inline markup: code spans, links, bold, italics and mentions
+func (r *Renderer) inline(b *strings.Builder, text string) {
+	afterWord := false
+	for len(text) > 0 {
+		if n := r.span(b, text, afterWord); n > 0 {
+			text = text[n:]
+			afterWord = false
+			continue
+		}
+		// Plain character
+		c, size := utf8.DecodeRuneInString(text)
+		b.WriteString(text[:size])
+		text = text[size:]
+		afterWord = unicode.IsLetter(c) || unicode.IsDigit(c)
+	}
+}
+
+// Function to render the markup text starts with, if any; returns how much of text was used.
+// afterWord tells whether text comes right after a letter or digit, where * and _ don't start italics (2*3, snake_case).
+func (r *Renderer) span(b *strings.Builder, text string, afterWord bool) int {
+	switch {
+	case strings.HasPrefix(text, "`"):
+		if end := strings.Index(text[1:], "`"); end > 0 {
+			b.WriteString(reverse + " " + text[1:1+end] + " " + reverseOff)
+			return end + 2
+		}
+	case strings.HasPrefix(text, "**"):
+		if end := strings.Index(text[2:], "**"); end > 0 {
+			b.WriteString(bold)
+			r.inline(b, text[2:2+end])
+			b.WriteString(boldOff)
+			return end + 4
+		}
+	case !afterWord && (strings.HasPrefix(text, "*") || strings.HasPrefix(text, "_")):
+		marker := text[:1]
+		if end := strings.Index(text[1:], marker); end > 0 && !unicode.IsSpace(rune(text[1])) && !isNameRune(text[end+2:]) {
+			b.WriteString(italic)
+			r.inline(b, text[1:1+end])
+			b.WriteString(italicOff)
+			return end + 2
+		}
+	case strings.HasPrefix(text, "["):
+		if label, url, n := parseLink(text); n > 0 {
+			b.WriteString(underline + label + underlineOff + " " + dim + "(" + url + ")" + boldOff)
+			return n
+		}
+	case strings.HasPrefix(text, "http://"), strings.HasPrefix(text, "https://"):
+		end := strings.IndexFunc(text, unicode.IsSpace)
+		if end < 0 {
+			end = len(text)
+		}
+		b.WriteString(underline + text[:end] + underlineOff)
+		return end
+	case strings.HasPrefix(text, "@") && r.Me != "":
+		if mention := "@" + r.Me; strings.HasPrefix(text, mention) && !isNameRune(text[len(mention):]) {
+			b.WriteString(reverse + mention + reverseOff)
+			return len(mention)
+		}
+	}
+	return 0
+}
+
+// Function to parse a [label](url) link at the start of text; only http and https links count
+func parseLink(text string) (label, url string, n int) {
+	closeLabel := strings.Index(text, "](")
+	if closeLabel < 1 {
+		return "", "", 0
+	}
+	closeURL := strings.Index(text[closeLabel+2:], ")")
+	if closeURL < 0 {
+		return "", "", 0
+	}
+	label = text[1:closeLabel]
+	url = text[closeLabel+2 : closeLabel+2+closeURL]
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") || strings.ContainsAny(url, " \n") {
+		return "", "", 0
+	}
+	return label, url, closeLabel + 2 + closeURL + 1
+}
+
+// Function to check whether text starts with a character that can be part of a user name
+func isNameRune(text string) bool {
+	if text == "" {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(text)
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_'
+}
@@ -0,0 +1,108 @@
+package render
+
+import "testing"
+
+func TestMessage(t *testing.T) {
+	r := New(true, "Bob")
+	tests := []struct {
+		name, text, want string
+	}{
+		{"plain", "hello there", "hello there"},
+		{"bold", "**loud** words", bold + "loud" + boldOff + " words"},
+		{"italics", "*soft* and _soft_", italic + "soft" + italicOff + " and " + italic + "soft" + italicOff},
+		{"italics in bold", "**very _soft_**", bold + "very " + italic + "soft" + italicOff + boldOff},
+		{"no italics inside words", "2*3*4 and snake_case_name", "2*3*4 and snake_case_name"},
+		{"no italics after a space", "* not a list *", "* not a list *"},
+		{"inline code", "run `go test` now", "run " + reverse + " go test " + reverseOff + " now"},
+		{"no markup in code", "`**not bold**`", reverse + " **not bold** " + reverseOff},
+		{"unclosed markup", "**half and `half", "**half and `half"},
+		{"link", "[docs](https://go.dev)", underline + "docs" + underlineOff + " " + dim + "(https://go.dev)" + boldOff},
+		{"only web links", "[run](javascript:alert)", "[run](javascript:alert)"},
+		{"bare link", "see https://go.dev now", "see " + underline + "https://go.dev" + underlineOff + " now"},
+		{"mention of me", "hi @Bob!", "hi " + reverse + "@Bob" + reverseOff + "!"},
+		{"mention of someone else", "hi @Bobby and @Carol", "hi @Bobby and @Carol"},
+		{"code block", "```x := 1```", "x := " + numberColor + "1" + colorOff},
+		{"code block with a language", "```go\nreturn nil\n```", keywordColor + "return" + colorOff + " " + keywordColor + "nil" + colorOff},
+		{"multiline code block", "```\na\nb\n```", "\n" + dim + "│ " + boldOff + "a\n" + dim + "│ " + boldOff + "b\n"},
+	}
+	for _, test := range tests {
+		if got := r.Message(test.text); got != test.want {
+			t.Errorf("%v: Message(%q) = %q, want %q", test.name, test.text, got, test.want)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"plain", "hello", "hello"},
+		{"newlines kept", "one\ntwo", "one\ntwo"},
+		{"tabs become spaces", "a\tb", "a b"},
+		{"escape sequences lose their escape", "\033[2Jcleared\033[31m", "[2Jcleared[31m"},
+		{"bell and backspace", "ding\a\b", "ding"},
+		{"carriage return", "fake\rreal", "fakereal"},
+		{"C1 controls", "a\u009bb\u0085c", "abc"},
+		{"unicode kept", "héllo 👋", "héllo 👋"},
+	}
+	for _, test := range tests {
+		if got := Sanitize(test.text); got != test.want {
+			t.Errorf("%v: Sanitize(%q) = %q, want %q", test.name, test.text, got, test.want)
+		}
+	}
+
+	// Whatever the markup, no escape sequence from the message makes it through
+	r := New(true, "Bob")
+	for _, text := range []string{"**\033[31mred**", "`\033]0;title\a`", "[x\033[1m](https://go.dev)", "```go\n\033[2J\n```"} {
+		got := r.Message(text)
+		for i := 0; i < len(got); i++ {
+			if got[i] == '\033' && !startsWithStyle(got[i:]) {
+				t.Errorf("Message(%q) = %q, which has an escape sequence of its own", text, got)
+				break
+			}
+		}
+	}
+}
+
+// Function to check text starts with one of the escape sequences the renderer writes itself
+func startsWithStyle(text string) bool {
+	for _, style := range []string{bold, boldOff, dim, italic, italicOff, underline, underlineOff, reverse, reverseOff, colorOff,
+		keywordColor, stringColor, numberColor, commentColor} {
+		if len(text) >= len(style) && text[:len(style)] == style {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNoColor(t *testing.T) {
+	r := New(false, "Bob")
+	if got := r.Message("**hi** @Bob `x` \033[31m"); got != "**hi** @Bob `x` [31m" {
+		t.Errorf("Message without color = %q, want the text as typed without the escape", got)
+	}
+	if got := r.Sender("Anon"); got != "Anon" {
+		t.Errorf("Sender without color = %q, want the plain name", got)
+	}
+	if got := r.Dim("Lamport time: 3"); got != "Lamport time: 3" {
+		t.Errorf("Dim without color = %q, want the plain text", got)
+	}
+
+	tests := []struct {
+		name               string
+		noColor            string
+		disabled, terminal bool
+		want               bool
+	}{
+		{"terminal", "", false, true, true},
+		{"not a terminal", "", false, false, false},
+		{"-no-color", "", true, true, false},
+		{"NO_COLOR", "1", false, true, false},
+		{"NO_COLOR set to anything", "0", false, true, false},
+	}
+	for _, test := range tests {
+		t.Setenv("NO_COLOR", test.noColor)
+		if got := Wanted(test.disabled, test.terminal); got != test.want {
+			t.Errorf("%v: Wanted(%v, %v) = %v, want %v", test.name, test.disabled, test.terminal, got, test.want)
+		}
+	}
+}
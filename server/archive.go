@@ -0,0 +1,480 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Version of the archive format ExportChannel writes and ImportChannel reads
+const archiveVersion = 1
+
+// Most messages a single import may bring in
+const maxImportMessages = 100000
+
+// Lamport times in an archive must be below this, so the server's clock has room to go on counting after an import
+const maxImportLamport = math.MaxInt32 / 2
+
+// ExportChannel streams an archive of a channel: its settings, members with their roles, bans and mutes,
+// the audit log and every message with its Lamport time. Only operators and the owner may export, since it has the bans in it.
+func (s *chatServiceServer) ExportChannel(ch *pb.Channel, stream pb.ChatService_ExportChannelServer) error {
+	if err := validateChannel(ch); err != nil {
+		return err
+	}
+	channel := ch.GetName()
+	if err := s.needRole(stream.Context(), channel, ch.GetSendersName(), operator); err != nil {
+		return err
+	}
+
+	messages := s.history.export(channel)
+	s.mu.Lock()
+	lamport := s.Lamport
+	online := make(map[string]bool)
+	for _, client := range s.channel[channel] {
+		online[client.name] = true
+	}
+	s.mu.Unlock()
+
+	var filters []string
+	s.filters.mu.Lock()
+	for _, stage := range s.filters.forChannel(channel) {
+		filters = append(filters, stage.name)
+	}
+	s.filters.mu.Unlock()
+	header := &pb.ArchiveHeader{
+		Version:    archiveVersion,
+		Channel:    channel,
+		Lamport:    lamport,
+		ExportedAt: s.now().Unix(),
+		MaxLength:  int32(s.limits.maxLength(channel)),
+		Filters:    filters,
+		Messages:   int32(len(messages)),
+	}
+	if err := stream.Send(&pb.ArchiveRecord{Record: &pb.ArchiveRecord_Header{Header: header}}); err != nil {
+		return err
+	}
+	for _, member := range s.moderation.export(channel, online) {
+		if err := stream.Send(&pb.ArchiveRecord{Record: &pb.ArchiveRecord_Member{Member: member}}); err != nil {
+			return err
+		}
+	}
+	for _, entry := range s.moderation.auditLog(channel) {
+		if err := stream.Send(&pb.ArchiveRecord{Record: &pb.ArchiveRecord_Audit{Audit: entry}}); err != nil {
+			return err
+		}
+	}
+	for _, msg := range messages {
+		if err := stream.Send(&pb.ArchiveRecord{Record: &pb.ArchiveRecord_Message{Message: msg}}); err != nil {
+			return err
+		}
+	}
+
+	s.moderation.record(&pb.AuditEntry{Channel: channel, Moderator: ch.GetSendersName(), Action: "export", Timestamp: lamport})
+	return nil
+}
+
+// ImportChannel restores an archive into a channel, which may have another name than the one exported.
+// The channel must not have any messages yet, and if it has an owner, only they may import into it.
+// Messages get new ids, as ids are unique on each server, but keep their Lamport times; the server's clock is moved past them.
+// Roles, bans and mutes come back as they were, and whoever imported is an owner of the channel.
+func (s *chatServiceServer) ImportChannel(stream pb.ChatService_ImportChannelServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	ch := first.GetChannel()
+	if err := validateChannel(ch); err != nil {
+		return err
+	}
+	channel, importer := ch.GetName(), ch.GetSendersName()
+
+	// Only one import into a channel at a time, so nothing gets in between checking it may be imported into and restoring
+	if err := s.startImport(channel); err != nil {
+		return err
+	}
+	defer s.endImport(channel)
+
+	if err := s.canImport(stream.Context(), channel, importer); err != nil {
+		return err
+	}
+
+	// Read the whole archive before changing anything, so a broken one changes nothing
+	archive, err := readArchive(first.GetRecord(), stream)
+	if err != nil {
+		return err
+	}
+	latest := archive.header.GetLamport()
+	if latest < 0 || latest >= maxImportLamport {
+		return status.Errorf(codes.InvalidArgument, "archive is at Lamport time %v, which this server can't go on from", latest)
+	}
+	for _, msg := range archive.messages {
+		if err := s.checkImported(channel, msg); err != nil {
+			return err
+		}
+		latest = max(latest, msg.GetTimestamp())
+		for _, edit := range msg.GetEdits() {
+			latest = max(latest, edit.GetTimestamp())
+		}
+	}
+	for _, entry := range archive.audit {
+		if err := checkImportedAudit(channel, entry); err != nil {
+			return err
+		}
+		latest = max(latest, entry.GetTimestamp())
+	}
+
+	// Checked again, in case the channel got messages or an owner while the archive was coming in
+	if err := s.canImport(stream.Context(), channel, importer); err != nil {
+		return err
+	}
+	if err := s.history.restore(channel, archive.messages); err != nil {
+		return err
+	}
+	for _, msg := range archive.messages {
+		if msg.GetEvent() != pb.Event_DELETED {
+			s.search.index(msg)
+		}
+		s.mentions.addUser(msg.GetSender())
+	}
+	s.moderation.restore(channel, archive.members, archive.audit)
+	s.moderation.setRole(channel, importer, owner)
+
+	// Moves the server's clock past everything imported, so new messages come after them
+	s.mu.Lock()
+	if latest >= s.Lamport {
+		s.Lamport = latest + 1
+	}
+	lamport := s.Lamport
+	s.mu.Unlock()
+
+	announcement := fmt.Sprintf("%v imported %v messages from %v", importer, len(archive.messages), archive.header.GetChannel())
+	s.sendMsgToClients(&pb.Message{Sender: channel, Message: announcement, Channel: &pb.Channel{Name: channel}, Timestamp: lamport})
+	s.moderation.record(&pb.AuditEntry{Channel: channel, Moderator: importer, Action: "import", Target: archive.header.GetChannel(), Timestamp: lamport})
+
+	return stream.SendAndClose(&pb.ImportResult{Channel: channel, Messages: int32(len(archive.messages)), Members: int32(len(archive.members))})
+}
+
+// Function to claim channel for an import, refusing if another import into it is still going
+func (s *chatServiceServer) startImport(channel string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.importing[channel] {
+		return status.Errorf(codes.Aborted, "%v is already being imported into", channel)
+	}
+	s.importing[channel] = true
+	return nil
+}
+
+func (s *chatServiceServer) endImport(channel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.importing, channel)
+}
+
+// Function to check an imported message the way a live one is checked, and move it into channel.
+// Deleted messages keep no text or files; the others must fit the channel's length limit and their files must be on this server.
+func (s *chatServiceServer) checkImported(channel string, msg *pb.Message) error {
+	msg.Channel = &pb.Channel{Name: channel, SendersName: msg.GetSender()}
+	if ts := msg.GetTimestamp(); ts < 0 || ts >= maxImportLamport {
+		return status.Errorf(codes.InvalidArgument, "message #%v is at Lamport time %v, which this server can't go on from", msg.GetId(), ts)
+	}
+	for _, edit := range msg.GetEdits() {
+		if ts := edit.GetTimestamp(); ts < 0 || ts >= maxImportLamport {
+			return status.Errorf(codes.InvalidArgument, "message #%v has an edit at Lamport time %v, which this server can't go on from", msg.GetId(), ts)
+		}
+		if err := validateName("user", edit.GetEditor()); err != nil {
+			return status.Errorf(codes.InvalidArgument, "message #%v: %v", msg.GetId(), status.Convert(err).Message())
+		}
+		if !utf8.ValidString(edit.GetPrevious()) {
+			return status.Errorf(codes.InvalidArgument, "message #%v has an edit that is not valid UTF-8", msg.GetId())
+		}
+		edit.Previous = stripControl(edit.GetPrevious())
+	}
+
+	if msg.GetEvent() == pb.Event_DELETED {
+		msg.Message = ""
+		msg.Attachments = nil
+		return validateName("user", msg.GetSender())
+	}
+	if err := s.limits.validateMessage(msg); err != nil {
+		return status.Errorf(codes.InvalidArgument, "message #%v: %v", msg.GetId(), status.Convert(err).Message())
+	}
+	if err := s.attachments.check(msg.GetAttachments()); err != nil {
+		return status.Errorf(codes.InvalidArgument, "message #%v: %v", msg.GetId(), status.Convert(err).Message())
+	}
+	return nil
+}
+
+// The actions an audit log can have, see moderate, ExportChannel and ImportChannel
+var auditActions = map[string]bool{"kick": true, "ban": true, "mute": true, "op": true, "export": true, "import": true}
+
+// Function to check an imported audit entry could have been written by this server, and move it into channel.
+// Its target is a user, or for an import, the channel imported from; both follow the naming rules.
+func checkImportedAudit(channel string, entry *pb.AuditEntry) error {
+	entry.Channel = channel
+	if ts := entry.GetTimestamp(); ts < 0 || ts >= maxImportLamport {
+		return status.Errorf(codes.InvalidArgument, "audit entry is at Lamport time %v, which this server can't go on from", ts)
+	}
+	if !auditActions[entry.GetAction()] {
+		return status.Errorf(codes.InvalidArgument, "audit entry has an unknown action %q", entry.GetAction())
+	}
+	if err := validateName("moderator", entry.GetModerator()); err != nil {
+		return err
+	}
+	if entry.GetTarget() != "" {
+		if err := validateName("target", entry.GetTarget()); err != nil {
+			return err
+		}
+	}
+	if !utf8.ValidString(entry.GetReason()) {
+		return status.Error(codes.InvalidArgument, "audit entry has a reason that is not valid UTF-8")
+	}
+	entry.Reason = stripControl(entry.GetReason())
+	return nil
+}
+
+// Function to check importer may import into channel
+func (s *chatServiceServer) canImport(ctx context.Context, channel, importer string) error {
+	if s.history.count(channel) > 0 {
+		return status.Errorf(codes.FailedPrecondition, "%v already has messages; import into a new channel", channel)
+	}
+	if s.moderation.hasOwner(channel) {
+		return s.needRole(ctx, channel, importer, owner)
+	}
+	return nil
+}
+
+// archive is an archive read by ImportChannel
+type archive struct {
+	header   *pb.ArchiveHeader
+	members  []*pb.ArchiveMember
+	audit    []*pb.AuditEntry
+	messages []*pb.Message
+}
+
+// Function to read and check the records of an archive, starting with record
+func readArchive(record *pb.ArchiveRecord, stream pb.ChatService_ImportChannelServer) (*archive, error) {
+	a := &archive{}
+	for {
+		if record != nil {
+			if err := a.add(record); err != nil {
+				return nil, err
+			}
+		}
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		record = chunk.GetRecord()
+	}
+	if a.header == nil {
+		return nil, status.Error(codes.InvalidArgument, "archive is empty")
+	}
+	return a, nil
+}
+
+func (a *archive) add(record *pb.ArchiveRecord) error {
+	if a.header == nil && record.GetHeader() == nil {
+		return status.Error(codes.InvalidArgument, "archive doesn't start with a header")
+	}
+	switch {
+	case record.GetHeader() != nil:
+		if a.header != nil {
+			return status.Error(codes.InvalidArgument, "archive has two headers")
+		}
+		if v := record.GetHeader().GetVersion(); v != archiveVersion {
+			return status.Errorf(codes.InvalidArgument, "archive is version %v, this server reads version %v", v, archiveVersion)
+		}
+		a.header = record.GetHeader()
+	case record.GetMember() != nil:
+		if err := validateName("user", record.GetMember().GetName()); err != nil {
+			return err
+		}
+		a.members = append(a.members, record.GetMember())
+	case record.GetAudit() != nil:
+		a.audit = append(a.audit, record.GetAudit())
+	case record.GetMessage() != nil:
+		msg := record.GetMessage()
+		if err := validateName("user", msg.GetSender()); err != nil {
+			return err
+		}
+		if !utf8.ValidString(msg.GetMessage()) {
+			return status.Errorf(codes.InvalidArgument, "message #%v is not valid UTF-8", msg.GetId())
+		}
+		if len(a.messages) == maxImportMessages {
+			return status.Errorf(codes.InvalidArgument, "archive has more than %v messages", maxImportMessages)
+		}
+		a.messages = append(a.messages, msg)
+	}
+	return nil
+}
+
+// Function to get copies of every message of a channel in the order they were sent, deleted ones without their old text
+func (h *history) export(channel string) []*pb.Message {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var messages []*pb.Message
+	for _, msg := range h.channels[channel] {
+		if msg.Event == pb.Event_DELETED && len(msg.Edits) > 0 {
+			messages = append(messages, deletedView(msg))
+		} else {
+			messages = append(messages, proto.Clone(msg).(*pb.Message))
+		}
+	}
+	return messages
+}
+
+// Function to count the messages of a channel
+func (h *history) count(channel string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.channels[channel])
+}
+
+// Function to add imported messages to channel, in order, giving them new ids and revisions;
+// replies are pointed at their parent's new id, or aren't replies anymore if it wasn't imported.
+// Refuses if channel has messages by now, all under one lock so none can come in halfway.
+func (h *history) restore(channel string, messages []*pb.Message) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.channels[channel]) > 0 {
+		return status.Errorf(codes.FailedPrecondition, "%v already has messages; import into a new channel", channel)
+	}
+	ids := make(map[string]string)
+	for _, msg := range messages {
+		old := msg.Id
+		h.lastID++
+		h.revision++
+		msg.Id = strconv.Itoa(h.lastID)
+		msg.Revision = h.revision
+		ids[old] = msg.Id
+		if parent, ok := ids[msg.ReplyTo]; ok {
+			msg.ReplyTo = parent
+		} else {
+			msg.ReplyTo = ""
+		}
+		h.put(msg)
+	}
+	return nil
+}
+
+// Function to get everyone with a role, ban or mute in channel, and who's in it, sorted by name
+func (m *moderation) export(channel string, online map[string]bool) []*pb.ArchiveMember {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.members(channel, online)
+}
+
+// Function to list everyone with a role, a ban or a mute in channel, and those online; m.mu must be held
+func (m *moderation) members(channel string, online map[string]bool) []*pb.ArchiveMember {
+	members := make(map[string]*pb.ArchiveMember)
+	get := func(name string) *pb.ArchiveMember {
+		if members[name] == nil {
+			members[name] = &pb.ArchiveMember{Name: name, Role: m.roles[channel][name].String(), Online: online[name]}
+		}
+		return members[name]
+	}
+	for name := range m.roles[channel] {
+		get(name)
+	}
+	for name := range online {
+		get(name)
+	}
+	for name, until := range m.bans[channel] {
+		member := get(name)
+		member.Banned = true
+		member.BannedUntil = unixOrZero(until)
+	}
+	for name, until := range m.mutes[channel] {
+		member := get(name)
+		member.Muted = true
+		member.MutedUntil = unixOrZero(until)
+	}
+
+	var list []*pb.ArchiveMember
+	for _, member := range members {
+		list = append(list, member)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Function to put back the roles, bans, mutes and audit log of an imported channel
+func (m *moderation) restore(channel string, members []*pb.ArchiveMember, audit []*pb.AuditEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.put(channel, members, audit)
+	m.save(channel)
+}
+
+// Function to add roles, bans, mutes and audit entries to channel; m.mu must be held
+func (m *moderation) put(channel string, members []*pb.ArchiveMember, audit []*pb.AuditEntry) {
+	for _, archived := range members {
+		name := archived.GetName()
+		var r role
+		switch archived.GetRole() {
+		case owner.String():
+			r = owner
+		case operator.String():
+			r = operator
+		}
+		if r != member {
+			if m.roles[channel] == nil {
+				m.roles[channel] = make(map[string]role)
+			}
+			m.roles[channel][name] = r
+		}
+		if archived.GetBanned() {
+			if m.bans[channel] == nil {
+				m.bans[channel] = make(map[string]time.Time)
+			}
+			m.bans[channel][name] = timeOrZero(archived.GetBannedUntil())
+		}
+		if archived.GetMuted() {
+			if m.mutes[channel] == nil {
+				m.mutes[channel] = make(map[string]time.Time)
+			}
+			m.mutes[channel][name] = timeOrZero(archived.GetMutedUntil())
+		}
+	}
+	for _, entry := range audit {
+		entry.Channel = channel
+		m.audit[channel] = append(m.audit[channel], entry)
+	}
+}
+
+// Function to check whether channel has an owner yet
+func (m *moderation) hasOwner(channel string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.roles[channel]
+	return ok
+}
+
+// Bans and mutes that never end are the zero time here, and 0 in archives
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func timeOrZero(unix int64) time.Time {
+	if unix == 0 {
+		return time.Time{}
+	}
+	return time.Unix(unix, 0)
+}
@@ -0,0 +1,304 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Size of the chunks files are downloaded in
+const attachmentChunkSize = 32 * 1024
+
+// Most files attached to a single message, and the longest file name
+const maxAttachments = 5
+const maxAttachmentName = 128
+
+// attachmentStore keeps uploaded files on disk, named by their SHA-256 checksum,
+// so a file uploaded twice is only stored once.
+// used keeps track of how much each user uploaded, against their quota. Next to each file is who uploaded it,
+// in <checksum>.owner, so used can be counted again when the server starts.
+// Without a dir, the server takes no uploads.
+type attachmentStore struct {
+	dir       string
+	maxFile   int64
+	userQuota int64
+	mu        sync.Mutex
+	used      map[string]int64
+}
+
+func newAttachmentStore(dir string, maxFile, userQuota int64) (*attachmentStore, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	a := &attachmentStore{dir: dir, maxFile: maxFile, userQuota: userQuota, used: make(map[string]int64)}
+	if err := a.count(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Function to add up how much each user has uploaded from the files in dir and who they're from.
+// Files without an owner, uploaded by an older server, count for nobody; uploads cut off by a stop are removed.
+func (a *attachmentStore) count() error {
+	if a.dir == "" {
+		return nil
+	}
+	return filepath.WalkDir(a.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		name := entry.Name()
+		if strings.HasPrefix(name, "upload-") {
+			return os.Remove(path)
+		}
+		if validateChecksum(name) != nil {
+			return nil
+		}
+		owner, err := os.ReadFile(a.ownerPath(name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		a.used[string(owner)] += info.Size()
+		return nil
+	})
+}
+
+// Function to get where the file with the given checksum is kept; files are spread over folders by their first two characters
+func (a *attachmentStore) path(sum string) string {
+	return filepath.Join(a.dir, sum[:2], sum)
+}
+
+// Function to get where the name of who uploaded the file with the given checksum is kept
+func (a *attachmentStore) ownerPath(sum string) string {
+	return a.path(sum) + ".owner"
+}
+
+// Function to check whether a file with the given checksum is stored, and get its size
+func (a *attachmentStore) stat(sum string) (int64, bool) {
+	if a.dir == "" {
+		return 0, false
+	}
+	info, err := os.Stat(a.path(sum))
+	if err != nil {
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+// Function to take size bytes off a user's quota; fails if they don't have that much left
+func (a *attachmentStore) reserve(user string, size int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.used[user]+size > a.userQuota {
+		return status.Errorf(codes.ResourceExhausted, "Upload quota exceeded, %v of %v bytes left", a.userQuota-a.used[user], a.userQuota)
+	}
+	a.used[user] += size
+	return nil
+}
+
+// Function to give back quota reserved for an upload that failed
+func (a *attachmentStore) release(user string, size int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.used[user] -= size
+}
+
+// Function to check a checksum is 64 lower case hex characters
+func validateChecksum(sum string) error {
+	if len(sum) != sha256.Size*2 || strings.Trim(sum, "0123456789abcdef") != "" {
+		return status.Errorf(codes.InvalidArgument, "%q is not a SHA-256 checksum", sum)
+	}
+	return nil
+}
+
+// Function to check an attachment's name and checksum
+func validateAttachment(info *pb.Attachment) error {
+	name := info.GetName()
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return status.Errorf(codes.InvalidArgument, "%q is not a file name", name)
+	}
+	if !utf8.ValidString(name) || utf8.RuneCountInString(name) > maxAttachmentName || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return status.Errorf(codes.InvalidArgument, "File name %q is too long or has invalid characters", name)
+	}
+	return validateChecksum(info.GetSha256())
+}
+
+// Function to check the files attached to a message have been uploaded; their sizes are set from the stored files
+func (a *attachmentStore) check(attachments []*pb.Attachment) error {
+	if len(attachments) > maxAttachments {
+		return status.Errorf(codes.InvalidArgument, "At most %v files can be attached to a message", maxAttachments)
+	}
+	for _, attachment := range attachments {
+		if err := validateAttachment(attachment); err != nil {
+			return err
+		}
+		size, ok := a.stat(attachment.GetSha256())
+		if !ok {
+			return status.Errorf(codes.InvalidArgument, "%v hasn't been uploaded", attachment.GetName())
+		}
+		attachment.Size = size
+	}
+	return nil
+}
+
+// UploadAttachment receives a file in chunks and stores it.
+// The first chunk says who's uploading, and the name, size and checksum of the file;
+// the file is only kept if what's received matches.
+func (s *chatServiceServer) UploadAttachment(stream pb.ChatService_UploadAttachmentServer) error {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "No file was sent")
+	}
+	if err != nil {
+		return err
+	}
+	if s.attachments.dir == "" {
+		return status.Error(codes.Unimplemented, "This server doesn't take files")
+	}
+	if err := validateChannel(first.GetChannel()); err != nil {
+		return err
+	}
+	info := first.GetInfo()
+	if err := validateAttachment(info); err != nil {
+		return err
+	}
+	if info.GetSize() < 0 || info.GetSize() > s.attachments.maxFile {
+		return status.Errorf(codes.InvalidArgument, "Files can be at most %v bytes", s.attachments.maxFile)
+	}
+	user := first.GetChannel().GetSendersName()
+	if err := s.checkBan(stream.Context(), first.GetChannel().GetName(), user); err != nil {
+		return err
+	}
+	// The quota is the caller's, when the server knows who that is, so another name doesn't get a new one
+	if who, ok := s.knownCaller(stream.Context()); ok {
+		user = who
+	}
+
+	attachment := &pb.Attachment{Name: info.GetName(), Size: info.GetSize(), Sha256: info.GetSha256()}
+
+	// Already have it; no need for the rest of the chunks
+	if _, ok := s.attachments.stat(info.GetSha256()); ok {
+		return stream.SendAndClose(attachment)
+	}
+
+	if err := s.attachments.reserve(user, info.GetSize()); err != nil {
+		return err
+	}
+	if err := s.attachments.receive(stream, first, info, user); err != nil {
+		s.attachments.release(user, info.GetSize())
+		return err
+	}
+	return stream.SendAndClose(attachment)
+}
+
+// Function to write the chunks of an upload to a temporary file, and move it into place, with who it's from, if it checks out
+func (a *attachmentStore) receive(stream pb.ChatService_UploadAttachmentServer, chunk *pb.AttachmentChunk, info *pb.Attachment, user string) error {
+	tmp, err := os.CreateTemp(a.dir, "upload-*")
+	if err != nil {
+		return status.Errorf(codes.Internal, "Cannot store file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	out := io.MultiWriter(tmp, hash)
+	var received int64
+	for {
+		received += int64(len(chunk.GetData()))
+		if received > info.GetSize() {
+			return status.Errorf(codes.InvalidArgument, "%v is bigger than the %v bytes announced", info.GetName(), info.GetSize())
+		}
+		if _, err := out.Write(chunk.GetData()); err != nil {
+			return status.Errorf(codes.Internal, "Cannot store file: %v", err)
+		}
+
+		chunk, err = stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if received != info.GetSize() {
+		return status.Errorf(codes.InvalidArgument, "%v is %v bytes, not the %v bytes announced", info.GetName(), received, info.GetSize())
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != info.GetSha256() {
+		return status.Errorf(codes.InvalidArgument, "Checksum of %v doesn't match, it was damaged on the way", info.GetName())
+	}
+	if err := tmp.Close(); err != nil {
+		return status.Errorf(codes.Internal, "Cannot store file: %v", err)
+	}
+
+	path := a.path(info.GetSha256())
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return status.Errorf(codes.Internal, "Cannot store file: %v", err)
+	}
+	if err := os.WriteFile(a.ownerPath(info.GetSha256()), []byte(user), 0644); err != nil {
+		return status.Errorf(codes.Internal, "Cannot store file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return status.Errorf(codes.Internal, "Cannot store file: %v", err)
+	}
+	return nil
+}
+
+// DownloadAttachment sends a stored file in chunks; the first chunk has its size and checksum
+func (s *chatServiceServer) DownloadAttachment(ref *pb.AttachmentRef, stream pb.ChatService_DownloadAttachmentServer) error {
+	if err := validateChecksum(ref.GetSha256()); err != nil {
+		return err
+	}
+	if s.attachments.dir == "" {
+		return status.Errorf(codes.NotFound, "There's no file %v", ref.GetSha256())
+	}
+	f, err := os.Open(s.attachments.path(ref.GetSha256()))
+	if err != nil {
+		return status.Errorf(codes.NotFound, "There's no file %v", ref.GetSha256())
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return status.Errorf(codes.Internal, "Cannot read file: %v", err)
+	}
+
+	chunk := &pb.AttachmentChunk{Info: &pb.Attachment{Size: info.Size(), Sha256: ref.GetSha256()}}
+	buf := make([]byte, attachmentChunkSize)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 || chunk.Info != nil {
+			chunk.Data = buf[:n]
+			if err := stream.Send(chunk); err != nil {
+				return err
+			}
+			chunk = &pb.AttachmentChunk{}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "Cannot read file: %v", err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package server_test
+
+import (
+	pb "ChittyChat/proto"
+	"ChittyChat/server"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Function to get the settings attachment tests run with: files in dir, of at most 1 KiB, and 2 KiB per user
+func attachmentConfig(dir string) server.Config {
+	cfg := testConfig()
+	cfg.AttachmentDir = dir
+	cfg.MaxFileSize = 1024
+	cfg.UserQuota = 2048
+	return cfg
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Function to upload data as name, as caller sending the name user, in chunks of 100 bytes, claiming the checksum sum
+func upload(c pb.ChatServiceClient, caller, user, name string, data []byte, sum string) (*pb.Attachment, error) {
+	stream, err := c.UploadAttachment(as(caller))
+	if err != nil {
+		return nil, err
+	}
+	chunk := &pb.AttachmentChunk{
+		Channel: &pb.Channel{Name: "Eepy", SendersName: user},
+		Info:    &pb.Attachment{Name: name, Size: int64(len(data)), Sha256: sum},
+	}
+	for len(data) > 100 {
+		chunk.Data = data[:100]
+		if err := stream.Send(chunk); err != nil {
+			break
+		}
+		chunk, data = &pb.AttachmentChunk{}, data[100:]
+	}
+	chunk.Data = data
+	stream.Send(chunk)
+	return stream.CloseAndRecv()
+}
+
+// Function to download the file with checksum sum
+func download(c pb.ChatServiceClient, sum string) ([]byte, error) {
+	stream, err := c.DownloadAttachment(as("Bob"), &pb.AttachmentRef{Sha256: sum})
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, chunk.GetData()...)
+	}
+}
+
+func TestUploadAndDownload(t *testing.T) {
+	_, c := startServer(t, server.WithConfig(attachmentConfig(t.TempDir())))
+	anon := joined(t, c, "Eepy", "Anon")
+
+	data := bytes.Repeat([]byte("cat picture "), 50)
+	attachment, err := upload(c, "Anon", "Anon", "cat.png", data, checksum(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attachment.GetSize() != int64(len(data)) || attachment.GetSha256() != checksum(data) {
+		t.Errorf("upload returned %v, want the file's size and checksum", attachment)
+	}
+
+	msg := message("Eepy", "Anon", "look")
+	msg.Attachments = []*pb.Attachment{{Name: "cat.png", Sha256: attachment.GetSha256()}}
+	if err := send(c, msg); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, anon, "look").GetAttachments(); len(got) != 1 || got[0].GetSize() != int64(len(data)) {
+		t.Errorf("the message came with %v, want the file with its size", got)
+	}
+
+	got, err := download(c, attachment.GetSha256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("downloaded %v bytes that aren't what was uploaded", len(got))
+	}
+	if _, err := download(c, checksum([]byte("never uploaded"))); status.Code(err) != codes.NotFound {
+		t.Errorf("downloading a file that isn't there returned %v, want NotFound", err)
+	}
+}
+
+func TestUploadChecks(t *testing.T) {
+	_, c := startServer(t, server.WithConfig(attachmentConfig(t.TempDir())))
+	data := []byte("some bytes")
+
+	if _, err := upload(c, "Anon", "Anon", "a.txt", data, checksum([]byte("other bytes"))); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("uploading with the wrong checksum returned %v, want InvalidArgument", err)
+	}
+	if _, err := download(c, checksum([]byte("other bytes"))); status.Code(err) != codes.NotFound {
+		t.Errorf("a damaged upload can be downloaded: %v", err)
+	}
+	big := make([]byte, 2000)
+	if _, err := upload(c, "Anon", "Anon", "big.bin", big, checksum(big)); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("uploading a file over the size limit returned %v, want InvalidArgument", err)
+	}
+	if _, err := upload(c, "Anon", "Anon", "../a.txt", data, checksum(data)); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("uploading a path returned %v, want InvalidArgument", err)
+	}
+}
+
+func TestUploadQuota(t *testing.T) {
+	dir := t.TempDir()
+	_, c := startServer(t, server.WithConfig(attachmentConfig(dir)), server.WithIdentity(testIdentity))
+
+	// Two files of 1000 bytes fit in 2 KiB, a third doesn't, also not under another name
+	files := make([][]byte, 4)
+	for i := range files {
+		files[i] = bytes.Repeat([]byte{byte('a' + i)}, 1000)
+	}
+	for _, file := range files[:2] {
+		if _, err := upload(c, "Anon", "Anon", "file", file, checksum(file)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := upload(c, "Anon", "Anon", "file", files[2], checksum(files[2])); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("uploading past the quota returned %v, want ResourceExhausted", err)
+	}
+	if _, err := upload(c, "Anon", "Nona", "file", files[2], checksum(files[2])); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("uploading past the quota under another name returned %v, want ResourceExhausted", err)
+	}
+	// A file that's already there costs nothing
+	if _, err := upload(c, "Anon", "Anon", "again", files[0], checksum(files[0])); err != nil {
+		t.Errorf("uploading a stored file again returned %v", err)
+	}
+	if _, err := upload(c, "Bob", "Bob", "file", files[2], checksum(files[2])); err != nil {
+		t.Errorf("Bob uploading returned %v", err)
+	}
+
+	// After a restart, what Anon uploaded still counts
+	_, c = startServer(t, server.WithConfig(attachmentConfig(dir)), server.WithIdentity(testIdentity))
+	if _, err := upload(c, "Anon", "Anon", "file", files[3], checksum(files[3])); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("uploading past the quota after a restart returned %v, want ResourceExhausted", err)
+	}
+}
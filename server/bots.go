@@ -0,0 +1,100 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"fmt"
+	"log"
+)
+
+// Bot is a user that lives inside the server. It's a member of its channels like a client,
+// gets everything sent to them and can answer with say.
+type Bot interface {
+	// Receive is called with each message, edit, reaction and announcement in the bot's channels, one at a time,
+	// except for the bot's own messages.
+	Receive(say Say, msg *pb.Message)
+}
+
+// BotFunc lets a plain function be a Bot
+type BotFunc func(say Say, msg *pb.Message)
+
+func (f BotFunc) Receive(say Say, msg *pb.Message) {
+	f(say, msg)
+}
+
+// Say sends text to channel as the bot. It goes through the same checks as a client's message, so it can be refused,
+// e.g. when it's too long or the bot is muted.
+type Say func(channel, text string) error
+
+// registeredBot is a bot and the channels it's in
+type registeredBot struct {
+	name     string
+	channels []string
+	bot      Bot
+}
+
+// Function to check the bots' names and channels before the server starts
+func validateBots(bots []registeredBot) error {
+	names := make(map[string]bool)
+	for _, b := range bots {
+		if err := validateName("bot", b.name); err != nil {
+			return err
+		}
+		if names[b.name] {
+			return fmt.Errorf("two bots are called %v", b.name)
+		}
+		names[b.name] = true
+		for _, channel := range b.channels {
+			if err := validateName("channel", channel); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Function to put a bot in its channels; it stays until stop is closed or it's kicked
+func (s *chatServiceServer) startBot(b registeredBot, stop <-chan struct{}) {
+	say := func(channel, text string) error {
+		msg := &pb.Message{Sender: b.name, Channel: &pb.Channel{Name: channel, SendersName: b.name}, Message: text}
+		if err := s.accept(msg); err != nil {
+			return err
+		}
+		s.publish(msg)
+		return nil
+	}
+
+	for _, channel := range b.channels {
+		ch := &pb.Channel{Name: channel, SendersName: b.name}
+		s.mentions.addUser(b.name)
+
+		// The bot is fed by the same fan-out as the clients' streams
+		client := &clientStream{
+			name:     b.name,
+			messages: make(chan *pb.Message),
+			kicked:   make(chan string, 1),
+			done:     make(chan struct{}),
+		}
+		s.mu.Lock()
+		s.channel[channel] = append(s.channel[channel], client)
+		s.mu.Unlock()
+
+		go func() {
+			defer close(client.done)
+			for {
+				select {
+				case <-stop:
+					s.removeChannel(ch, client)
+					return
+				case reason := <-client.kicked:
+					s.removeChannel(ch, client)
+					log.Printf("Bot %v was removed from %v: %v\n", b.name, ch.GetName(), reason)
+					return
+				case msg := <-client.messages:
+					if msg.GetSender() != b.name || msg.GetEvent() != pb.Event_MESSAGE {
+						b.bot.Receive(say, msg)
+					}
+				}
+			}
+		}()
+	}
+}
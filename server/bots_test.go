@@ -0,0 +1,63 @@
+package server_test
+
+import (
+	pb "ChittyChat/proto"
+	"ChittyChat/server"
+	"strings"
+	"testing"
+)
+
+func TestBotAnswers(t *testing.T) {
+	refused := make(chan error, 1)
+	echo := server.BotFunc(func(say server.Say, msg *pb.Message) {
+		text, ok := strings.CutPrefix(msg.GetMessage(), "!echo ")
+		if !ok {
+			return
+		}
+		if text == "long" {
+			refused <- say(msg.GetChannel().GetName(), strings.Repeat("x", 10000))
+			return
+		}
+		// Were the bot given its own message, this would go on forever
+		if err := say(msg.GetChannel().GetName(), "!echo "+text); err != nil {
+			t.Error(err)
+		}
+	})
+	_, c := startServer(t, server.WithBot("Echo", []string{"Eepy"}, echo))
+	anon := joined(t, c, "Eepy", "Anon")
+	listed(t, c, "Eepy", "Echo")
+
+	if err := send(c, message("Eepy", "Anon", "!echo hi")); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, anon, "!echo hi")
+	if got := receive(t, anon, "!echo hi"); got.GetSender() != "Echo" || got.GetId() == "" || got.GetTimestamp() == 0 {
+		t.Errorf("bot's answer is %v, want a message from Echo like any other", got)
+	}
+
+	// What the bot says is checked like a client's message
+	if err := send(c, message("Eepy", "Anon", "!echo long")); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-refused; err == nil {
+		t.Error("bot could send a message that's too long")
+	}
+}
+
+func TestBotsAreChecked(t *testing.T) {
+	for _, tt := range []struct {
+		why  string
+		opts []server.Option
+	}{
+		{why: "invalid name", opts: []server.Option{server.WithBot("Echo Bot", []string{"Eepy"}, server.BotFunc(nil))}},
+		{why: "invalid channel", opts: []server.Option{server.WithBot("Echo", []string{"#Eepy"}, server.BotFunc(nil))}},
+		{why: "same name twice", opts: []server.Option{
+			server.WithBot("Echo", []string{"Eepy"}, server.BotFunc(nil)),
+			server.WithBot("Echo", []string{"Dev"}, server.BotFunc(nil)),
+		}},
+	} {
+		if _, err := server.New(tt.opts...); err == nil {
+			t.Errorf("%v: New accepted the bot", tt.why)
+		}
+	}
+}
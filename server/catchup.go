@@ -0,0 +1,34 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"context"
+)
+
+// Most messages GetHistory sends at once
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// GetHistory returns what changed in a channel since the revision the client last saw,
+// so a client coming back only gets what it missed. Banned users get nothing.
+func (s *chatServiceServer) GetHistory(ctx context.Context, req *pb.HistoryRequest) (*pb.History, error) {
+	if err := validateChannel(req.GetChannel()); err != nil {
+		return nil, err
+	}
+	if err := s.checkBan(ctx, req.GetChannel().GetName(), req.GetChannel().GetSendersName()); err != nil {
+		return nil, err
+	}
+
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	messages, revision := s.history.since(req.GetChannel().GetName(), req.GetSinceRevision(), limit, s.now().Unix())
+	return &pb.History{Messages: messages, Revision: revision}, nil
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"context"
+	"sort"
+)
+
+// ListChannels returns every channel someone is in, with its members sorted by name.
+// A user connected more than once is only listed once.
+func (s *chatServiceServer) ListChannels(ctx context.Context, ch *pb.Channel) (*pb.ChannelList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := &pb.ChannelList{}
+	for name, clients := range s.channel {
+		if len(clients) == 0 {
+			continue
+		}
+		seen := make(map[string]bool)
+		info := &pb.ChannelInfo{Name: name}
+		for _, client := range clients {
+			if !seen[client.name] {
+				seen[client.name] = true
+				info.Members = append(info.Members, client.name)
+			}
+		}
+		sort.Strings(info.Members)
+		list.Channels = append(list.Channels, info)
+	}
+	sort.Slice(list.Channels, func(i, j int) bool { return list.Channels[i].Name < list.Channels[j].Name })
+	return list, nil
+}
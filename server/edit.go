@@ -0,0 +1,106 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Function to check editor may change msg: they wrote it, or they moderate the channel.
+// Only a caller the server knows is the author counts as them; without WithIdentity, the name sent is all it has to go on.
+func (s *chatServiceServer) canEdit(ctx context.Context, msg *pb.Message, editor string) error {
+	if msg.GetSender() == editor && s.isCaller(ctx, editor) {
+		return nil
+	}
+	if s.callerRole(ctx, msg.GetChannel().GetName(), editor) >= operator {
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied, "Only %v or a moderator can change message #%v", msg.GetSender(), msg.GetId())
+}
+
+// EditMessage replaces the text of a message and tells the channel about it
+func (s *chatServiceServer) EditMessage(ctx context.Context, req *pb.EditRequest) (*pb.MessageAck, error) {
+	if err := validateChannel(req.GetChannel()); err != nil {
+		return nil, err
+	}
+	channel, editor := req.GetChannel().GetName(), req.GetChannel().GetSendersName()
+
+	original, err := s.history.get(channel, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.canEdit(ctx, original, editor); err != nil {
+		return nil, err
+	}
+
+	// The new text goes through the same checks as a new message would
+	edited := &pb.Message{Sender: editor, Channel: req.GetChannel(), Message: req.GetMessage(), Timestamp: req.GetTimestamp()}
+	if err := s.limits.validateMessage(edited); err != nil {
+		return nil, err
+	}
+	if err := s.checkBan(ctx, channel, editor); err != nil {
+		return nil, err
+	}
+	if err := s.checkMute(ctx, channel, editor); err != nil {
+		return nil, err
+	}
+	if err := s.filters.process(edited); err != nil {
+		return nil, err
+	}
+
+	s.incrLamport(edited)
+
+	mentions := s.mentions.parse(edited.GetMessage())
+	event, err := s.history.edit(channel, req.GetId(), editor, edited.GetMessage(), mentions, edited.GetTimestamp())
+	if err != nil {
+		return nil, err
+	}
+	s.search.index(event)
+	s.mentions.update(event)
+	s.sendMsgToClients(event)
+
+	return &pb.MessageAck{Status: "Edited"}, nil
+}
+
+// DeleteMessage removes a message and tells the channel about it
+func (s *chatServiceServer) DeleteMessage(ctx context.Context, req *pb.EditRequest) (*pb.MessageAck, error) {
+	if err := validateChannel(req.GetChannel()); err != nil {
+		return nil, err
+	}
+	channel, editor := req.GetChannel().GetName(), req.GetChannel().GetSendersName()
+
+	original, err := s.history.get(channel, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.canEdit(ctx, original, editor); err != nil {
+		return nil, err
+	}
+
+	received := &pb.Message{Timestamp: req.GetTimestamp()}
+	s.incrLamport(received)
+
+	event, err := s.history.delete(channel, req.GetId(), editor, received.GetTimestamp())
+	if err != nil {
+		return nil, err
+	}
+	s.search.unindex(event.GetId())
+	s.mentions.forget(event.GetId())
+	s.sendMsgToClients(event)
+
+	return &pb.MessageAck{Status: "Deleted"}, nil
+}
+
+// GetThread returns the thread a message is part of
+func (s *chatServiceServer) GetThread(ctx context.Context, ref *pb.MessageRef) (*pb.Thread, error) {
+	if err := validateChannel(ref.GetChannel()); err != nil {
+		return nil, err
+	}
+	messages, err := s.history.thread(ref.GetChannel().GetName(), ref.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.Thread{Messages: messages}, nil
+}
@@ -0,0 +1,292 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Verdict is what a filter decides about a message
+type Verdict int
+
+const (
+	Accepted Verdict = iota // pass the message on, possibly rewritten
+	Flagged                 // pass the message on, but log it for the moderators
+	Rejected                // refuse the message
+)
+
+// Filter is a single stage of a channel's message pipeline.
+// Filter may rewrite msg in place; reason explains a flag or reject, and is shown to the sender when rejected.
+type Filter interface {
+	Filter(msg *pb.Message) (v Verdict, reason string)
+}
+
+// FilterSettings is what the server hands a FilterFactory: the -blocklist words and the server's clock
+type FilterSettings struct {
+	Blocklist []string
+	Now       func() time.Time
+}
+
+// FilterFactory makes a new filter; every channel gets its own instance so filters can keep state
+type FilterFactory func(settings FilterSettings) Filter
+
+// filterRegistry holds every filter a pipeline can be built from, by name.
+// Filters are added with RegisterFilter, from an init function.
+var filterRegistry = map[string]FilterFactory{}
+
+// RegisterFilter makes a filter available to pipelines under name, for -filters, -channel-filters and Config.Filters.
+// Call it from an init function, before parsing flags or making a server; registering a name twice panics.
+func RegisterFilter(name string, factory FilterFactory) {
+	if _, ok := filterRegistry[name]; ok {
+		panic("filter registered twice: " + name)
+	}
+	filterRegistry[name] = factory
+}
+
+func init() {
+	RegisterFilter("blocklist", func(settings FilterSettings) Filter { return newBlocklistFilter(settings.Blocklist) })
+	RegisterFilter("links", func(settings FilterSettings) Filter { return &linkFilter{} })
+	RegisterFilter("spam", func(settings FilterSettings) Filter { return newSpamFilter(settings.Now) })
+}
+
+// filterConfig is the ordered list of filters each channel runs messages through.
+// Channels without their own list use the default one.
+type filterConfig struct {
+	defaultFilters []string
+	channelFilters ChannelFilters
+	blocklist      []string
+	now            func() time.Time
+}
+
+// ChannelFilters maps a channel to the filters its messages go through, in order.
+// String and Set let it be given as a flag, e.g. -channel-filters Kids=blocklist,links,spam.
+// The flag can be repeated for more channels, and "none" turns filtering off for a channel.
+type ChannelFilters map[string][]string
+
+func (c ChannelFilters) String() string {
+	var parts []string
+	for name, filters := range c {
+		parts = append(parts, fmt.Sprintf("%v=%v", name, strings.Join(filters, ",")))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
+
+func (c ChannelFilters) Set(value string) error {
+	name, list, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected channel=filter,filter..., got %q", value)
+	}
+	filters, err := ParseFilterList(list)
+	if err != nil {
+		return err
+	}
+	c[name] = filters
+	return nil
+}
+
+// ParseFilterList parses a comma separated list of filter names; "none" is no filters
+func ParseFilterList(list string) ([]string, error) {
+	if list == "" || list == "none" {
+		return nil, nil
+	}
+	filters := strings.Split(list, ",")
+	for _, name := range filters {
+		if _, ok := filterRegistry[name]; !ok {
+			return nil, fmt.Errorf("unknown filter %q", name)
+		}
+	}
+	return filters, nil
+}
+
+// pipelines builds and runs the filter pipeline of each channel
+type pipelines struct {
+	mu        sync.Mutex
+	cfg       *filterConfig
+	byChannel map[string][]namedFilter
+}
+
+type namedFilter struct {
+	name   string
+	filter Filter
+}
+
+func newPipelines(cfg *filterConfig) *pipelines {
+	return &pipelines{cfg: cfg, byChannel: make(map[string][]namedFilter)}
+}
+
+// Function to get the filters of a channel, building them the first time
+func (p *pipelines) forChannel(channel string) []namedFilter {
+	if stages, ok := p.byChannel[channel]; ok {
+		return stages
+	}
+	names, ok := p.cfg.channelFilters[channel]
+	if !ok {
+		names = p.cfg.defaultFilters
+	}
+	settings := FilterSettings{Blocklist: p.cfg.blocklist, Now: p.cfg.now}
+	var stages []namedFilter
+	for _, name := range names {
+		stages = append(stages, namedFilter{name: name, filter: filterRegistry[name](settings)})
+	}
+	p.byChannel[channel] = stages
+	return stages
+}
+
+// Function to run a message through its channel's filters in order.
+// Stops at the first filter that rejects the message, returning an InvalidArgument error.
+func (p *pipelines) process(msg *pb.Message) error {
+	if msg.GetMessage() == joinMessage {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, stage := range p.forChannel(msg.GetChannel().GetName()) {
+		v, reason := stage.filter.Filter(msg)
+		switch v {
+		case Flagged:
+			log.Printf("Flagged by %v filter: [%v] in %v: %v (%v)\n", stage.name, msg.GetSender(), msg.GetChannel().GetName(), msg.GetMessage(), reason)
+		case Rejected:
+			log.Printf("Rejected by %v filter: [%v] in %v: %v (%v)\n", stage.name, msg.GetSender(), msg.GetChannel().GetName(), msg.GetMessage(), reason)
+			return status.Errorf(codes.InvalidArgument, "Message blocked by the %v filter: %v", stage.name, reason)
+		}
+	}
+
+	// A filter may have rewritten the message to nothing
+	if strings.TrimSpace(msg.GetMessage()) == "" && len(msg.GetAttachments()) == 0 {
+		return status.Error(codes.InvalidArgument, "message is empty after filtering")
+	}
+	return nil
+}
+
+// blocklistFilter masks blocked words with asterisks
+type blocklistFilter struct {
+	pattern *regexp.Regexp
+}
+
+func newBlocklistFilter(words []string) *blocklistFilter {
+	if len(words) == 0 {
+		return &blocklistFilter{}
+	}
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+	return &blocklistFilter{pattern: regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)}
+}
+
+func (f *blocklistFilter) Filter(msg *pb.Message) (Verdict, string) {
+	if f.pattern == nil || !f.pattern.MatchString(msg.Message) {
+		return Accepted, ""
+	}
+	msg.Message = f.pattern.ReplaceAllStringFunc(msg.Message, func(word string) string {
+		return strings.Repeat("*", len([]rune(word)))
+	})
+	return Flagged, "blocked word"
+}
+
+// linkFilter strips links from messages
+type linkFilter struct{}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(https?://|www\.)\S+`)
+
+func (f *linkFilter) Filter(msg *pb.Message) (Verdict, string) {
+	if !linkPattern.MatchString(msg.Message) {
+		return Accepted, ""
+	}
+	msg.Message = linkPattern.ReplaceAllString(msg.Message, "[link removed]")
+	return Accepted, ""
+}
+
+// spamFilter rejects a sender repeating themselves back to back, squashes floods of the same letter
+// and flags messages shouted in capitals
+type spamFilter struct {
+	lastMessage map[string]sentMessage
+	lastSweep   time.Time
+	now         func() time.Time
+}
+
+type sentMessage struct {
+	text string
+	at   time.Time
+}
+
+// How long a sender has to wait before repeating the same message
+const spamRepeatWindow = 30 * time.Second
+
+// Longest run of the same letter let through; longer runs are cut down to this
+const spamMaxRun = 3
+
+func newSpamFilter(now func() time.Time) *spamFilter {
+	return &spamFilter{lastMessage: make(map[string]sentMessage), lastSweep: now(), now: now}
+}
+
+// Function to forget the last messages of senders who've been quiet for longer than the repeat window,
+// as they can send them again anyway, so the map doesn't keep every sender the channel ever had
+func (f *spamFilter) sweep(now time.Time) {
+	if now.Sub(f.lastSweep) < spamRepeatWindow {
+		return
+	}
+	f.lastSweep = now
+	for sender, last := range f.lastMessage {
+		if now.Sub(last.at) >= spamRepeatWindow {
+			delete(f.lastMessage, sender)
+		}
+	}
+}
+
+func (f *spamFilter) Filter(msg *pb.Message) (Verdict, string) {
+	now := f.now()
+	f.sweep(now)
+	normalized := strings.ToLower(strings.TrimSpace(msg.Message))
+	last, ok := f.lastMessage[msg.Sender]
+	f.lastMessage[msg.Sender] = sentMessage{text: normalized, at: now}
+	if ok && normalized != "" && last.text == normalized && now.Sub(last.at) < spamRepeatWindow {
+		return Rejected, "you just sent that"
+	}
+
+	msg.Message = squashRuns(msg.Message, spamMaxRun)
+
+	letters, upper := 0, 0
+	for _, r := range msg.Message {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	if letters >= 10 && upper*10 >= letters*8 {
+		return Flagged, "shouting"
+	}
+	return Accepted, ""
+}
+
+// Function to cut runs of the same letter longer than max down to max
+func squashRuns(text string, max int) string {
+	var b strings.Builder
+	var prev rune
+	run := 0
+	for _, r := range text {
+		if r == prev {
+			run++
+		} else {
+			prev, run = r, 1
+		}
+		if run <= max || !unicode.IsLetter(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
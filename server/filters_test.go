@@ -0,0 +1,29 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"testing"
+	"time"
+)
+
+func TestSpamFilterForgetsQuietSenders(t *testing.T) {
+	now := time.Unix(0, 0)
+	f := newSpamFilter(func() time.Time { return now })
+
+	for _, sender := range []string{"Anon", "Bob", "Carol"} {
+		f.Filter(&pb.Message{Sender: sender, Message: "hi"})
+	}
+	if v, _ := f.Filter(&pb.Message{Sender: "Anon", Message: "hi"}); v != Rejected {
+		t.Errorf("repeating a message right away got %v, want Rejected", v)
+	}
+
+	// Once the window has gone by, only the senders still talking are remembered
+	now = now.Add(spamRepeatWindow)
+	f.Filter(&pb.Message{Sender: "Bob", Message: "still here"})
+	if len(f.lastMessage) != 1 {
+		t.Errorf("spam filter remembers %v senders after the window, want only Bob", len(f.lastMessage))
+	}
+	if v, _ := f.Filter(&pb.Message{Sender: "Anon", Message: "hi"}); v != Accepted {
+		t.Errorf("repeating a message after the window got %v, want Accepted", v)
+	}
+}
@@ -0,0 +1,285 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// The gateway lets clients that can't speak gRPC, like browsers and scripts, use ChatService over HTTP:
+//
+//	GET  /api/channels                                                 the channels and who's in them
+//	GET  /api/channels/<channel>/messages?user=<name>&since=&limit=    what changed since a revision, like GetHistory
+//	POST /api/channels/<channel>/messages                              sends a message, e.g. {"sender": "Anon", "message": "hi"}
+//	GET  /api/channels/<channel>/live?user=<name>                      a WebSocket carrying the channel's JoinChannel stream
+//
+// Messages are the protobuf Message as JSON. Everything goes through the same hub, checks and Lamport clock as gRPC.
+const gatewayPath = "/api/channels"
+
+// Function to route a gateway request to its endpoint
+func (s *chatServiceServer) serveGateway(rw http.ResponseWriter, req *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(req.URL.Path, gatewayPath), "/")
+	if rest == "" {
+		s.gatewayChannels(rw, req)
+		return
+	}
+	channel, endpoint, _ := strings.Cut(rest, "/")
+	switch endpoint {
+	case "messages":
+		if req.Method == http.MethodPost {
+			s.gatewaySend(rw, req, channel)
+		} else {
+			s.gatewayHistory(rw, req, channel)
+		}
+	case "live":
+		s.gatewayLive(rw, req, channel)
+	default:
+		http.NotFound(rw, req)
+	}
+}
+
+// Function to run a gateway call past the AuthFunc like the gRPC call it stands for, with the HTTP headers as metadata
+func (s *chatServiceServer) authorizeHTTP(req *http.Request, method string) (context.Context, error) {
+	md := metadata.MD{}
+	for key, values := range req.Header {
+		md.Append(strings.ToLower(key), values...)
+	}
+	ctx := metadata.NewIncomingContext(req.Context(), md)
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: remoteAddr(req.RemoteAddr)})
+	if s.auth == nil {
+		return ctx, nil
+	}
+	return ctx, s.auth.check(ctx, "/"+pb.ChatService_ServiceDesc.ServiceName+"/"+method)
+}
+
+// Function to tell who a gateway client is: the user the server knows is calling (see WithIdentity), or else the name they give
+func (s *chatServiceServer) gatewayUser(ctx context.Context, name string) string {
+	if who, ok := s.knownCaller(ctx); ok {
+		return who
+	}
+	return name
+}
+
+// remoteAddr is the address an HTTP request came from, as the peer of the call it stands for
+type remoteAddr string
+
+func (a remoteAddr) Network() string {
+	return "tcp"
+}
+
+func (a remoteAddr) String() string {
+	return string(a)
+}
+
+func (s *chatServiceServer) gatewayChannels(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeHTTPError(rw, status.Error(codes.Unimplemented, "channels are listed with GET"))
+		return
+	}
+	ctx, err := s.authorizeHTTP(req, "ListChannels")
+	if err != nil {
+		writeHTTPError(rw, err)
+		return
+	}
+	list, err := s.ListChannels(ctx, &pb.Channel{})
+	writeJSON(rw, list, err)
+}
+
+func (s *chatServiceServer) gatewayHistory(rw http.ResponseWriter, req *http.Request, channel string) {
+	if req.Method != http.MethodGet {
+		writeHTTPError(rw, status.Error(codes.Unimplemented, "messages are listed with GET and sent with POST"))
+		return
+	}
+	ctx, err := s.authorizeHTTP(req, "GetHistory")
+	if err != nil {
+		writeHTTPError(rw, err)
+		return
+	}
+	query := req.URL.Query()
+	since, _ := strconv.ParseInt(query.Get("since"), 10, 64)
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	history, err := s.GetHistory(ctx, &pb.HistoryRequest{
+		Channel:       &pb.Channel{Name: channel, SendersName: s.gatewayUser(ctx, query.Get("user"))},
+		SinceRevision: since,
+		Limit:         int32(limit),
+	})
+	writeJSON(rw, history, err)
+}
+
+func (s *chatServiceServer) gatewaySend(rw http.ResponseWriter, req *http.Request, channel string) {
+	ctx, err := s.authorizeHTTP(req, "SendMessage")
+	if err != nil {
+		writeHTTPError(rw, err)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(rw, req.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	msg := &pb.Message{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, msg); err != nil {
+		http.Error(rw, "invalid message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if seconds, err := s.send(ctx, msg, channel, s.gatewayUser(ctx, msg.GetSender())); err != nil {
+		if seconds > 0 {
+			rw.Header().Set("Retry-After", strconv.Itoa(seconds))
+		}
+		writeHTTPError(rw, err)
+		return
+	}
+	writeJSON(rw, msg, nil)
+}
+
+// Function to send a message from a gateway client: it's rate limited, checked and published like one sent with SendMessage.
+// ctx is the call it stands for, which tells who's sending. When it's over the rate limit, the seconds to wait are returned too.
+func (s *chatServiceServer) send(ctx context.Context, msg *pb.Message, channel, user string) (int, error) {
+	msg.Sender = user
+	msg.Channel = &pb.Channel{Name: channel, SendersName: user}
+	if seconds, err := s.limiter.throttle(s.limiter.caller(ctx), user, channel); err != nil {
+		return seconds, err
+	}
+	if err := s.accept(msg); err != nil {
+		return 0, err
+	}
+	s.publish(msg)
+	return 0, nil
+}
+
+// Function to carry a channel's JoinChannel stream over a WebSocket. The server sends each message as a text frame,
+// and refusals as {"error": "...", "code": "..."}; the client can send messages the same way.
+func (s *chatServiceServer) gatewayLive(rw http.ResponseWriter, req *http.Request, channel string) {
+	ctx, err := s.authorizeHTTP(req, "JoinChannel")
+	if err != nil {
+		writeHTTPError(rw, err)
+		return
+	}
+	user := s.gatewayUser(ctx, req.URL.Query().Get("user"))
+	ws := websocket.Server{
+		Handshake: sameOrigin,
+		Handler: func(ws *websocket.Conn) {
+			s.live(ctx, ws, &pb.Channel{Name: channel, SendersName: user})
+		},
+	}
+	ws.ServeHTTP(rw, req)
+}
+
+// Function to only take WebSockets opened from pages served by this server, so another site open in someone's browser
+// can't chat as them. Clients that aren't browsers may leave the Origin out.
+func sameOrigin(config *websocket.Config, req *http.Request) error {
+	origin, err := websocket.Origin(config, req)
+	if err != nil {
+		return err
+	}
+	if origin != nil && origin.Host != req.Host {
+		return fmt.Errorf("WebSockets from %v aren't allowed", origin)
+	}
+	config.Origin = origin
+	return nil
+}
+
+func (s *chatServiceServer) live(call context.Context, ws *websocket.Conn, ch *pb.Channel) {
+	defer ws.Close()
+	ctx, cancel := context.WithCancel(call)
+	defer cancel()
+	stream := &liveStream{ctx: ctx, ws: ws}
+
+	// Join like a gRPC client would: the stream first, then the announcement
+	joined := make(chan error, 1)
+	go func() {
+		err := s.JoinChannel(ch, stream)
+		if err != nil {
+			stream.sendError(err)
+		}
+		// Ends the read loop below when the server ended the stream, e.g. on a kick
+		ws.Close()
+		joined <- err
+	}()
+	if _, err := s.send(ctx, &pb.Message{Message: joinMessage}, ch.GetName(), ch.GetSendersName()); err != nil {
+		stream.sendError(err)
+	}
+
+	for {
+		var frame string
+		if err := websocket.Message.Receive(ws, &frame); err != nil {
+			break
+		}
+		msg := &pb.Message{}
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal([]byte(frame), msg); err != nil {
+			stream.sendError(status.Errorf(codes.InvalidArgument, "invalid message: %v", err))
+			continue
+		}
+		if _, err := s.send(ctx, msg, ch.GetName(), ch.GetSendersName()); err != nil {
+			stream.sendError(err)
+		}
+	}
+
+	// The client went away, which ends JoinChannel like a closed gRPC stream
+	cancel()
+	<-joined
+}
+
+// liveStream lets JoinChannel send to a WebSocket as if it were a gRPC stream.
+// JoinChannel only uses Context and Send; the rest of grpc.ServerStream isn't there.
+type liveStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	ws  *websocket.Conn
+	mu  sync.Mutex
+}
+
+func (l *liveStream) Context() context.Context {
+	return l.ctx
+}
+
+func (l *liveStream) Send(msg *pb.Message) error {
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return websocket.Message.Send(l.ws, string(data))
+}
+
+func (l *liveStream) sendError(err error) {
+	data, _ := json.Marshal(map[string]string{"error": status.Convert(err).Message(), "code": status.Code(err).String()})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	websocket.Message.Send(l.ws, string(data))
+}
+
+// Function to answer with msg as JSON, or with err's HTTP status
+func writeJSON(rw http.ResponseWriter, msg proto.Message, err error) {
+	if err != nil {
+		writeHTTPError(rw, err)
+		return
+	}
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(data)
+}
+
+func writeHTTPError(rw http.ResponseWriter, err error) {
+	http.Error(rw, status.Convert(err).Message(), httpStatus(err))
+}
@@ -0,0 +1,122 @@
+package server_test
+
+import (
+	pb "ChittyChat/proto"
+	"ChittyChat/server"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Function to start a server with the gateway, returning the gRPC client and the gateway's URL
+func startGateway(t *testing.T, opts ...server.Option) (pb.ChatServiceClient, string) {
+	t.Helper()
+	srv, c := startServer(t, append([]server.Option{server.WithGateway()}, opts...)...)
+	web := httptest.NewServer(srv.HTTPHandler())
+	t.Cleanup(web.Close)
+	return c, web.URL
+}
+
+// Function to make an HTTP request to the gateway as user, returning the status and body
+func gatewayCall(t *testing.T, method, url, user, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("User", user)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(data)
+}
+
+func TestGatewaySendAndHistory(t *testing.T) {
+	c, url := startGateway(t)
+	anon := joined(t, c, "Eepy", "Anon")
+
+	code, body := gatewayCall(t, http.MethodPost, url+"/api/channels/Eepy/messages", "Bob", `{"sender": "Bob", "message": "hi from HTTP"}`)
+	if code != http.StatusOK {
+		t.Fatalf("POST returned %v: %v", code, body)
+	}
+	if got := receive(t, anon, "hi from HTTP"); got.GetSender() != "Bob" || got.GetTimestamp() == 0 {
+		t.Errorf("gRPC client received %v, want Bob's message with a Lamport time", got)
+	}
+
+	code, body = gatewayCall(t, http.MethodGet, url+"/api/channels/Eepy/messages?user=Bob", "Bob", "")
+	history := &pb.History{}
+	if err := protojson.Unmarshal([]byte(body), history); code != http.StatusOK || err != nil {
+		t.Fatalf("GET returned %v, %v: %v", code, err, body)
+	}
+	if msgs := history.GetMessages(); len(msgs) != 1 || msgs[0].GetMessage() != "hi from HTTP" {
+		t.Errorf("history is %v, want the message", msgs)
+	}
+
+	if code, _ := gatewayCall(t, http.MethodPost, url+"/api/channels/Eepy/messages", "Bob", `{"sender": "Bob", "message": ""}`); code != http.StatusBadRequest {
+		t.Errorf("POST of an empty message returned %v, want 400", code)
+	}
+	if code, _ := gatewayCall(t, http.MethodPost, url+"/api/channels/Eepy/messages", "Bob", `not json`); code != http.StatusBadRequest {
+		t.Errorf("POST of something that isn't JSON returned %v, want 400", code)
+	}
+}
+
+func TestGatewayUsesIdentity(t *testing.T) {
+	c, url := startGateway(t, server.WithIdentity(testIdentity))
+	anon := joined(t, c, "Eepy", "Anon")
+
+	// The sender is who the server knows is calling, not who the message says
+	if code, body := gatewayCall(t, http.MethodPost, url+"/api/channels/Eepy/messages", "Mallory", `{"sender": "Anon", "message": "not really Anon"}`); code != http.StatusOK {
+		t.Fatalf("POST returned %v: %v", code, body)
+	}
+	if got := receive(t, anon, "not really Anon"); got.GetSender() != "Mallory" {
+		t.Errorf("message is from %v, want Mallory", got.GetSender())
+	}
+}
+
+func TestGatewayWebSocket(t *testing.T) {
+	c, url := startGateway(t)
+	anon := joined(t, c, "Eepy", "Anon")
+	live := "ws" + strings.TrimPrefix(url, "http") + "/api/channels/Eepy/live?user=Bob"
+
+	// Another site can't open one in a visitor's browser
+	if _, err := websocket.Dial(live, "", "http://evil.example"); err == nil {
+		t.Error("WebSocket from another origin was accepted")
+	}
+
+	ws, err := websocket.Dial(live, "", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	listed(t, c, "Eepy", "Bob")
+
+	if err := websocket.Message.Send(ws, `{"message": "hi over WebSocket"}`); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, anon, "hi over WebSocket"); got.GetSender() != "Bob" {
+		t.Errorf("message is from %v, want Bob", got.GetSender())
+	}
+	if err := send(c, message("Eepy", "Anon", "hi Bob")); err != nil {
+		t.Fatal(err)
+	}
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var frame string
+		if err := websocket.Message.Receive(ws, &frame); err != nil {
+			t.Fatal(err)
+		}
+		msg := &pb.Message{}
+		if protojson.Unmarshal([]byte(frame), msg) == nil && msg.GetMessage() == "hi Bob" {
+			break
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"ChittyChat/storage"
+	"sort"
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// history keeps every message sent to each channel, so they can be referred to by id later.
+// Stored messages are copies; the ones handed out are copies too, so nobody shares them.
+// roots maps the id of a reply to the id of the message its thread started with.
+// revision counts every change to every message, so clients can ask for what changed since they last looked.
+// Every change is written to the store too, see persist.go.
+type history struct {
+	mu       sync.Mutex
+	lastID   int
+	revision int64
+	channels map[string][]*pb.Message
+	byID     map[string]*pb.Message
+	roots    map[string]string
+	store    storage.Store
+}
+
+func newHistory(store storage.Store) *history {
+	return &history{
+		channels: make(map[string][]*pb.Message),
+		byID:     make(map[string]*pb.Message),
+		roots:    make(map[string]string),
+		store:    store,
+	}
+}
+
+// Function to give a new message its id and revision
+func (h *history) assignID(msg *pb.Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID++
+	h.revision++
+	msg.Id = strconv.Itoa(h.lastID)
+	msg.Revision = h.revision
+}
+
+// Function to store a copy of a message in its channel's history
+func (h *history) add(msg *pb.Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.put(msg)
+}
+
+// Function to store a copy of a message without taking the lock; h.mu must be held
+func (h *history) put(msg *pb.Message) {
+	stored := proto.Clone(msg).(*pb.Message)
+	channel := stored.GetChannel().GetName()
+	h.channels[channel] = append(h.channels[channel], stored)
+	h.byID[stored.Id] = stored
+	if parent := stored.GetReplyTo(); parent != "" {
+		h.roots[stored.Id] = h.rootOf(parent)
+	}
+	h.save(stored)
+}
+
+// Function to get the id of the message the thread of id started with
+func (h *history) rootOf(id string) string {
+	if root, ok := h.roots[id]; ok {
+		return root
+	}
+	return id
+}
+
+// Function to get a thread: the message it started with, then every reply in the order they were sent.
+// id may be any message in the thread. Deleted messages are left in, emptied, so the thread still reads right.
+func (h *history) thread(channel, id string) ([]*pb.Message, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if msg, ok := h.byID[id]; !ok || msg.GetChannel().GetName() != channel {
+		return nil, status.Errorf(codes.NotFound, "There's no message #%v in %v", id, channel)
+	}
+
+	root := h.rootOf(id)
+	var thread []*pb.Message
+	for _, msg := range h.channels[channel] {
+		if msg.Id != root && h.roots[msg.Id] != root {
+			continue
+		}
+		shown := proto.Clone(msg).(*pb.Message)
+		if shown.Event == pb.Event_DELETED {
+			shown.Edits = nil
+		}
+		thread = append(thread, shown)
+	}
+	return thread, nil
+}
+
+// Function to look up a message by id; it must be in the given channel
+func (h *history) get(channel, id string) (*pb.Message, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	msg, err := h.lookup(channel, id)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Clone(msg).(*pb.Message), nil
+}
+
+func (h *history) lookup(channel, id string) (*pb.Message, error) {
+	msg, ok := h.byID[id]
+	if !ok || msg.GetChannel().GetName() != channel || msg.Event == pb.Event_DELETED {
+		return nil, status.Errorf(codes.NotFound, "There's no message #%v in %v", id, channel)
+	}
+	return msg, nil
+}
+
+// Function to replace the text of a message, and who it mentions, keeping the old text in its edits.
+// Returns the event to pass on to the channel.
+func (h *history) edit(channel, id, editor, text string, mentions []string, timestamp int32) (*pb.Message, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	msg, err := h.lookup(channel, id)
+	if err != nil {
+		return nil, err
+	}
+	msg.Edits = append(msg.Edits, &pb.Edit{Previous: msg.Message, Editor: editor, Timestamp: timestamp})
+	msg.Message = text
+	msg.Mentions = mentions
+	msg.Event = pb.Event_EDITED
+	h.revision++
+	msg.Revision = h.revision
+	h.save(msg)
+
+	event := proto.Clone(msg).(*pb.Message)
+	return event, nil
+}
+
+// Function to delete a message; it's kept, emptied, with its text in the edits.
+// Returns the event to pass on to the channel, which leaves out the old text.
+func (h *history) delete(channel, id, editor string, timestamp int32) (*pb.Message, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	msg, err := h.lookup(channel, id)
+	if err != nil {
+		return nil, err
+	}
+	msg.Edits = append(msg.Edits, &pb.Edit{Previous: msg.Message, Editor: editor, Timestamp: timestamp})
+	msg.Message = ""
+	msg.Event = pb.Event_DELETED
+	h.revision++
+	msg.Revision = h.revision
+	h.save(msg)
+
+	return deletedView(msg), nil
+}
+
+// Function to get a deleted message as it's passed on: without the old text kept in its edits
+func deletedView(msg *pb.Message) *pb.Message {
+	event := proto.Clone(msg).(*pb.Message)
+	last := msg.Edits[len(msg.Edits)-1]
+	event.Edits = []*pb.Edit{{Editor: last.Editor, Timestamp: last.Timestamp}}
+	return event
+}
+
+// Function to toggle user's emoji reaction on a message: added if they hadn't reacted with it, removed if they had.
+// Returns the event to pass on to the channel, and whether the reaction was added.
+func (h *history) react(channel, id, user, emoji string) (*pb.Message, bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	msg, err := h.lookup(channel, id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	added := toggleReaction(msg, user, emoji)
+	h.revision++
+	msg.Revision = h.revision
+	h.save(msg)
+
+	event := proto.Clone(msg).(*pb.Message)
+	event.Event = pb.Event_REACTED
+	event.Edits = nil
+	return event, added, nil
+}
+
+// Function to add or remove user from the users of an emoji; emojis nobody uses anymore are removed
+func toggleReaction(msg *pb.Message, user, emoji string) bool {
+	for i, reaction := range msg.Reactions {
+		if reaction.Emoji != emoji {
+			continue
+		}
+		for j, u := range reaction.Users {
+			if u == user {
+				reaction.Users = append(reaction.Users[:j], reaction.Users[j+1:]...)
+				if len(reaction.Users) == 0 {
+					msg.Reactions = append(msg.Reactions[:i], msg.Reactions[i+1:]...)
+				}
+				return false
+			}
+		}
+		reaction.Users = append(reaction.Users, user)
+		return true
+	}
+	msg.Reactions = append(msg.Reactions, &pb.Reaction{Emoji: emoji, Users: []string{user}})
+	return true
+}
+
+// Function to get a message by id, with up to n messages before and after it in its channel.
+// Deleted messages, and those that have expired by now, are skipped.
+func (h *history) around(id string, n int, now int64) (*pb.SearchHit, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	gone := func(msg *pb.Message) bool {
+		return msg.Event == pb.Event_DELETED || hasExpired(msg, now)
+	}
+	msg, ok := h.byID[id]
+	if !ok || gone(msg) {
+		return nil, status.Errorf(codes.NotFound, "There's no message #%v", id)
+	}
+
+	channel := h.channels[msg.GetChannel().GetName()]
+	at := 0
+	for i, m := range channel {
+		if m == msg {
+			at = i
+			break
+		}
+	}
+
+	hit := &pb.SearchHit{Message: proto.Clone(msg).(*pb.Message)}
+	for i := at - 1; i >= 0 && len(hit.Before) < n; i-- {
+		if !gone(channel[i]) {
+			hit.Before = append([]*pb.Message{proto.Clone(channel[i]).(*pb.Message)}, hit.Before...)
+		}
+	}
+	for i := at + 1; i < len(channel) && len(hit.After) < n; i++ {
+		if !gone(channel[i]) {
+			hit.After = append(hit.After, proto.Clone(channel[i]).(*pb.Message))
+		}
+	}
+	return hit, nil
+}
+
+// Function to get the messages of a channel changed after revision, in the order they were changed, and the latest revision.
+// With revision 0 it's the last messages of the channel. At most limit messages are returned, the latest ones.
+// Messages that have expired by now, in Unix seconds, are left out.
+func (h *history) since(channel string, revision int64, limit int, now int64) ([]*pb.Message, int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var changed []*pb.Message
+	for _, msg := range h.channels[channel] {
+		if revision > 0 && msg.Revision <= revision {
+			continue
+		}
+		if hasExpired(msg, now) && msg.Event != pb.Event_DELETED {
+			continue
+		}
+		if msg.Event == pb.Event_DELETED {
+			// Someone who never saw it doesn't need to hear it was deleted
+			if revision == 0 {
+				continue
+			}
+			changed = append(changed, deletedView(msg))
+		} else {
+			changed = append(changed, proto.Clone(msg).(*pb.Message))
+		}
+	}
+	if revision > 0 {
+		sort.SliceStable(changed, func(i, j int) bool { return changed[i].Revision < changed[j].Revision })
+	}
+	if len(changed) > limit {
+		changed = changed[len(changed)-limit:]
+	}
+	return changed, h.revision
+}
@@ -0,0 +1,523 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// The IRC frontend lets IRC clients chat in ChittyChat channels: #Eepy on IRC is the channel Eepy, and a nick is a sender.
+// It speaks the part of IRC needed for that: NICK, USER, PASS, JOIN, PART, PRIVMSG, NAMES, PING and QUIT.
+// Channels are joined through JoinChannel, so IRC users are in the same fan-out as every other client.
+
+// Name the server goes by on IRC
+const ircServerName = "chittychat"
+
+// Longest line an IRC client may send, by the protocol it's 512 bytes; a bit more is let through
+const maxIRCLine = 4096
+
+// ircServer accepts IRC connections and keeps the nicks in use, which IRC needs to be unique
+type ircServer struct {
+	chat  *chatServiceServer
+	lis   net.Listener
+	mu    sync.Mutex
+	nicks map[string]bool
+	conns map[*ircConn]bool
+}
+
+func newIRCServer(chat *chatServiceServer) *ircServer {
+	return &ircServer{chat: chat, nicks: make(map[string]bool), conns: make(map[*ircConn]bool)}
+}
+
+// Function to accept IRC clients on lis in the background; the listener is kept first, so stop closes it even if it comes right away
+func (irc *ircServer) start(lis net.Listener) {
+	irc.mu.Lock()
+	irc.lis = lis
+	irc.mu.Unlock()
+	go irc.serve(lis)
+}
+
+// Function to get the address IRC clients connect to; nil when not listening
+func (irc *ircServer) addr() net.Addr {
+	irc.mu.Lock()
+	defer irc.mu.Unlock()
+	if irc.lis == nil {
+		return nil
+	}
+	return irc.lis.Addr()
+}
+
+// Function to accept IRC clients on lis until it's closed
+func (irc *ircServer) serve(lis net.Listener) {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		c := &ircConn{irc: irc, chat: irc.chat, conn: conn, nick: "*", channels: make(map[string]*ircMembership)}
+		c.ctx, c.cancel = context.WithCancel(peer.NewContext(context.Background(), &peer.Peer{Addr: conn.RemoteAddr()}))
+		irc.mu.Lock()
+		irc.conns[c] = true
+		irc.mu.Unlock()
+		go c.run()
+	}
+}
+
+// Function to stop listening and disconnect every IRC client
+func (irc *ircServer) stop() {
+	irc.mu.Lock()
+	defer irc.mu.Unlock()
+	if irc.lis != nil {
+		irc.lis.Close()
+	}
+	for c := range irc.conns {
+		c.conn.Close()
+	}
+}
+
+// Function to take a nick, if nobody on IRC has it
+func (irc *ircServer) claim(nick string) bool {
+	irc.mu.Lock()
+	defer irc.mu.Unlock()
+	if irc.nicks[nick] {
+		return false
+	}
+	irc.nicks[nick] = true
+	return true
+}
+
+func (irc *ircServer) release(c *ircConn, nick string) {
+	irc.mu.Lock()
+	defer irc.mu.Unlock()
+	delete(irc.nicks, nick)
+	if c != nil {
+		delete(irc.conns, c)
+	}
+}
+
+// ircConn is one IRC client
+type ircConn struct {
+	irc    *ircServer
+	chat   *chatServiceServer
+	conn   net.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	writeMu sync.Mutex
+
+	// Only used by the connection's own goroutine, apart from channels
+	nick       string
+	user       string
+	password   string
+	registered bool
+
+	mu       sync.Mutex
+	channels map[string]*ircMembership
+}
+
+// ircMembership is a channel the IRC client is in
+type ircMembership struct {
+	cancel context.CancelFunc
+}
+
+// Function to read and handle the client's commands until it quits or disconnects
+func (c *ircConn) run() {
+	defer c.quit()
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 512), maxIRCLine)
+	for scanner.Scan() {
+		command, params := parseIRC(strings.TrimRight(scanner.Text(), "\r"))
+		if command == "" {
+			continue
+		}
+		if !c.handle(command, params) {
+			return
+		}
+	}
+}
+
+// Function to handle a command; returns false when the client quits
+func (c *ircConn) handle(command string, params []string) bool {
+	switch command {
+	case "CAP":
+		// No capabilities, but saying so keeps clients from waiting for them
+		if len(params) > 0 && strings.ToUpper(params[0]) == "LS" {
+			c.send(":%v CAP * LS :", ircServerName)
+		}
+		return true
+	case "PASS":
+		if len(params) > 0 {
+			c.password = params[0]
+		}
+		return true
+	case "NICK":
+		c.setNick(params)
+		return true
+	case "USER":
+		if c.registered {
+			c.reply("462", "You may not reregister")
+			return true
+		}
+		if len(params) < 4 {
+			c.reply("461", "USER", "Not enough parameters")
+			return true
+		}
+		c.user = params[0]
+		c.welcome()
+		return true
+	case "PING":
+		c.send(":%v PONG %v :%v", ircServerName, ircServerName, strings.Join(params, " "))
+		return true
+	case "QUIT":
+		return false
+	}
+
+	if !c.registered {
+		c.reply("451", "You have not registered")
+		return true
+	}
+	switch command {
+	case "JOIN":
+		if len(params) == 0 {
+			c.reply("461", "JOIN", "Not enough parameters")
+			return true
+		}
+		for _, name := range strings.Split(params[0], ",") {
+			c.join(name)
+		}
+	case "PART":
+		if len(params) == 0 {
+			c.reply("461", "PART", "Not enough parameters")
+			return true
+		}
+		for _, name := range strings.Split(params[0], ",") {
+			c.part(name)
+		}
+	case "PRIVMSG", "NOTICE":
+		if len(params) < 2 {
+			c.reply("412", "No text to send")
+			return true
+		}
+		for _, target := range strings.Split(params[0], ",") {
+			c.privmsg(target, params[1], command == "PRIVMSG")
+		}
+	case "NAMES":
+		if len(params) == 0 {
+			c.reply("366", "*", "End of /NAMES list")
+			return true
+		}
+		for _, name := range strings.Split(params[0], ",") {
+			c.names(name)
+		}
+	default:
+		c.reply("421", command, "Unknown command")
+	}
+	return true
+}
+
+// Function to pick a nick; it's the sender name in ChittyChat, so it follows the same rules
+func (c *ircConn) setNick(params []string) {
+	if len(params) == 0 {
+		c.reply("431", "No nickname given")
+		return
+	}
+	nick := params[0]
+	if err := validateName("user", nick); err != nil {
+		c.reply("432", nick, status.Convert(err).Message())
+		return
+	}
+	if nick == c.nick {
+		return
+	}
+	c.mu.Lock()
+	joined := len(c.channels)
+	c.mu.Unlock()
+	if joined > 0 {
+		c.reply("400", "NICK", "Leave your channels before changing your nick")
+		return
+	}
+	if !c.irc.claim(nick) {
+		c.reply("433", nick, "Nickname is already in use")
+		return
+	}
+	old := c.nick
+	if old != "*" {
+		c.irc.release(nil, old)
+	}
+	c.nick = nick
+	if c.registered {
+		c.send(":%v!%v@%v NICK :%v", old, c.user, ircServerName, nick)
+	} else if c.user != "" {
+		c.welcome()
+	}
+}
+
+// Function to finish registering once there's both a nick and a user
+func (c *ircConn) welcome() {
+	if c.registered || c.nick == "*" || c.user == "" {
+		return
+	}
+	c.registered = true
+	c.reply("001", fmt.Sprintf("Welcome to Chitty-Chat, %v", c.nick))
+	c.reply("002", fmt.Sprintf("Your host is %v", ircServerName))
+	c.reply("003", "This server bridges IRC to ChittyChat")
+	c.reply("004", ircServerName, "chittychat", "o", "o")
+	c.reply("422", "MOTD File is missing")
+}
+
+// Function to check an IRC command with the AuthFunc as the gRPC call it stands for
+func (c *ircConn) authorize(method string) error {
+	if c.chat.auth == nil {
+		return nil
+	}
+	return c.chat.auth.check(c.call(), "/"+pb.ChatService_ServiceDesc.ServiceName+"/"+method)
+}
+
+// Function to get the context of the gRPC calls IRC commands stand for; PASS is passed as the "password" metadata
+func (c *ircConn) call() context.Context {
+	return metadata.NewIncomingContext(c.ctx, metadata.Pairs("password", c.password))
+}
+
+func (c *ircConn) join(name string) {
+	channel := strings.TrimPrefix(name, "#")
+	if err := validateName("channel", channel); err != nil {
+		c.reply("403", name, status.Convert(err).Message())
+		return
+	}
+	if err := c.authorize("JoinChannel"); err != nil {
+		c.reply("464", status.Convert(err).Message())
+		return
+	}
+	if err := c.chat.moderation.checkBan(channel, c.nick); err != nil {
+		c.reply("474", "#"+channel, status.Convert(err).Message())
+		return
+	}
+
+	c.mu.Lock()
+	if _, ok := c.channels[channel]; ok {
+		c.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	member := &ircMembership{cancel: cancel}
+	c.channels[channel] = member
+	c.mu.Unlock()
+
+	ch := &pb.Channel{Name: channel, SendersName: c.nick}
+	nick := c.nick
+	go func() {
+		err := c.chat.JoinChannel(ch, &ircStream{ctx: ctx, conn: c, nick: nick})
+		c.leave(channel, member)
+		if err != nil {
+			c.send(":%v KICK #%v %v :%v", ircServerName, channel, nick, status.Convert(err).Message())
+		}
+	}()
+
+	c.send(":%v!%v@%v JOIN #%v", c.nick, c.user, ircServerName, channel)
+	c.names("#" + channel)
+
+	// Announce it like a gRPC client does after joining
+	if _, err := c.chat.send(c.call(), &pb.Message{Message: joinMessage}, channel, c.nick); err != nil {
+		c.send(":%v NOTICE #%v :%v", ircServerName, channel, status.Convert(err).Message())
+	}
+}
+
+func (c *ircConn) part(name string) {
+	channel := strings.TrimPrefix(name, "#")
+	c.mu.Lock()
+	member, ok := c.channels[channel]
+	c.mu.Unlock()
+	if !ok {
+		c.reply("442", name, "You're not on that channel")
+		return
+	}
+	c.leave(channel, member)
+	c.send(":%v!%v@%v PART #%v", c.nick, c.user, ircServerName, channel)
+}
+
+// Function to end member's JoinChannel and forget it, unless the channel has been joined again since
+func (c *ircConn) leave(channel string, member *ircMembership) {
+	member.cancel()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.channels[channel] == member {
+		delete(c.channels, channel)
+	}
+}
+
+func (c *ircConn) privmsg(target, text string, answerErrors bool) {
+	if !strings.HasPrefix(target, "#") {
+		// ChittyChat has no private messages
+		if answerErrors {
+			c.reply("401", target, "No such nick/channel")
+		}
+		return
+	}
+	channel := strings.TrimPrefix(target, "#")
+	c.mu.Lock()
+	_, joined := c.channels[channel]
+	c.mu.Unlock()
+	if !joined {
+		if answerErrors {
+			c.reply("404", target, "Cannot send to channel, join it first")
+		}
+		return
+	}
+	if err := c.authorize("SendMessage"); err != nil {
+		c.reply("404", target, status.Convert(err).Message())
+		return
+	}
+
+	// IRC's /me is a CTCP ACTION, which is what ChittyChat's /me sends too
+	if action, ok := strings.CutPrefix(text, "\x01ACTION "); ok {
+		text = "* " + c.nick + " " + strings.TrimSuffix(action, "\x01")
+	}
+	if _, err := c.chat.send(c.call(), &pb.Message{Message: text}, channel, c.nick); err != nil && answerErrors {
+		c.reply("404", target, status.Convert(err).Message())
+	}
+}
+
+// Function to list who's in a channel
+func (c *ircConn) names(name string) {
+	channel := strings.TrimPrefix(name, "#")
+	c.chat.mu.Lock()
+	seen := map[string]bool{}
+	for _, client := range c.chat.channel[channel] {
+		seen[client.name] = true
+	}
+	c.chat.mu.Unlock()
+
+	// Just joined, so the stream may not be in yet
+	c.mu.Lock()
+	if _, ok := c.channels[channel]; ok {
+		seen[c.nick] = true
+	}
+	c.mu.Unlock()
+
+	var members []string
+	for member := range seen {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	if len(members) > 0 {
+		c.reply("353", "=", "#"+channel, strings.Join(members, " "))
+	}
+	c.reply("366", "#"+channel, "End of /NAMES list")
+}
+
+// Function to pass a message from a channel on to the IRC client
+func (c *ircConn) relay(nick string, msg *pb.Message) error {
+	channel := msg.GetChannel().GetName()
+	from := msg.GetSender()
+	switch {
+	case msg.GetId() == "":
+		// The server's announcements, like someone joining
+		return c.notice(channel, ircServerName, msg.GetMessage())
+	case msg.GetEvent() == pb.Event_EDITED:
+		return c.notice(channel, lastEditor(msg), fmt.Sprintf("edited #%v: %v", msg.GetId(), msg.GetMessage()))
+	case msg.GetEvent() == pb.Event_DELETED:
+		return c.notice(channel, lastEditor(msg), fmt.Sprintf("deleted #%v", msg.GetId()))
+	case msg.GetEvent() == pb.Event_REACTED:
+		return c.notice(channel, ircServerName, fmt.Sprintf("reactions to #%v: %v", msg.GetId(), formatReactions(msg)))
+	case from == nick:
+		// IRC clients show what they sent themselves
+		return nil
+	}
+	text := msg.GetMessage()
+	if action, ok := strings.CutPrefix(text, "* "+from+" "); ok {
+		text = "\x01ACTION " + action + "\x01"
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if err := c.send(":%v!%v@%v PRIVMSG #%v :%v", from, from, ircServerName, channel, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ircConn) notice(channel, from string, lines ...string) error {
+	for _, text := range lines {
+		for _, line := range strings.Split(text, "\n") {
+			if err := c.send(":%v NOTICE #%v :%v", from, channel, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Function to send a numeric reply; the last parameter is the text
+func (c *ircConn) reply(code string, params ...string) {
+	last := len(params) - 1
+	params[last] = ":" + params[last]
+	c.send(":%v %v %v %v", ircServerName, code, c.nick, strings.Join(params, " "))
+}
+
+func (c *ircConn) send(format string, args ...interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := fmt.Fprintf(c.conn, format+"\r\n", args...)
+	return err
+}
+
+// Function to leave every channel and hang up
+func (c *ircConn) quit() {
+	c.cancel()
+	c.conn.Close()
+	c.irc.release(c, c.nick)
+	log.Printf("IRC client %v disconnected\n", c.nick)
+}
+
+// ircStream lets JoinChannel send to an IRC client as if it were a gRPC stream.
+// JoinChannel only uses Context and Send; the rest of grpc.ServerStream isn't there.
+type ircStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	conn *ircConn
+	nick string
+}
+
+func (s *ircStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *ircStream) Send(msg *pb.Message) error {
+	return s.conn.relay(s.nick, msg)
+}
+
+// Function to split an IRC line into its command and parameters; a parameter starting with ':' is the rest of the line
+func parseIRC(line string) (string, []string) {
+	if strings.HasPrefix(line, ":") {
+		_, line, _ = strings.Cut(line, " ")
+	}
+	var command string
+	var params []string
+	for line != "" {
+		if command != "" && strings.HasPrefix(line, ":") {
+			params = append(params, line[1:])
+			break
+		}
+		var word string
+		word, line, _ = strings.Cut(line, " ")
+		if word == "" {
+			continue
+		}
+		if command == "" {
+			command = strings.ToUpper(word)
+		} else {
+			params = append(params, word)
+		}
+	}
+	return command, params
+}
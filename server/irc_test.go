@@ -0,0 +1,90 @@
+package server_test
+
+import (
+	"ChittyChat/server"
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ircClient is a raw IRC connection, as an IRC client would make
+type ircClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialIRC(t *testing.T, srv *server.Server) *ircClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.IRCAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &ircClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// Function to send a line to the server
+func (c *ircClient) send(format string, args ...interface{}) {
+	c.t.Helper()
+	if _, err := fmt.Fprintf(c.conn, format+"\r\n", args...); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// Function to read lines until one has want in it, which it returns
+func (c *ircClient) expect(want string) string {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("waiting for %q: %v", want, err)
+		}
+		if strings.Contains(line, want) {
+			return strings.TrimRight(line, "\r\n")
+		}
+	}
+}
+
+func TestIRCRelaysBothWays(t *testing.T) {
+	srv, c := startServer(t, server.WithIRCAddress("127.0.0.1:0"))
+	bob := joined(t, c, "Eepy", "Bob")
+
+	irc := dialIRC(t, srv)
+	irc.send("NICK Ircy")
+	irc.send("USER ircy 0 * :Ircy McIrcface")
+	irc.expect(" 001 Ircy ")
+	irc.send("JOIN #Eepy")
+	irc.expect(":Ircy!ircy@chittychat JOIN #Eepy")
+	listed(t, c, "Eepy", "Ircy")
+
+	// IRC to ChittyChat
+	irc.send("PRIVMSG #Eepy :hello from IRC")
+	if got := receive(t, bob, "hello from IRC"); got.GetSender() != "Ircy" || got.GetId() == "" {
+		t.Errorf("Bob received %v, want a message from Ircy with an id", got)
+	}
+
+	// ChittyChat to IRC
+	if err := send(c, message("Eepy", "Bob", "hello from gRPC")); err != nil {
+		t.Fatal(err)
+	}
+	if line := irc.expect("hello from gRPC"); line != ":Bob!Bob@chittychat PRIVMSG #Eepy :hello from gRPC" {
+		t.Errorf("IRC got %q, want a PRIVMSG from Bob", line)
+	}
+
+	// Quitting IRC leaves the channel
+	irc.send("QUIT")
+	for {
+		msg, err := bob.Recv()
+		if err != nil {
+			t.Fatalf("waiting for Ircy to leave: %v", err)
+		}
+		if strings.HasPrefix(msg.GetMessage(), "Participant Ircy has left") {
+			break
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// How many mentions are kept per user; older ones are dropped
+const maxMentions = 100
+
+// A mention is '@' followed by a name, see validateName for the naming rules
+var mentionPattern = regexp.MustCompile(`@([\pL\pN_.-]+)`)
+
+// mentionInbox keeps the messages each user was mentioned in, whether they were online or not.
+// Only users who have joined a channel at some point can be mentioned.
+type mentionInbox struct {
+	mu    sync.Mutex
+	known map[string]bool
+	inbox map[string][]*mention
+}
+
+type mention struct {
+	msg  *pb.Message
+	read bool
+}
+
+func newMentionInbox() *mentionInbox {
+	return &mentionInbox{
+		known: make(map[string]bool),
+		inbox: make(map[string][]*mention),
+	}
+}
+
+// Function to make a user mentionable, called when they join a channel
+func (m *mentionInbox) addUser(user string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.known[user] = true
+}
+
+// Function to find the known users mentioned in a message, each once, in the order they're mentioned.
+// A trailing '.' is left out, so "thanks @bob." mentions bob.
+func (m *mentionInbox) parse(text string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var users []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		user := strings.TrimRight(match[1], ".")
+		if m.known[user] && !seen[user] {
+			seen[user] = true
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+// Function to put a copy of msg in the inbox of everyone it mentions, except the sender
+func (m *mentionInbox) deliver(msg *pb.Message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range msg.GetMentions() {
+		if user != msg.GetSender() {
+			m.add(user, msg)
+		}
+	}
+}
+
+// Function to put a copy of msg in user's inbox, dropping the oldest mention when it's full; m.mu must be held
+func (m *mentionInbox) add(user string, msg *pb.Message) {
+	inbox := append(m.inbox[user], &mention{msg: proto.Clone(msg).(*pb.Message)})
+	if len(inbox) > maxMentions {
+		inbox = inbox[len(inbox)-maxMentions:]
+	}
+	m.inbox[user] = inbox
+}
+
+// Function to bring the mentions of an edited message up to date: whoever it still mentions gets the new text,
+// keeping whether they've read it, whoever it doesn't mention anymore loses it, and whoever it now mentions gets it
+func (m *mentionInbox) update(msg *pb.Message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mentioned := make(map[string]bool)
+	for _, user := range msg.GetMentions() {
+		if user != msg.GetSender() {
+			mentioned[user] = true
+		}
+	}
+	for user, inbox := range m.inbox {
+		var kept []*mention
+		for _, mention := range inbox {
+			if mention.msg.GetId() != msg.GetId() {
+				kept = append(kept, mention)
+			} else if mentioned[user] {
+				mention.msg = proto.Clone(msg).(*pb.Message)
+				kept = append(kept, mention)
+				delete(mentioned, user)
+			}
+		}
+		m.inbox[user] = kept
+	}
+	for _, user := range msg.GetMentions() {
+		if mentioned[user] {
+			m.add(user, msg)
+		}
+	}
+}
+
+// Function to take a message out of everyone's inbox, once it's been deleted, purged or has expired
+func (m *mentionInbox) forget(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for user, inbox := range m.inbox {
+		var kept []*mention
+		for _, mention := range inbox {
+			if mention.msg.GetId() != id {
+				kept = append(kept, mention)
+			}
+		}
+		m.inbox[user] = kept
+	}
+}
+
+// Function to get a user's mentions, optionally only unread ones, and optionally marking them read
+func (m *mentionInbox) list(user string, unreadOnly, markRead bool) []*pb.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var messages []*pb.Message
+	for _, mention := range m.inbox[user] {
+		if unreadOnly && mention.read {
+			continue
+		}
+		messages = append(messages, proto.Clone(mention.msg).(*pb.Message))
+		if markRead {
+			mention.read = true
+		}
+	}
+	return messages
+}
+
+// ListMentions returns the messages a user was mentioned in. When the server knows who's calling, only to that user.
+func (s *chatServiceServer) ListMentions(ctx context.Context, req *pb.MentionsRequest) (*pb.Mentions, error) {
+	if err := validateName("user", req.GetUser()); err != nil {
+		return nil, err
+	}
+	if !s.isCaller(ctx, req.GetUser()) {
+		return nil, status.Errorf(codes.PermissionDenied, "Only %v can see their mentions", req.GetUser())
+	}
+	return &pb.Mentions{Messages: s.mentions.list(req.GetUser(), req.GetUnreadOnly(), req.GetMarkRead())}, nil
+}
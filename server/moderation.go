@@ -0,0 +1,381 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"ChittyChat/storage"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The longest a ban or mute can be given for, ten years; anything longer should be forever
+const maxRestrictSeconds = 10 * 365 * 24 * 60 * 60
+
+// role of a user in a channel; higher roles may moderate lower ones
+type role int
+
+const (
+	member role = iota
+	operator
+	owner
+)
+
+func (r role) String() string {
+	switch r {
+	case owner:
+		return "owner"
+	case operator:
+		return "operator"
+	default:
+		return "member"
+	}
+}
+
+// moderation holds the roles, bans, mutes and audit log of every channel.
+// Bans and mutes map a user to when they expire; the zero time means never.
+type moderation struct {
+	mu    sync.Mutex
+	roles map[string]map[string]role
+	bans  map[string]map[string]time.Time
+	mutes map[string]map[string]time.Time
+	audit map[string][]*pb.AuditEntry
+	now   func() time.Time
+	store storage.Store // every change is written to it, see persist.go
+}
+
+func newModeration(now func() time.Time, store storage.Store) *moderation {
+	return &moderation{
+		roles: make(map[string]map[string]role),
+		bans:  make(map[string]map[string]time.Time),
+		mutes: make(map[string]map[string]time.Time),
+		audit: make(map[string][]*pb.AuditEntry),
+		now:   now,
+		store: store,
+	}
+}
+
+// Function to make user the owner of channel, if the channel has no roles yet
+func (m *moderation) claimOwner(channel, user string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.roles[channel]; !ok {
+		m.roles[channel] = map[string]role{user: owner}
+		m.save(channel)
+	}
+}
+
+// Function to get the role of user in channel
+func (m *moderation) roleOf(channel, user string) role {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.roles[channel][user]
+}
+
+// Function to set the role of user in channel
+func (m *moderation) setRole(channel, user string, r role) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.roles[channel] == nil {
+		m.roles[channel] = make(map[string]role)
+	}
+	m.roles[channel][user] = r
+	m.save(channel)
+}
+
+// Function to ban or mute user in channel for d; a d of 0 lasts forever
+func (m *moderation) restrict(list map[string]map[string]time.Time, channel, user string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if list[channel] == nil {
+		list[channel] = make(map[string]time.Time)
+	}
+	var until time.Time
+	if d > 0 {
+		until = m.now().Add(d)
+	}
+	list[channel][user] = until
+	m.save(channel)
+}
+
+// Function to check whether user is restricted in channel; expired entries are removed
+func (m *moderation) restricted(list map[string]map[string]time.Time, channel, user string) (bool, time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	until, ok := list[channel][user]
+	if !ok {
+		return false, until
+	}
+	if !until.IsZero() && m.now().After(until) {
+		delete(list[channel], user)
+		return false, until
+	}
+	return true, until
+}
+
+// Function to get the channels any of users is banned from, leaving out bans that have run out
+func (m *moderation) bannedFrom(users []string) map[string]bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	banned := make(map[string]bool)
+	for channel, bans := range m.bans {
+		for _, user := range users {
+			if until, ok := bans[user]; ok && (until.IsZero() || !now.After(until)) {
+				banned[channel] = true
+			}
+		}
+	}
+	return banned
+}
+
+// Function returning a PermissionDenied error if user is banned from channel
+func (m *moderation) checkBan(channel, user string) error {
+	if banned, until := m.restricted(m.bans, channel, user); banned {
+		return status.Errorf(codes.PermissionDenied, "You are banned from %v%v", channel, untilString(until))
+	}
+	return nil
+}
+
+// Function returning a PermissionDenied error if user is muted in channel
+func (m *moderation) checkMute(channel, user string) error {
+	if muted, until := m.restricted(m.mutes, channel, user); muted {
+		return status.Errorf(codes.PermissionDenied, "You are muted in %v%v", channel, untilString(until))
+	}
+	return nil
+}
+
+// Function returning a PermissionDenied error if user is banned from channel, or if the caller is under the name the server
+// knows them by (see WithIdentity), so a banned user can't come back by sending another name
+func (s *chatServiceServer) checkBan(ctx context.Context, channel, user string) error {
+	if err := s.moderation.checkBan(channel, user); err != nil {
+		return err
+	}
+	if who, ok := s.knownCaller(ctx); ok && who != user {
+		return s.moderation.checkBan(channel, who)
+	}
+	return nil
+}
+
+// Function returning a PermissionDenied error if user is muted in channel, or if the caller is under the name the server knows them by
+func (s *chatServiceServer) checkMute(ctx context.Context, channel, user string) error {
+	if err := s.moderation.checkMute(channel, user); err != nil {
+		return err
+	}
+	if who, ok := s.knownCaller(ctx); ok && who != user {
+		return s.moderation.checkMute(channel, who)
+	}
+	return nil
+}
+
+// Function to describe when a ban or mute ends
+func untilString(until time.Time) string {
+	if until.IsZero() {
+		return ""
+	}
+	return " until " + until.Format(time.Kitchen)
+}
+
+// Function to add an entry to the channel's audit log; it's also written to the server log
+func (m *moderation) record(entry *pb.AuditEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.audit[entry.Channel] = append(m.audit[entry.Channel], entry)
+	m.save(entry.Channel)
+	log.Printf("Audit at Lamport time %v: %v %v %v in %v (%v)\n", entry.Timestamp, entry.Moderator, entry.Action, entry.Target, entry.Channel, entry.Reason)
+}
+
+// Function to get a copy of the channel's audit log
+func (m *moderation) auditLog(channel string) []*pb.AuditEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*pb.AuditEntry(nil), m.audit[channel]...)
+}
+
+// Function to get who's calling, when the server can tell (see WithIdentity)
+func (s *chatServiceServer) knownCaller(ctx context.Context) (string, bool) {
+	if s.identity == nil {
+		return "", false
+	}
+	who, err := s.identity(ctx)
+	return who, err == nil && who != ""
+}
+
+// Function to check the caller is user. When the server knows who's calling (see WithIdentity), it must be them;
+// without it, the server can't tell, so it takes the name it's sent
+func (s *chatServiceServer) isCaller(ctx context.Context, user string) bool {
+	if s.identity == nil {
+		return true
+	}
+	who, err := s.identity(ctx)
+	return err == nil && who == user
+}
+
+// Function to get the role of the caller, who says they're user, in channel. It only counts when the server knows
+// the caller is user (see WithIdentity); anyone else is a member, whatever name they send.
+func (s *chatServiceServer) callerRole(ctx context.Context, channel, user string) role {
+	if s.identity == nil {
+		return member
+	}
+	if who, err := s.identity(ctx); err != nil || who != user {
+		return member
+	}
+	return s.moderation.roleOf(channel, user)
+}
+
+// Function to refuse a caller without the role needed in channel
+func (s *chatServiceServer) needRole(ctx context.Context, channel, user string, needed role) error {
+	if s.callerRole(ctx, channel, user) >= needed {
+		return nil
+	}
+	if s.identity == nil {
+		return status.Errorf(codes.PermissionDenied, "You need to be %v of %v to do that, and this server can't tell who's calling", needed, channel)
+	}
+	return status.Errorf(codes.PermissionDenied, "You need to be %v of %v to do that", needed, channel)
+}
+
+// Function to check the moderator has at least the role needed, and outranks the target
+func (s *chatServiceServer) authorize(ctx context.Context, req *pb.ModerationRequest, needed role) error {
+	if err := validateChannel(req.GetChannel()); err != nil {
+		return err
+	}
+	if err := validateName("user", req.GetTarget()); err != nil {
+		return err
+	}
+	channel, moderator := req.GetChannel().GetName(), req.GetChannel().GetSendersName()
+	if moderator == req.GetTarget() {
+		return status.Error(codes.InvalidArgument, "You can't moderate yourself")
+	}
+	if err := s.needRole(ctx, channel, moderator, needed); err != nil {
+		return err
+	}
+	modRole := s.moderation.roleOf(channel, moderator)
+	if targetRole := s.moderation.roleOf(channel, req.GetTarget()); targetRole >= modRole {
+		return status.Errorf(codes.PermissionDenied, "%v is %v of %v", req.GetTarget(), targetRole, channel)
+	}
+	return nil
+}
+
+// Function to end every stream user has open in channel; returns how many were ended
+func (s *chatServiceServer) kickStreams(channel, user, reason string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kicked := 0
+	for _, client := range s.channel[channel] {
+		if client.name != user {
+			continue
+		}
+		select {
+		case client.kicked <- reason:
+			kicked++
+		default:
+			// already being kicked
+		}
+	}
+	return kicked
+}
+
+// Function to log a moderation action and tell the channel about it
+func (s *chatServiceServer) moderate(req *pb.ModerationRequest, action, announcement string) {
+	channel := req.GetChannel().GetName()
+	if req.GetReason() != "" {
+		announcement += fmt.Sprintf(" (%v)", req.GetReason())
+	}
+
+	msg := &pb.Message{Sender: channel, Message: announcement, Channel: &pb.Channel{Name: channel}, Timestamp: s.lamport()}
+	s.sendMsgToClients(msg)
+
+	s.moderation.record(&pb.AuditEntry{
+		Channel:   channel,
+		Moderator: req.GetChannel().GetSendersName(),
+		Action:    action,
+		Target:    req.GetTarget(),
+		Reason:    req.GetReason(),
+		Timestamp: msg.GetTimestamp(),
+	})
+}
+
+// Function to get how long a ban or mute asked for lasts, refusing ones that don't fit in a time.Duration,
+// which would otherwise wrap around into a ban that never ends
+func restriction(req *pb.ModerationRequest) (time.Duration, error) {
+	seconds := req.GetDurationSeconds()
+	if seconds < 0 || seconds > maxRestrictSeconds {
+		return 0, status.Errorf(codes.InvalidArgument, "A ban or mute lasts from 1 to %v seconds, or 0 for forever", maxRestrictSeconds)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// Function to describe how long a ban or mute lasts
+func durationString(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return " for " + d.String()
+}
+
+// Kick ends the target's JoinChannel streams; they're free to rejoin
+func (s *chatServiceServer) Kick(ctx context.Context, req *pb.ModerationRequest) (*pb.MessageAck, error) {
+	if err := s.authorize(ctx, req, operator); err != nil {
+		return nil, err
+	}
+	reason := fmt.Sprintf("kicked by %v", req.GetChannel().GetSendersName())
+	if s.kickStreams(req.GetChannel().GetName(), req.GetTarget(), reason) == 0 {
+		return nil, status.Errorf(codes.NotFound, "%v is not in %v", req.GetTarget(), req.GetChannel().GetName())
+	}
+	s.moderate(req, "kick", fmt.Sprintf("Participant %v was kicked by %v", req.GetTarget(), req.GetChannel().GetSendersName()))
+	return &pb.MessageAck{Status: "Kicked"}, nil
+}
+
+// Ban kicks the target and keeps them out of the channel for the given duration
+func (s *chatServiceServer) Ban(ctx context.Context, req *pb.ModerationRequest) (*pb.MessageAck, error) {
+	if err := s.authorize(ctx, req, operator); err != nil {
+		return nil, err
+	}
+	d, err := restriction(req)
+	if err != nil {
+		return nil, err
+	}
+	s.moderation.restrict(s.moderation.bans, req.GetChannel().GetName(), req.GetTarget(), d)
+	s.kickStreams(req.GetChannel().GetName(), req.GetTarget(), fmt.Sprintf("banned by %v%v", req.GetChannel().GetSendersName(), durationString(d)))
+	s.moderate(req, "ban", fmt.Sprintf("Participant %v was banned by %v%v", req.GetTarget(), req.GetChannel().GetSendersName(), durationString(d)))
+	return &pb.MessageAck{Status: "Banned"}, nil
+}
+
+// Mute stops the target from sending messages to the channel for the given duration
+func (s *chatServiceServer) Mute(ctx context.Context, req *pb.ModerationRequest) (*pb.MessageAck, error) {
+	if err := s.authorize(ctx, req, operator); err != nil {
+		return nil, err
+	}
+	d, err := restriction(req)
+	if err != nil {
+		return nil, err
+	}
+	s.moderation.restrict(s.moderation.mutes, req.GetChannel().GetName(), req.GetTarget(), d)
+	s.moderate(req, "mute", fmt.Sprintf("Participant %v was muted by %v%v", req.GetTarget(), req.GetChannel().GetSendersName(), durationString(d)))
+	return &pb.MessageAck{Status: "Muted"}, nil
+}
+
+// Op makes the target an operator of the channel; only the owner may do this
+func (s *chatServiceServer) Op(ctx context.Context, req *pb.ModerationRequest) (*pb.MessageAck, error) {
+	if err := s.authorize(ctx, req, owner); err != nil {
+		return nil, err
+	}
+	s.moderation.setRole(req.GetChannel().GetName(), req.GetTarget(), operator)
+	s.moderate(req, "op", fmt.Sprintf("Participant %v is now an operator, made by %v", req.GetTarget(), req.GetChannel().GetSendersName()))
+	return &pb.MessageAck{Status: "Opped"}, nil
+}
+
+// GetAuditLog returns the channel's moderation history to its operators
+func (s *chatServiceServer) GetAuditLog(ctx context.Context, ch *pb.Channel) (*pb.AuditLog, error) {
+	if err := validateChannel(ch); err != nil {
+		return nil, err
+	}
+	if err := s.needRole(ctx, ch.GetName(), ch.GetSendersName(), operator); err != nil {
+		return nil, err
+	}
+	return &pb.AuditLog{Entries: s.moderation.auditLog(ch.GetName())}, nil
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"ChittyChat/storage"
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Config is how the server treats messages: rate limits, lengths, filters and uploads.
+// cmd/server fills it in from its flags.
+type Config struct {
+	UserRate     float64 // Messages per second each user may send
+	UserBurst    float64 // Messages a user may send in a burst
+	ChannelRate  float64 // Messages per second allowed in each channel
+	ChannelBurst float64 // Messages a channel may receive in a burst
+
+	MaxLength        int // Maximum message length in characters
+	ChannelMaxLength ChannelLengths
+
+	Filters        []string // Filters messages go through: blocklist, links, spam
+	ChannelFilters ChannelFilters
+	Blocklist      []string // Words masked by the blocklist filter
+
+	AttachmentDir string // Folder uploaded files are stored in; empty takes no uploads
+	MaxFileSize   int64  // Largest file that can be uploaded, in bytes
+	UserQuota     int64  // How much each user may upload, in bytes
+
+	HistoryDir       string // Folder the messages, channels, users and sessions are kept in, so they're there after a restart; empty keeps them in memory only
+	Retention        Retention
+	ChannelRetention ChannelRetention
+	CompactInterval  time.Duration // How often expired messages are deleted and messages past their retention purged
+}
+
+// DefaultConfig returns the settings of an embedded server: those of cmd/server's flags, except nothing is written to disk.
+// History is kept in memory, and there's no attachment folder, so no uploads.
+func DefaultConfig() Config {
+	return Config{
+		UserRate:         1,
+		UserBurst:        5,
+		ChannelRate:      10,
+		ChannelBurst:     20,
+		MaxLength:        128,
+		ChannelMaxLength: make(ChannelLengths),
+		Filters:          []string{"spam"},
+		ChannelFilters:   make(ChannelFilters),
+		MaxFileSize:      10 << 20,
+		UserQuota:        100 << 20,
+		ChannelRetention: make(ChannelRetention),
+		CompactInterval:  time.Minute,
+	}
+}
+
+// Hooks are called as things happen on the server, e.g. to log them or to pass them on elsewhere.
+// They're called from the goroutine handling the client, so they should be quick; any may be nil.
+type Hooks struct {
+	// Join is called when user has joined channel
+	Join func(channel, user string)
+	// Leave is called when user has left channel, or was kicked
+	Leave func(channel, user string)
+	// Message is called with everything sent to a channel's clients once they have it:
+	// messages, edits, deletions, reactions and the server's announcements. msg must not be changed.
+	Message func(msg *pb.Message)
+}
+
+// AuthFunc decides whether a call may go ahead, e.g. by checking a token in the call's metadata.
+// method is the full gRPC method name, like "/proto.ChatService/SendMessage".
+// Returning an error refuses the call; errors without a gRPC status are sent as Unauthenticated.
+type AuthFunc func(ctx context.Context, method string) error
+
+// IdentityFunc tells who is making a call, e.g. the user a token in the call's metadata belongs to.
+// It returns an error when it can't tell.
+type IdentityFunc func(ctx context.Context) (string, error)
+
+type options struct {
+	config   Config
+	addr     string
+	listener net.Listener
+	auth     AuthFunc
+	identity IdentityFunc
+	now      func() time.Time
+	hooks    Hooks
+	output   io.Writer
+	grpc     []grpc.ServerOption
+	store    storage.Store
+
+	bots     []registeredBot
+	webhooks Webhooks
+	httpAddr string
+	gateway  bool
+	webUI    bool
+	ircAddr  string
+}
+
+// Option changes how New makes the server
+type Option func(*options)
+
+// WithConfig sets the server's Config; without it, the server uses DefaultConfig
+func WithConfig(cfg Config) Option {
+	return func(o *options) {
+		o.config = cfg
+	}
+}
+
+// WithAddress sets the address Start listens on; the default is ":8080"
+func WithAddress(addr string) Option {
+	return func(o *options) {
+		o.addr = addr
+	}
+}
+
+// WithListener makes the server serve on lis instead of listening itself,
+// e.g. a bufconn listener to run it in-process in tests
+func WithListener(lis net.Listener) Option {
+	return func(o *options) {
+		o.listener = lis
+	}
+}
+
+// WithAuth checks every call with auth before it's handled
+func WithAuth(auth AuthFunc) Option {
+	return func(o *options) {
+		o.auth = auth
+	}
+}
+
+// WithIdentity tells the server who is calling. Channel roles only count for callers it says are who they claim to be,
+// so without it nobody can moderate: otherwise anyone could send the owner's name and get the owner's powers.
+func WithIdentity(identity IdentityFunc) Option {
+	return func(o *options) {
+		o.identity = identity
+	}
+}
+
+// WithClock replaces time.Now for everything time based: rate limits, bans and mutes, the spam filter and message times
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// WithHooks sets functions called on joins, leaves and messages
+func WithHooks(hooks Hooks) Option {
+	return func(o *options) {
+		o.hooks = hooks
+	}
+}
+
+// WithOutput prints every message the server receives to w, like the server's console; by default nothing is printed
+func WithOutput(w io.Writer) Option {
+	return func(o *options) {
+		o.output = w
+	}
+}
+
+// WithGRPCOptions adds options to the gRPC server, e.g. TLS credentials
+func WithGRPCOptions(opts ...grpc.ServerOption) Option {
+	return func(o *options) {
+		o.grpc = append(o.grpc, opts...)
+	}
+}
+
+// WithStore keeps messages, channels, users and sessions in store instead of HistoryDir, e.g. another backend.
+// The server doesn't close it on Stop, as it didn't open it.
+func WithStore(store storage.Store) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
+
+// WithBot adds a bot called name to channels
+func WithBot(name string, channels []string, bot Bot) Option {
+	return func(o *options) {
+		o.bots = append(o.bots, registeredBot{name: name, channels: channels, bot: bot})
+	}
+}
+
+// WithWebhooks sets the incoming and outgoing webhooks
+func WithWebhooks(hooks Webhooks) Option {
+	return func(o *options) {
+		o.webhooks = hooks
+	}
+}
+
+// WithHTTPAddress makes Start serve the incoming webhooks and the gateway over HTTP on addr, e.g. "localhost:8081".
+// Without it, they're only served where HTTPHandler is mounted.
+func WithHTTPAddress(addr string) Option {
+	return func(o *options) {
+		o.httpAddr = addr
+	}
+}
+
+// WithGateway serves ChatService as JSON over HTTP and WebSockets, for clients that can't speak gRPC
+func WithGateway() Option {
+	return func(o *options) {
+		o.gateway = true
+	}
+}
+
+// WithWebUI serves the web client at the root of the HTTP address, along with the gateway it talks to
+func WithWebUI() Option {
+	return func(o *options) {
+		o.webUI = true
+	}
+}
+
+// WithIRCAddress makes Start accept IRC clients on addr, e.g. "localhost:6667"
+func WithIRCAddress(addr string) Option {
+	return func(o *options) {
+		o.ircAddr = addr
+	}
+}
+
+// Function to refuse calls the AuthFunc doesn't allow
+func (auth AuthFunc) check(ctx context.Context, method string) error {
+	err := auth(ctx, method)
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Unauthenticated, err.Error())
+}
+
+func (auth AuthFunc) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := auth.check(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (auth AuthFunc) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := auth.check(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
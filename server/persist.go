@@ -0,0 +1,173 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"ChittyChat/storage"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// The server keeps what should outlive it in a storage.Store, writing to it as things change:
+// history writes the messages, moderation the channels' roles, bans, mutes and audit logs,
+// and JoinChannel the users and sessions. Everything is in memory as well, so the Store is only read on start.
+
+// Function to pick up where the server left off with what's in its Store: the messages can be searched again,
+// are back in the inboxes of who they mention (unread, as that isn't kept), their senders can be mentioned,
+// the channels are moderated as they were, and the Lamport clock goes on from the latest of them
+func (s *chatServiceServer) load() error {
+	channels, err := s.store.Channels()
+	if err != nil {
+		return err
+	}
+	for _, channel := range channels {
+		messages, err := s.store.Messages(channel)
+		if err != nil {
+			return err
+		}
+		s.history.load(messages)
+		for _, msg := range messages {
+			if msg.GetEvent() != pb.Event_DELETED {
+				s.search.index(msg)
+				s.mentions.deliver(msg)
+			}
+			s.mentions.addUser(msg.GetSender())
+			s.Lamport = max(s.Lamport, msg.GetTimestamp())
+			for _, edit := range msg.GetEdits() {
+				s.Lamport = max(s.Lamport, edit.GetTimestamp())
+			}
+		}
+
+		record, err := s.store.Channel(channel)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s.moderation.load(record)
+		for _, entry := range record.GetAudit() {
+			s.Lamport = max(s.Lamport, entry.GetTimestamp())
+		}
+	}
+
+	users, err := s.store.Users()
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		s.mentions.addUser(user.GetName())
+	}
+
+	// Sessions still there are of clients that were connected when the server stopped without seeing them leave
+	sessions, err := s.store.Sessions()
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := s.store.DeleteSession(session.GetId()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to remember user joined a channel now, keeping when they first did
+func (s *chatServiceServer) seen(user string) {
+	now := s.now().Unix()
+	record, err := s.store.User(user)
+	if err != nil {
+		record = &pb.UserRecord{Name: user, FirstSeen: now}
+	}
+	record.LastSeen = now
+	if err := s.store.SaveUser(record); err != nil {
+		log.Printf("Cannot keep user %v: %v", user, err)
+	}
+}
+
+// Function to keep a session for a client that joined channel as user; returns its id, to end it with
+func (s *chatServiceServer) startSession(channel, user string) string {
+	s.mu.Lock()
+	s.sessions++
+	id := fmt.Sprintf("%v-%v", s.started.UnixNano(), s.sessions)
+	s.mu.Unlock()
+
+	session := &pb.SessionRecord{Id: id, User: user, Channel: channel, StartedAt: s.now().Unix()}
+	if err := s.store.SaveSession(session); err != nil {
+		log.Printf("Cannot keep session of %v in %v: %v", user, channel, err)
+	}
+	return id
+}
+
+func (s *chatServiceServer) endSession(id string) {
+	if err := s.store.DeleteSession(id); err != nil {
+		log.Printf("Cannot remove session %v: %v", id, err)
+	}
+}
+
+// Function to add messages read from the Store, in the order they were sent, with the ids they had
+func (h *history) load(messages []*pb.Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, msg := range messages {
+		channel := msg.GetChannel().GetName()
+		h.channels[channel] = append(h.channels[channel], msg)
+		h.byID[msg.Id] = msg
+		if parent := msg.GetReplyTo(); parent != "" {
+			h.roots[msg.Id] = h.rootOf(parent)
+		}
+		if id, err := strconv.Atoi(msg.Id); err == nil {
+			h.lastID = max(h.lastID, id)
+		}
+		h.revision = max(h.revision, msg.Revision)
+	}
+}
+
+// Function to write a new or changed message to the Store; h.mu must be held
+func (h *history) save(msg *pb.Message) {
+	if err := h.store.SaveMessage(msg); err != nil {
+		log.Printf("Cannot keep message #%v: %v", msg.GetId(), err)
+	}
+}
+
+// Function to have the Store drop the old versions of a channel's messages; h.mu must be held
+func (h *history) compact(channel string) {
+	if err := h.store.Compact(channel); err != nil {
+		log.Printf("Cannot compact the history of %v: %v", channel, err)
+	}
+}
+
+// Function to remove purged messages from the Store; h.mu must be held
+func (h *history) forget(channel string, ids []string) {
+	if err := h.store.DeleteMessages(channel, ids); err != nil {
+		log.Printf("Cannot purge %v messages from %v: %v", len(ids), channel, err)
+	}
+}
+
+// Function to load a channel's roles, bans, mutes and audit log from the Store; bans and mutes that have run out are left out
+func (m *moderation) load(record *pb.ChannelRecord) {
+	var members []*pb.ArchiveMember
+	now := m.now()
+	for _, member := range record.GetMembers() {
+		if member.GetBanned() && member.GetBannedUntil() > 0 && now.After(time.Unix(member.GetBannedUntil(), 0)) {
+			member.Banned = false
+		}
+		if member.GetMuted() && member.GetMutedUntil() > 0 && now.After(time.Unix(member.GetMutedUntil(), 0)) {
+			member.Muted = false
+		}
+		members = append(members, member)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.put(record.GetName(), members, record.GetAudit())
+}
+
+// Function to write a channel's roles, bans, mutes and audit log to the Store; m.mu must be held
+func (m *moderation) save(channel string) {
+	record := &pb.ChannelRecord{Name: channel, Members: m.members(channel, nil), Audit: m.audit[channel]}
+	if err := m.store.SaveChannel(record); err != nil {
+		log.Printf("Cannot keep the moderation of %v: %v", channel, err)
+	}
+}
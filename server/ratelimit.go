@@ -0,0 +1,181 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// tokenBucket holds the tokens left for a single sender or channel.
+// Tokens refill continuously at the limiter's rate, up to its burst size.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	cfg    bucketConfig
+}
+
+// bucketConfig is the refill rate (tokens per second) and capacity of a bucket.
+type bucketConfig struct {
+	rate  float64
+	burst float64
+}
+
+// How often buckets that have filled up again are dropped; a full bucket is the same as a new one
+const bucketSweepInterval = time.Minute
+
+// rateLimiter keeps a token bucket per sender and per channel.
+// A message is only let through if both the sender's and the channel's bucket have a token left.
+// Senders are who the server knows is calling, or else the address they call from (see caller).
+type rateLimiter struct {
+	mu        sync.Mutex
+	user      bucketConfig
+	channel   bucketConfig
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	identity  IdentityFunc
+	now       func() time.Time
+}
+
+func newRateLimiter(user, channel bucketConfig, identity IdentityFunc, now func() time.Time) *rateLimiter {
+	return &rateLimiter{
+		user:      user,
+		channel:   channel,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: now(),
+		identity:  identity,
+		now:       now,
+	}
+}
+
+// Function to tell who's sending, to rate limit them: the user the server knows is calling (see WithIdentity),
+// or else the address they call from, as a client can send another name with every message.
+// The address is only the host, since reconnecting gets a new port, so without identities everyone on a host, or behind a NAT, shares a bucket.
+func (l *rateLimiter) caller(ctx context.Context) string {
+	if l.identity != nil {
+		if user, err := l.identity(ctx); err == nil {
+			return "user:" + user
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		return "address:" + host
+	}
+	return "unknown"
+}
+
+// Function to check whether sender may send a message to channel right now.
+// If not, it returns how long the client should wait before trying again.
+func (l *rateLimiter) allow(sender, channel string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	userBucket := l.refill("sender/"+sender, l.user, now)
+	channelBucket := l.refill("channel/"+channel, l.channel, now)
+
+	if userBucket.tokens < 1 {
+		return false, waitFor(userBucket, l.user)
+	}
+	if channelBucket.tokens < 1 {
+		return false, waitFor(channelBucket, l.channel)
+	}
+
+	userBucket.tokens--
+	channelBucket.tokens--
+	return true, 0
+}
+
+// Function to top up the bucket for key with the tokens earned since it was last used
+func (l *rateLimiter) refill(key string, cfg bucketConfig, now time.Time) *tokenBucket {
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: cfg.burst, last: now, cfg: cfg}
+		l.buckets[key] = bucket
+		return bucket
+	}
+	elapsed := now.Sub(bucket.last).Seconds()
+	bucket.tokens = math.Min(cfg.burst, bucket.tokens+elapsed*cfg.rate)
+	bucket.last = now
+	return bucket
+}
+
+// Function to drop the buckets that have filled up again since they were last used, so they don't pile up
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.cfg.rate >= bucket.cfg.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Function to compute the time until the bucket has a whole token again
+func waitFor(bucket *tokenBucket, cfg bucketConfig) time.Duration {
+	if cfg.rate <= 0 {
+		return time.Hour
+	}
+	missing := 1 - bucket.tokens
+	return time.Duration(missing / cfg.rate * float64(time.Second))
+}
+
+// streamInterceptor applies the rate limiter to SendMessage.
+// Other streams (JoinChannel) are passed straight through.
+func (l *rateLimiter) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if info.FullMethod != "/"+pb.ChatService_ServiceDesc.ServiceName+"/SendMessage" {
+		return handler(srv, ss)
+	}
+	return handler(srv, &rateLimitedStream{ServerStream: ss, limiter: l})
+}
+
+// rateLimitedStream checks every message received on the stream against the limiter
+type rateLimitedStream struct {
+	grpc.ServerStream
+	limiter *rateLimiter
+}
+
+func (s *rateLimitedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	msg, ok := m.(*pb.Message)
+	if !ok {
+		return nil
+	}
+
+	seconds, err := s.limiter.throttle(s.limiter.caller(s.Context()), msg.GetSender(), msg.GetChannel().GetName())
+	if err != nil {
+		s.SetTrailer(metadata.Pairs(retryAfterKey, strconv.Itoa(seconds)))
+	}
+	return err
+}
+
+// Function to refuse a message from sender, who says they're user, to channel when either is over its limit,
+// with how many whole seconds to back off before trying again
+func (l *rateLimiter) throttle(sender, user, channel string) (int, error) {
+	allowed, wait := l.allow(sender, channel)
+	if allowed {
+		return 0, nil
+	}
+	seconds := int(math.Ceil(wait.Seconds()))
+	return seconds, status.Errorf(codes.ResourceExhausted, "%v is sending too fast, retry in %vs", user, seconds)
+}
+
+// retryAfterKey is the trailer key holding the number of seconds to wait after being throttled
+const retryAfterKey = "retry-after"
@@ -0,0 +1,108 @@
+package server_test
+
+import (
+	pb "ChittyChat/proto"
+	"ChittyChat/server"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeClock is a clock for WithClock that only moves when told to
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Function to send msg as caller, returning the retry-after trailer and the error the server answers with
+func sendThrottled(c pb.ChatServiceClient, caller string, msg *pb.Message) ([]string, error) {
+	stream, err := c.SendMessage(as(caller))
+	if err != nil {
+		return nil, err
+	}
+	stream.Send(msg)
+	_, err = stream.CloseAndRecv()
+	return stream.Trailer().Get("retry-after"), err
+}
+
+func TestRateLimit(t *testing.T) {
+	cfg := testConfig()
+	cfg.UserRate, cfg.UserBurst = 0.5, 2
+	clock := newFakeClock()
+	_, c := startServer(t, server.WithConfig(cfg), server.WithClock(clock.Now), server.WithIdentity(testIdentity))
+
+	for i, want := range []codes.Code{codes.OK, codes.OK, codes.ResourceExhausted} {
+		retryAfter, err := sendThrottled(c, "Alice", message("Eepy", "Alice", "hi"))
+		if status.Code(err) != want {
+			t.Fatalf("message %v returned %v, want %v", i+1, err, want)
+		}
+		if want == codes.ResourceExhausted && (len(retryAfter) != 1 || retryAfter[0] != "2") {
+			t.Errorf("retry-after is %q, want 2 seconds for a token at half a token a second", retryAfter)
+		}
+	}
+
+	// Another name doesn't get Alice a new bucket, but another caller has their own
+	if _, err := sendThrottled(c, "Alice", message("Eepy", "Alicia", "hi")); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Alice sending as Alicia returned %v, want ResourceExhausted", err)
+	}
+	if _, err := sendThrottled(c, "Bob", message("Eepy", "Bob", "hi")); err != nil {
+		t.Errorf("Bob sending returned %v", err)
+	}
+
+	// Once the wait is over, there's a token again
+	clock.Advance(2 * time.Second)
+	if _, err := sendThrottled(c, "Alice", message("Eepy", "Alice", "hi again")); err != nil {
+		t.Errorf("Alice sending after the wait returned %v", err)
+	}
+}
+
+func TestChannelRateLimit(t *testing.T) {
+	cfg := testConfig()
+	cfg.ChannelRate, cfg.ChannelBurst = 1, 1
+	clock := newFakeClock()
+	_, c := startServer(t, server.WithConfig(cfg), server.WithClock(clock.Now), server.WithIdentity(testIdentity))
+
+	if _, err := sendThrottled(c, "Alice", message("Eepy", "Alice", "hi")); err != nil {
+		t.Fatal(err)
+	}
+	retryAfter, err := sendThrottled(c, "Bob", message("Eepy", "Bob", "hi"))
+	if status.Code(err) != codes.ResourceExhausted || len(retryAfter) != 1 || retryAfter[0] != "1" {
+		t.Errorf("Bob sending to the full channel returned %v with retry-after %q, want ResourceExhausted and 1", err, retryAfter)
+	}
+	if _, err := sendThrottled(c, "Bob", message("Sleepy", "Bob", "hi")); err != nil {
+		t.Errorf("Bob sending to another channel returned %v", err)
+	}
+}
+
+func TestRateLimitWithoutIdentity(t *testing.T) {
+	cfg := testConfig()
+	cfg.UserRate, cfg.UserBurst = 1, 1
+	_, c := startServer(t, server.WithConfig(cfg), server.WithClock(newFakeClock().Now))
+
+	// Without identities, callers from the same address share a bucket, whatever they're called
+	if _, err := sendThrottled(c, "Alice", message("Eepy", "Alice", "hi")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sendThrottled(c, "Bob", message("Eepy", "Bob", "hi")); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Bob sending from Alice's address returned %v, want ResourceExhausted", err)
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Longest reaction we accept, in characters; emojis with skin tones or joiners take several
+const maxEmojiLength = 8
+
+// Function to check a reaction is a short run of symbols, without letters, digits or spaces
+func validateEmoji(emoji string) error {
+	if emoji == "" || !utf8.ValidString(emoji) {
+		return status.Error(codes.InvalidArgument, "Reaction is empty")
+	}
+	if utf8.RuneCountInString(emoji) > maxEmojiLength {
+		return status.Errorf(codes.InvalidArgument, "Reaction %q is too long", emoji)
+	}
+	if strings.IndexFunc(emoji, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) || unicode.IsControl(r)
+	}) >= 0 {
+		return status.Errorf(codes.InvalidArgument, "Reaction %q should be an emoji", emoji)
+	}
+	return nil
+}
+
+// React toggles the user's reaction on a message and tells the channel the new counts
+func (s *chatServiceServer) React(ctx context.Context, req *pb.ReactionRequest) (*pb.MessageAck, error) {
+	if err := validateChannel(req.GetChannel()); err != nil {
+		return nil, err
+	}
+	if err := validateEmoji(req.GetEmoji()); err != nil {
+		return nil, err
+	}
+	channel, user := req.GetChannel().GetName(), req.GetChannel().GetSendersName()
+	if err := s.checkBan(ctx, channel, user); err != nil {
+		return nil, err
+	}
+	if err := s.checkMute(ctx, channel, user); err != nil {
+		return nil, err
+	}
+
+	event, added, err := s.history.react(channel, req.GetId(), user, req.GetEmoji())
+	if err != nil {
+		return nil, err
+	}
+
+	// The reaction is an event received from the user, then passed on like a message
+	event.Timestamp = req.GetTimestamp()
+	s.incrLamport(event)
+	s.sendMsgToClients(event)
+
+	if added {
+		return &pb.MessageAck{Status: "Reacted"}, nil
+	}
+	return &pb.MessageAck{Status: "Unreacted"}, nil
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Longest an ephemeral message may last
+const maxTTL = 7 * 24 * time.Hour
+
+// Retention is how much history a channel keeps; the compactor purges the oldest messages past any of the limits.
+// Zero fields don't limit anything. String and Set let it be given as a flag, e.g. -retention max-age=720h,max-count=10000
+type Retention struct {
+	MaxAge   time.Duration // Messages older than this are purged
+	MaxCount int           // Only the newest MaxCount messages are kept
+	MaxBytes int64         // Only the newest messages adding up to at most MaxBytes, encoded as protobuf, are kept
+}
+
+func (r Retention) String() string {
+	var parts []string
+	if r.MaxAge > 0 {
+		parts = append(parts, fmt.Sprintf("max-age=%v", r.MaxAge))
+	}
+	if r.MaxCount > 0 {
+		parts = append(parts, fmt.Sprintf("max-count=%v", r.MaxCount))
+	}
+	if r.MaxBytes > 0 {
+		parts = append(parts, fmt.Sprintf("max-bytes=%v", r.MaxBytes))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (r *Retention) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		key, limit, ok := strings.Cut(part, "=")
+		if !ok {
+			return fmt.Errorf("expected max-age=, max-count= or max-bytes=, got %q", part)
+		}
+		var err error
+		switch key {
+		case "max-age":
+			r.MaxAge, err = time.ParseDuration(limit)
+			if err == nil && r.MaxAge < 0 {
+				err = fmt.Errorf("negative")
+			}
+		case "max-count":
+			r.MaxCount, err = strconv.Atoi(limit)
+			if err == nil && r.MaxCount < 0 {
+				err = fmt.Errorf("negative")
+			}
+		case "max-bytes":
+			r.MaxBytes, err = strconv.ParseInt(limit, 10, 64)
+			if err == nil && r.MaxBytes < 0 {
+				err = fmt.Errorf("negative")
+			}
+		default:
+			return fmt.Errorf("unknown retention limit %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %v %q: %v", key, limit, err)
+		}
+	}
+	return nil
+}
+
+// ChannelRetention maps a channel to the retention it has instead of the default one.
+// String and Set let it be given as a flag, e.g. -channel-retention Eepy=max-age=24h,max-count=100.
+// The flag can be repeated for more channels.
+type ChannelRetention map[string]Retention
+
+func (c ChannelRetention) String() string {
+	var parts []string
+	for name, r := range c {
+		parts = append(parts, fmt.Sprintf("%v=%v", name, r))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
+
+func (c ChannelRetention) Set(value string) error {
+	name, limits, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected channel=max-age=...,max-count=...,max-bytes=..., got %q", value)
+	}
+	var r Retention
+	if err := r.Set(limits); err != nil {
+		return err
+	}
+	c[name] = r
+	return nil
+}
+
+// retentionLimits holds the default retention and any per-channel overrides
+type retentionLimits struct {
+	defaultRetention Retention
+	channelRetention ChannelRetention
+}
+
+// Function to get the retention of a channel
+func (l *retentionLimits) forChannel(channel string) Retention {
+	if r, ok := l.channelRetention[channel]; ok {
+		return r
+	}
+	return l.defaultRetention
+}
+
+// Function to run the compactor every interval until stop is closed
+func (s *chatServiceServer) compactor(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.compact()
+		}
+	}
+}
+
+// Function to delete the ephemeral messages that have expired, telling their channels,
+// and to purge the messages past their channel's retention, which nobody is told about
+func (s *chatServiceServer) compact() {
+	now := s.now()
+	for _, channel := range s.history.channelNames() {
+		expired := s.history.expired(channel, now.Unix())
+		for _, id := range expired {
+			received := &pb.Message{}
+			s.incrLamport(received)
+			event, err := s.history.expire(channel, id, received.GetTimestamp())
+			if err != nil {
+				continue
+			}
+			s.search.unindex(id)
+			s.mentions.forget(id)
+			s.sendMsgToClients(event)
+		}
+		// Once for all of them, so their text is gone from the disk too
+		if len(expired) > 0 {
+			s.history.compactChannel(channel)
+		}
+
+		purged := s.history.purge(channel, s.retention.forChannel(channel), now)
+		for _, id := range purged {
+			s.search.unindex(id)
+			s.mentions.forget(id)
+		}
+		if len(purged) > 0 {
+			fmt.Fprintf(s.output, "Purged %v messages from %v\n", len(purged), channel)
+		}
+	}
+}
+
+// Function to get the names of the channels with history
+func (h *history) channelNames() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var names []string
+	for name := range h.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Function to check whether msg is an ephemeral message that has expired by now, in Unix seconds.
+// Until the compactor gets to it, it's left out of what's read, as if it were gone already.
+func hasExpired(msg *pb.Message, now int64) bool {
+	return msg.GetExpiresAt() > 0 && msg.GetExpiresAt() <= now
+}
+
+// Function to get the ids of a channel's ephemeral messages that have expired by now, in Unix seconds
+func (h *history) expired(channel string, now int64) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var ids []string
+	for _, msg := range h.channels[channel] {
+		if hasExpired(msg, now) && msg.Event != pb.Event_DELETED {
+			ids = append(ids, msg.Id)
+		}
+	}
+	return ids
+}
+
+// Function to delete an expired ephemeral message. Unlike delete, its text isn't kept; once a channel's expired
+// messages are deleted, compactChannel has the store drop it from the disk too. Returns the event to pass on to the channel.
+func (h *history) expire(channel, id string, timestamp int32) (*pb.Message, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	msg, err := h.lookup(channel, id)
+	if err != nil {
+		return nil, err
+	}
+	msg.Edits = []*pb.Edit{{Editor: msg.Sender, Timestamp: timestamp}}
+	msg.Message = ""
+	msg.Attachments = nil
+	msg.Reactions = nil
+	msg.Event = pb.Event_DELETED
+	h.revision++
+	msg.Revision = h.revision
+	h.save(msg)
+
+	return proto.Clone(msg).(*pb.Message), nil
+}
+
+// Function to have the Store drop the old versions of a channel's messages
+func (h *history) compactChannel(channel string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.compact(channel)
+}
+
+// Function to remove the messages of a channel that are past its retention: older than MaxAge,
+// or not among the newest MaxCount, or the newest MaxBytes. Returns the ids removed.
+func (h *history) purge(channel string, r Retention, now time.Time) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	messages := h.channels[channel]
+
+	// Count back from the newest message to find the oldest one to keep
+	keep := len(messages)
+	var bytes int64
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if r.MaxAge > 0 && msg.UnixTime > 0 && now.Sub(time.Unix(msg.UnixTime, 0)) > r.MaxAge {
+			break
+		}
+		if r.MaxCount > 0 && len(messages)-i > r.MaxCount {
+			break
+		}
+		bytes += int64(proto.Size(msg))
+		if r.MaxBytes > 0 && bytes > r.MaxBytes {
+			break
+		}
+		keep = i
+	}
+	if keep == 0 {
+		return nil
+	}
+
+	var ids []string
+	for _, msg := range messages[:keep] {
+		ids = append(ids, msg.Id)
+		delete(h.byID, msg.Id)
+		delete(h.roots, msg.Id)
+	}
+	h.channels[channel] = append([]*pb.Message(nil), messages[keep:]...)
+	h.forget(channel, ids)
+	return ids
+}
@@ -0,0 +1,176 @@
+package server_test
+
+import (
+	pb "ChittyChat/proto"
+	"ChittyChat/server"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetentionFlag(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  server.Retention
+		err   bool
+	}{
+		{value: "max-age=720h", want: server.Retention{MaxAge: 720 * time.Hour}},
+		{value: "max-count=100,max-bytes=1048576", want: server.Retention{MaxCount: 100, MaxBytes: 1048576}},
+		{value: "max-age=1h,max-count=5,max-bytes=10", want: server.Retention{MaxAge: time.Hour, MaxCount: 5, MaxBytes: 10}},
+		{value: "max-age=soon", err: true},
+		{value: "max-count=-1", err: true},
+		{value: "max-size=10", err: true},
+		{value: "forever", err: true},
+	} {
+		var r server.Retention
+		err := r.Set(tt.value)
+		if (err != nil) != tt.err {
+			t.Errorf("Set(%q) returned %v, want an error: %v", tt.value, err, tt.err)
+			continue
+		}
+		if err == nil && r != tt.want {
+			t.Errorf("Set(%q) = %+v, want %+v", tt.value, r, tt.want)
+		}
+		var again server.Retention
+		if err == nil && (again.Set(r.String()) != nil || again != r) {
+			t.Errorf("Set(%q).String() = %q, which doesn't set it again", tt.value, r.String())
+		}
+	}
+
+	channels := make(server.ChannelRetention)
+	for _, value := range []string{"Eepy=max-count=10", "Random=max-age=24h"} {
+		if err := channels.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := channels.String(), "Eepy=max-count=10 Random=max-age=24h0m0s"; got != want {
+		t.Errorf("ChannelRetention = %q, want %q", got, want)
+	}
+	if err := channels.Set("max-count=10"); err == nil {
+		t.Error("ChannelRetention.Set without a channel succeeded")
+	}
+}
+
+// Function to get the texts of the last messages of channel
+func historyOf(t *testing.T, c pb.ChatServiceClient, channel string) []string {
+	t.Helper()
+	history, err := c.GetHistory(context.Background(), &pb.HistoryRequest{Channel: &pb.Channel{Name: channel, SendersName: "Anon"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, msg := range history.GetMessages() {
+		texts = append(texts, msg.GetMessage())
+	}
+	return texts
+}
+
+// Function to wait until the history of channel is want, as the compactor gets to it
+func waitForHistory(t *testing.T, c pb.ChatServiceClient, channel string, want ...string) {
+	t.Helper()
+	var got []string
+	for i := 0; i < 500; i++ {
+		got = historyOf(t, c, channel)
+		if strings.Join(got, "\n") == strings.Join(want, "\n") {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("history of %v is %q, want %q", channel, got, want)
+}
+
+func TestRetentionPurges(t *testing.T) {
+	cfg := testConfig()
+	cfg.CompactInterval = 10 * time.Millisecond
+	cfg.ChannelRetention = server.ChannelRetention{
+		"Aged":    {MaxAge: time.Hour},
+		"Counted": {MaxCount: 2},
+		"Sized":   {MaxBytes: 200},
+	}
+	clock := newFakeClock()
+	_, c := startServer(t, server.WithConfig(cfg), server.WithClock(clock.Now))
+
+	long := strings.Repeat("x", 80)
+	for _, channel := range []string{"Aged", "Counted", "Sized", "Kept"} {
+		for _, text := range []string{"one " + long, "two " + long, "three " + long} {
+			if err := send(c, message(channel, "Anon", text)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	waitForHistory(t, c, "Counted", "two "+long, "three "+long)
+	waitForHistory(t, c, "Sized", "three "+long)
+
+	if got := historyOf(t, c, "Aged"); len(got) != 3 {
+		t.Errorf("Aged lost messages before they were an hour old: %q", got)
+	}
+	clock.Advance(time.Hour + time.Second)
+	waitForHistory(t, c, "Aged")
+	if got := historyOf(t, c, "Kept"); len(got) != 3 {
+		t.Errorf("Kept, without retention, has %q, want all three messages", got)
+	}
+}
+
+func TestEphemeralMessagesExpire(t *testing.T) {
+	clock := newFakeClock()
+	cfg := testConfig()
+	cfg.CompactInterval = time.Hour
+	_, c := startServer(t, server.WithConfig(cfg), server.WithClock(clock.Now))
+	anon := joined(t, c, "Eepy", "Anon")
+
+	ephemeral := message("Eepy", "Anon", "gone soon")
+	ephemeral.TtlSeconds = 60
+	if err := send(c, ephemeral); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, anon, "gone soon"); got.GetExpiresAt() != clock.Now().Unix()+60 {
+		t.Errorf("expires at %v, want a minute from now", got.GetExpiresAt())
+	}
+	if err := send(c, message("Eepy", "Anon", "staying")); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, anon, "staying")
+
+	// Expired, it's out of history and search right away, before the compactor gets to it
+	clock.Advance(time.Minute)
+	if got := historyOf(t, c, "Eepy"); len(got) != 1 || got[0] != "staying" {
+		t.Errorf("history after the message expired is %q, want only the one that stays", got)
+	}
+	results, err := c.Search(context.Background(), &pb.SearchRequest{Query: "gone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.GetTotal() != 0 {
+		t.Errorf("searching for the expired message found %v", results.GetHits())
+	}
+}
+
+func TestCompactorDeletesExpiredMessages(t *testing.T) {
+	clock := newFakeClock()
+	cfg := testConfig()
+	cfg.CompactInterval = 10 * time.Millisecond
+	_, c := startServer(t, server.WithConfig(cfg), server.WithClock(clock.Now))
+	anon := joined(t, c, "Eepy", "Anon")
+
+	ephemeral := message("Eepy", "Anon", "gone soon")
+	ephemeral.TtlSeconds = 60
+	if err := send(c, ephemeral); err != nil {
+		t.Fatal(err)
+	}
+	id := receive(t, anon, "gone soon").GetId()
+
+	clock.Advance(time.Minute)
+	for {
+		msg, err := anon.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.GetId() == id && msg.GetEvent() == pb.Event_DELETED {
+			if msg.GetMessage() != "" {
+				t.Errorf("the deletion came with the text %q", msg.GetMessage())
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Results per page when the client doesn't ask for a size, and the most it may ask for
+const defaultPageSize = 10
+const maxPageSize = 50
+
+// Most messages of context the client may ask for around each result
+const maxSearchContext = 5
+
+// searchIndex is an inverted index of every message sent: for each word, the messages it's in
+// and where in them. It's kept up to date as messages are sent, edited and deleted.
+type searchIndex struct {
+	mu       sync.Mutex
+	postings map[string]map[string][]int
+	docs     map[string]*indexedMessage
+}
+
+// indexedMessage is what the index knows about a message, to filter on and to clean up after it
+type indexedMessage struct {
+	id        string
+	order     int
+	channel   string
+	sender    string
+	timestamp int32
+	unixTime  int64
+	expiresAt int64
+	terms     []string
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: make(map[string]map[string][]int),
+		docs:     make(map[string]*indexedMessage),
+	}
+}
+
+// Function to split text into lower case words; anything but letters and digits separates words
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Function to add a message to the index, replacing what was indexed for it before (after an edit)
+func (idx *searchIndex) index(msg *pb.Message) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(msg.GetId())
+
+	order, _ := strconv.Atoi(msg.GetId())
+	doc := &indexedMessage{
+		id:        msg.GetId(),
+		order:     order,
+		channel:   msg.GetChannel().GetName(),
+		sender:    msg.GetSender(),
+		timestamp: msg.GetTimestamp(),
+		unixTime:  msg.GetUnixTime(),
+		expiresAt: msg.GetExpiresAt(),
+		terms:     tokenize(msg.GetMessage()),
+	}
+	idx.docs[doc.id] = doc
+	for position, term := range doc.terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[string][]int)
+		}
+		idx.postings[term][doc.id] = append(idx.postings[term][doc.id], position)
+	}
+}
+
+// Function to take a message out of the index, after it's deleted
+func (idx *searchIndex) unindex(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(id)
+}
+
+func (idx *searchIndex) remove(id string) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for _, term := range doc.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.docs, id)
+}
+
+// Function to split a query into its words and its "quoted phrases"
+func parseQuery(query string) (terms []string, phrases [][]string) {
+	for i, part := range strings.Split(query, `"`) {
+		words := tokenize(part)
+		terms = append(terms, words...)
+		// Every odd part was inside quotes
+		if i%2 == 1 && len(words) > 1 {
+			phrases = append(phrases, words)
+		}
+	}
+	return terms, phrases
+}
+
+// Function to find the ids of the messages matching the search, newest first,
+// leaving out those expired by now and those in the channels left out
+func (idx *searchIndex) search(req *pb.SearchRequest, now int64, leftOut map[string]bool) []string {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	terms, phrases := parseQuery(req.GetQuery())
+
+	var found []*indexedMessage
+	for _, doc := range idx.candidates(terms) {
+		if (doc.expiresAt > 0 && doc.expiresAt <= now) || leftOut[doc.channel] {
+			continue
+		}
+		if idx.matches(doc, req) && idx.hasPhrases(doc, phrases) {
+			found = append(found, doc)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].order > found[j].order })
+	ids := make([]string, len(found))
+	for i, doc := range found {
+		ids[i] = doc.id
+	}
+	return ids
+}
+
+// Function to get the messages containing every term; all messages if there are no terms
+func (idx *searchIndex) candidates(terms []string) []*indexedMessage {
+	var docs []*indexedMessage
+	if len(terms) == 0 {
+		for _, doc := range idx.docs {
+			docs = append(docs, doc)
+		}
+		return docs
+	}
+
+	// Start from the rarest term, so there's as little as possible to check
+	rarest := terms[0]
+	for _, term := range terms[1:] {
+		if len(idx.postings[term]) < len(idx.postings[rarest]) {
+			rarest = term
+		}
+	}
+
+next:
+	for id := range idx.postings[rarest] {
+		for _, term := range terms {
+			if _, ok := idx.postings[term][id]; !ok {
+				continue next
+			}
+		}
+		docs = append(docs, idx.docs[id])
+	}
+	return docs
+}
+
+// Function to check a message against the channel, sender and time range of the search
+func (idx *searchIndex) matches(doc *indexedMessage, req *pb.SearchRequest) bool {
+	if channel := req.GetChannel().GetName(); channel != "" && doc.channel != channel {
+		return false
+	}
+	if req.GetSender() != "" && doc.sender != req.GetSender() {
+		return false
+	}
+	if req.GetFromTimestamp() != 0 && doc.timestamp < req.GetFromTimestamp() {
+		return false
+	}
+	if req.GetToTimestamp() != 0 && doc.timestamp > req.GetToTimestamp() {
+		return false
+	}
+	if req.GetFromUnixTime() != 0 && doc.unixTime < req.GetFromUnixTime() {
+		return false
+	}
+	if req.GetToUnixTime() != 0 && doc.unixTime > req.GetToUnixTime() {
+		return false
+	}
+	return true
+}
+
+// Function to check every phrase appears in the message, its words right after each other
+func (idx *searchIndex) hasPhrases(doc *indexedMessage, phrases [][]string) bool {
+	for _, phrase := range phrases {
+		if !idx.hasPhrase(doc, phrase) {
+			return false
+		}
+	}
+	return true
+}
+
+func (idx *searchIndex) hasPhrase(doc *indexedMessage, phrase []string) bool {
+next:
+	for _, start := range idx.postings[phrase[0]][doc.id] {
+		for offset, term := range phrase[1:] {
+			if !containsInt(idx.postings[term][doc.id], start+offset+1) {
+				continue next
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+// Search finds the messages matching a query, a page at a time, each with its surrounding messages.
+// Banned users can't search the channel they're banned from, and searching every channel leaves it out.
+func (s *chatServiceServer) Search(ctx context.Context, req *pb.SearchRequest) (*pb.SearchResults, error) {
+	searcher := req.GetChannel().GetSendersName()
+	if name := req.GetChannel().GetName(); name != "" {
+		if err := validateName("channel", name); err != nil {
+			return nil, err
+		}
+		if err := s.checkBan(ctx, name, searcher); err != nil {
+			return nil, err
+		}
+	}
+
+	pageSize := int(req.GetPageSize())
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	contextSize := int(req.GetContext())
+	if contextSize < 0 || contextSize > maxSearchContext {
+		return nil, status.Errorf(codes.InvalidArgument, "context must be between 0 and %v", maxSearchContext)
+	}
+	offset := 0
+	if req.GetPageToken() != "" {
+		var err error
+		if offset, err = strconv.Atoi(req.GetPageToken()); err != nil || offset < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid page token %q", req.GetPageToken())
+		}
+	}
+
+	now := s.now().Unix()
+	ids := s.search.search(req, now, s.bannedChannels(ctx, searcher))
+	results := &pb.SearchResults{Total: int32(len(ids))}
+	if offset >= len(ids) {
+		return results, nil
+	}
+	end := offset + pageSize
+	if end < len(ids) {
+		results.NextPageToken = strconv.Itoa(end)
+	} else {
+		end = len(ids)
+	}
+
+	for _, id := range ids[offset:end] {
+		hit, err := s.history.around(id, contextSize, now)
+		if err != nil {
+			// deleted since the search, leave it out
+			continue
+		}
+		results.Hits = append(results.Hits, hit)
+	}
+	return results, nil
+}
+
+// Function to get the channels user is banned from, or the caller is, under the name the server knows them by
+func (s *chatServiceServer) bannedChannels(ctx context.Context, user string) map[string]bool {
+	users := []string{user}
+	if who, ok := s.knownCaller(ctx); ok {
+		users = append(users, who)
+	}
+	return s.moderation.bannedFrom(users)
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		want []string
+	}{
+		{"The quick brown fox", []string{"the", "quick", "brown", "fox"}},
+		{"hello, world! it's 2024", []string{"hello", "world", "it", "s", "2024"}},
+		{"Ærø øl", []string{"ærø", "øl"}},
+		{"  --- ", []string{}},
+	} {
+		if got := tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	for _, tt := range []struct {
+		query   string
+		terms   []string
+		phrases [][]string
+	}{
+		{query: "quick fox", terms: []string{"quick", "fox"}},
+		{query: `"quick brown" fox`, terms: []string{"quick", "brown", "fox"}, phrases: [][]string{{"quick", "brown"}}},
+		{query: `"fox" "lazy dog`, terms: []string{"fox", "lazy", "dog"}, phrases: [][]string{{"lazy", "dog"}}},
+		{query: `a "b c" d "e f"`, terms: []string{"a", "b", "c", "d", "e", "f"}, phrases: [][]string{{"b", "c"}, {"e", "f"}}},
+		{query: "", terms: nil},
+	} {
+		terms, phrases := parseQuery(tt.query)
+		if !reflect.DeepEqual(terms, tt.terms) || !reflect.DeepEqual(phrases, tt.phrases) {
+			t.Errorf("parseQuery(%q) = %q, %q, want %q, %q", tt.query, terms, phrases, tt.terms, tt.phrases)
+		}
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	idx := newSearchIndex()
+	for i, text := range []string{
+		"the quick brown fox",
+		"brown quick fox",
+		"a quick and brown dog",
+		"nothing to see",
+	} {
+		channel := "Eepy"
+		if i == 2 {
+			channel = "Dev"
+		}
+		idx.index(&pb.Message{Id: strconv.Itoa(i + 1), Sender: "Anon", Message: text, Channel: &pb.Channel{Name: channel}})
+	}
+
+	for _, tt := range []struct {
+		query   string
+		channel string
+		leftOut map[string]bool
+		want    []string
+	}{
+		{query: "quick brown", want: []string{"3", "2", "1"}},
+		{query: `"quick brown"`, want: []string{"1"}},
+		{query: `"brown quick" fox`, want: []string{"2"}},
+		{query: "quick brown", channel: "Eepy", want: []string{"2", "1"}},
+		{query: "quick brown", leftOut: map[string]bool{"Eepy": true}, want: []string{"3"}},
+		{query: "cat", want: []string{}},
+	} {
+		req := &pb.SearchRequest{Query: tt.query, Channel: &pb.Channel{Name: tt.channel}}
+		if got := idx.search(req, 0, tt.leftOut); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search for %q in %q = %q, want %q", tt.query, tt.channel, got, tt.want)
+		}
+	}
+
+	// Edited, a message is found by its new words only
+	idx.index(&pb.Message{Id: "4", Sender: "Anon", Message: "a quick brown cat", Channel: &pb.Channel{Name: "Eepy"}})
+	if got := idx.search(&pb.SearchRequest{Query: "cat"}, 0, nil); !reflect.DeepEqual(got, []string{"4"}) {
+		t.Errorf("search for the edited message = %q", got)
+	}
+	if got := idx.search(&pb.SearchRequest{Query: "nothing"}, 0, nil); len(got) != 0 {
+		t.Errorf("search for the old text of the edited message = %q", got)
+	}
+}
@@ -1,14 +1,21 @@
-package main
+package server
 
 import (
 	pb "ChittyChat/proto"
+	"ChittyChat/storage"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
-	"os"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Struct contains a map of channels and a mutex to protect it.
@@ -18,8 +25,39 @@ import (
 
 type chatServiceServer struct {
 	pb.UnimplementedChatServiceServer
-	channel map[string][]chan *pb.Message
-	Lamport int32 // Remote timestamp; keeps local time for newly joined users
+	mu          sync.Mutex
+	channel     map[string][]*clientStream
+	Lamport     int32 // Remote timestamp; keeps local time for newly joined users
+	limits      *messageLimits
+	retention   *retentionLimits
+	moderation  *moderation
+	filters     *pipelines
+	history     *history
+	mentions    *mentionInbox
+	search      *searchIndex
+	attachments *attachmentStore
+	hooks       Hooks
+	webhooks    *webhooks
+	limiter     *rateLimiter
+	auth        AuthFunc
+	identity    IdentityFunc
+	now         func() time.Time
+	output      io.Writer // where received messages are printed
+	store       storage.Store
+	started     time.Time       // when the server was made, so session ids are new after a restart
+	sessions    int             // sessions started, for their ids
+	importing   map[string]bool // channels an import is going into, see startImport
+}
+
+// clientStream is a single client connected to a channel through JoinChannel.
+// Kicking the client sends the reason on kicked, which ends its stream.
+// done is closed once the stream has ended, so nobody blocks sending to it.
+
+type clientStream struct {
+	name     string
+	messages chan *pb.Message
+	kicked   chan string
+	done     chan struct{}
 }
 
 // JoinChannel function is called when a client joins a server.
@@ -27,11 +65,44 @@ type chatServiceServer struct {
 
 func (s *chatServiceServer) JoinChannel(ch *pb.Channel, msgStream pb.ChatService_JoinChannelServer) error {
 
+	// Reject channel and user names that break the naming rules
+	if err := validateChannel(ch); err != nil {
+		return err
+	}
+
+	// Banned users can't (re)join until their ban runs out
+	if err := s.checkBan(msgStream.Context(), ch.GetName(), ch.GetSendersName()); err != nil {
+		return err
+	}
+
+	// The first user to join a channel becomes its owner
+	s.moderation.claimOwner(ch.GetName(), ch.GetSendersName())
+
+	// Once they've joined, others can @mention them
+	s.mentions.addUser(ch.GetSendersName())
+
+	// Remember who joined, with a session that lasts until they leave or are kicked
+	s.seen(ch.GetSendersName())
+	session := s.startSession(ch.GetName(), ch.GetSendersName())
+	defer s.endSession(session)
+
 	// Create a channel for the client
-	clientChannel := make(chan *pb.Message)
+	client := &clientStream{
+		name:     ch.GetSendersName(),
+		messages: make(chan *pb.Message),
+		kicked:   make(chan string, 1),
+		done:     make(chan struct{}),
+	}
+	defer close(client.done)
 
 	// Add the client-channel to the map
-	s.channel[ch.Name] = append(s.channel[ch.Name], clientChannel)
+	s.mu.Lock()
+	s.channel[ch.Name] = append(s.channel[ch.Name], client)
+	s.mu.Unlock()
+
+	if s.hooks.Join != nil {
+		s.hooks.Join(ch.GetName(), ch.GetSendersName())
+	}
 
 	// doing this never closes the stream
 	for {
@@ -40,24 +111,38 @@ func (s *chatServiceServer) JoinChannel(ch *pb.Channel, msgStream pb.ChatService
 		case <-msgStream.Context().Done():
 
 			//leaveString := fmt.Sprintf("%v has left the channel", ch.GetSendersName())
-			leaveString := fmt.Sprintf("Participant %v has left the Chitty-Chat at Lamport time %v", ch.GetSendersName(), s.Lamport)
+			lamport := s.lamport()
+			leaveString := fmt.Sprintf("Participant %v has left the Chitty-Chat at Lamport time %v", ch.GetSendersName(), lamport)
 
 			// Remove the clientChannel from the slice of channels for this channel
-			s.removeChannel(ch, clientChannel)
+			s.removeChannel(ch, client)
+			if s.hooks.Leave != nil {
+				s.hooks.Leave(ch.GetName(), ch.GetSendersName())
+			}
 
 			// Simulate that the client has sent a farewell message to the server
 			//s.Lamport++
 
 			// Send a message to every client in the channel that a client has left
-			msg := &pb.Message{Sender: ch.Name, Message: leaveString, Channel: ch, Timestamp: s.Lamport}
+			msg := &pb.Message{Sender: ch.Name, Message: leaveString, Channel: ch, Timestamp: lamport}
 
 			s.sendMsgToClients(msg)
 
 			// closes the function by returning nil.
 			return nil
 
+		// if a moderator kicked the client, the stream is ended with the reason
+		case reason := <-client.kicked:
+
+			s.removeChannel(ch, client)
+			if s.hooks.Leave != nil {
+				s.hooks.Leave(ch.GetName(), ch.GetSendersName())
+			}
+
+			return status.Errorf(codes.PermissionDenied, "You were removed from %v: %v", ch.GetName(), reason)
+
 		// if a client sends a message, incr! :D Since server has RECEIVED a msg
-		case msg := <-clientChannel:
+		case msg := <-client.messages:
 
 			//s.incrLamport(msg)
 
@@ -76,8 +161,6 @@ func (s *chatServiceServer) SendMessage(msgStream pb.ChatService_SendMessageServ
 	// Receive message from client
 	msg, err := msgStream.Recv()
 
-	s.incrLamport(msg)
-
 	// if the stream is closed, return nil
 	if err == io.EOF {
 		return nil
@@ -88,11 +171,24 @@ func (s *chatServiceServer) SendMessage(msgStream pb.ChatService_SendMessageServ
 		return err
 	}
 
+	// A banned or muted caller can't get around it by sending another name; accept checks the name they send
+	if err := s.checkBan(msgStream.Context(), msg.GetChannel().GetName(), msg.GetSender()); err != nil {
+		return err
+	}
+	if err := s.checkMute(msgStream.Context(), msg.GetChannel().GetName(), msg.GetSender()); err != nil {
+		return err
+	}
+
+	// Check the message, which the filters may also change
+	if err := s.accept(msg); err != nil {
+		return err
+	}
+
 	// Acknowledge message received to client
 	ack := pb.MessageAck{Status: "Sent"}
 	msgStream.SendAndClose(&ack)
 
-	s.sendMsgToClients(msg)
+	s.publish(msg)
 
 	// Return nil to indicate success
 	// This is required by the protobuf compiler
@@ -101,8 +197,82 @@ func (s *chatServiceServer) SendMessage(msgStream pb.ChatService_SendMessageServ
 	return nil
 }
 
+// Function to check a message may be sent to its channel: clients can't be trusted to check their own messages,
+// and bots and webhooks go through the same rules
+func (s *chatServiceServer) accept(msg *pb.Message) error {
+	// Reactions are counted by the server, from React; a message can't come with some already
+	msg.Reactions = nil
+
+	// Reject messages that break the validation rules
+	if err := s.limits.validateMessage(msg); err != nil {
+		return err
+	}
+
+	// Banned and muted users may not speak in the channel
+	if err := s.moderation.checkBan(msg.GetChannel().GetName(), msg.GetSender()); err != nil {
+		return err
+	}
+	if err := s.moderation.checkMute(msg.GetChannel().GetName(), msg.GetSender()); err != nil {
+		return err
+	}
+
+	// Attached files must have been uploaded first
+	if err := s.attachments.check(msg.GetAttachments()); err != nil {
+		return err
+	}
+
+	// A reply must be to a message that's in the same channel
+	if msg.GetReplyTo() != "" {
+		if _, err := s.history.get(msg.GetChannel().GetName(), msg.GetReplyTo()); err != nil {
+			return err
+		}
+	}
+
+	// Run the message through the channel's filters, which may rewrite, flag or reject it
+	return s.filters.process(msg)
+}
+
+// Function to stamp an accepted message with the Lamport time, give it an id and send it to the channel
+func (s *chatServiceServer) publish(msg *pb.Message) {
+	// Only the server edits, deletes and reacts to messages, and counts their revisions; a new message has none of that yet
+	msg.Event = pb.Event_MESSAGE
+	msg.Edits = nil
+	msg.Reactions = nil
+	msg.Revision = 0
+
+	s.incrLamport(msg)
+
+	// Give the message an id so it can be edited or deleted later, and find who it @mentions
+	if msg.GetMessage() != joinMessage {
+		s.history.assignID(msg)
+		msg.Mentions = s.mentions.parse(msg.GetMessage())
+		msg.UnixTime = s.now().Unix()
+		msg.ExpiresAt = 0
+		if msg.GetTtlSeconds() > 0 {
+			msg.ExpiresAt = msg.UnixTime + msg.GetTtlSeconds()
+		}
+	}
+
+	s.sendMsgToClients(msg)
+
+	if msg.GetId() != "" {
+		s.history.add(msg)
+		s.mentions.deliver(msg)
+		s.search.index(msg)
+	}
+}
+
+// Function to read the server's Lamport timestamp
+func (s *chatServiceServer) lamport() int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Lamport
+}
+
 // Function to increase server's Lamport timestamp; used after receiving a message
 func (s *chatServiceServer) incrLamport(msg *pb.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if msg.GetTimestamp() > s.Lamport {
 		s.Lamport = msg.GetTimestamp() + 1
 	} else {
@@ -112,10 +282,12 @@ func (s *chatServiceServer) incrLamport(msg *pb.Message) {
 }
 
 // Function to remove the channel from the map after the client has left
-func (s *chatServiceServer) removeChannel(ch *pb.Channel, currClientChannel chan *pb.Message) {
+func (s *chatServiceServer) removeChannel(ch *pb.Channel, currClient *clientStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	channels := s.channel[ch.Name]
 	for i, channel := range channels {
-		if channel == currClientChannel {
+		if channel == currClient {
 			s.channel[ch.Name] = append(channels[:i], channels[i+1:]...)
 			break
 		}
@@ -127,67 +299,324 @@ func (s *chatServiceServer) sendMsgToClients(msg *pb.Message) {
 	s.incrLamport(msg)
 
 	go func() {
-		if msg.Message == "9cbf281b855e41b4ad9f97707efdd29d" {
+		if msg.Message == joinMessage {
 			msg.Message = fmt.Sprintf("Participant %v joined Chitty-Chat at Lamport time %v", msg.GetSender(), msg.GetTimestamp()-2)
-			fmt.Println("Received at Lamport time %v: %v", msg.GetTimestamp(), msg.GetMessage())
-			log.Println("Received at Lamport time %v: %v", msg.GetTimestamp(), msg.GetMessage())
+			fmt.Fprintf(s.output, "Received at Lamport time %v: %v\n", msg.GetTimestamp(), msg.GetMessage())
+			log.Printf("Received at Lamport time %v: %v\n", msg.GetTimestamp(), msg.GetMessage())
 		} else {
 			formattedMessage := formatMessage(msg)
 			log.Printf("Received at " + formattedMessage)
-			fmt.Printf("Received at " + formattedMessage)
+			fmt.Fprint(s.output, "Received at "+formattedMessage)
+		}
+
+		// Copy the clients so the lock isn't held while waiting on them
+		s.mu.Lock()
+		streams := append([]*clientStream(nil), s.channel[msg.Channel.Name]...)
+		s.mu.Unlock()
+
+		for _, client := range streams {
+			select {
+			case client.messages <- msg:
+			case <-client.done:
+			}
 		}
 
-		streams := s.channel[msg.Channel.Name]
-		for _, clientChan := range streams {
-			clientChan <- msg
+		if s.hooks.Message != nil {
+			s.hooks.Message(msg)
 		}
+		s.webhooks.post(msg)
 	}()
 }
 
+// Clients send this as their first message to announce they've joined
+const joinMessage = "9cbf281b855e41b4ad9f97707efdd29d"
+
 // Function to format message to be printed to the server
 func formatMessage(msg *pb.Message) string {
+	switch msg.GetEvent() {
+	case pb.Event_EDITED:
+		return fmt.Sprintf("Lamport time: %v [%v] edited #%v: %v\n", msg.GetTimestamp(), lastEditor(msg), msg.GetId(), msg.GetMessage())
+	case pb.Event_DELETED:
+		return fmt.Sprintf("Lamport time: %v [%v] deleted #%v\n", msg.GetTimestamp(), lastEditor(msg), msg.GetId())
+	case pb.Event_REACTED:
+		return fmt.Sprintf("Lamport time: %v reactions to #%v: %v\n", msg.GetTimestamp(), msg.GetId(), formatReactions(msg))
+	}
+	if msg.GetReplyTo() != "" {
+		return fmt.Sprintf("Lamport time: %v [%v] replying to #%v: %v\n", msg.GetTimestamp(), msg.GetSender(), msg.GetReplyTo(), msg.GetMessage())
+	}
 	return fmt.Sprintf("Lamport time: %v [%v]: %v\n", msg.GetTimestamp(), msg.GetSender(), msg.GetMessage())
 }
 
-func main() {
-	// Sets the logger to use a log.txt file instead of the console
-	f := setLog()
-	defer f.Close()
-	lis, err := net.Listen("tcp", ":8080")
+// Function to format the reactions to a message, e.g. "👍 2  ❤️ 1"
+func formatReactions(msg *pb.Message) string {
+	var counts []string
+	for _, reaction := range msg.GetReactions() {
+		counts = append(counts, fmt.Sprintf("%v %v", reaction.GetEmoji(), len(reaction.GetUsers())))
+	}
+	if len(counts) == 0 {
+		return "none"
+	}
+	return strings.Join(counts, "  ")
+}
+
+// Function to get who last edited or deleted a message
+func lastEditor(msg *pb.Message) string {
+	if len(msg.GetEdits()) == 0 {
+		return msg.GetSender()
+	}
+	return msg.GetEdits()[len(msg.GetEdits())-1].GetEditor()
+}
+
+// Server is a ChittyChat server, to run on its own (see cmd/server) or inside another program.
+type Server struct {
+	grpc    *grpc.Server
+	chat    *chatServiceServer
+	addr    string
+	lis     net.Listener
+	bots    []registeredBot
+	gateway bool
+	webUI   bool
+	ircAddr string
+	irc     *ircServer
+	http    *http.Server  // incoming webhooks; nil when they have no address
+	stop    chan struct{} // closed on Stop, to take the bots out of their channels and end the compactor
+
+	compactInterval time.Duration
+	ownStore        bool // whether Stop closes the chat's store, i.e. it wasn't given WithStore
+
+	mu      sync.Mutex
+	started bool
+	done    chan struct{}
+	err     error
+}
+
+// New makes a server with the given options; it doesn't listen until Start.
+func New(opts ...Option) (*Server, error) {
+	o := options{config: DefaultConfig(), addr: ":8080", now: time.Now, output: io.Discard}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	cfg := o.config
+
+	// Config can be made in code as well as from flags, so check the filters exist
+	if _, err := ParseFilterList(strings.Join(cfg.Filters, ",")); err != nil {
+		return nil, err
+	}
+	for channel, filters := range cfg.ChannelFilters {
+		if _, err := ParseFilterList(strings.Join(filters, ",")); err != nil {
+			return nil, fmt.Errorf("filters for channel %v: %w", channel, err)
+		}
+	}
+
+	if err := validateBots(o.bots); err != nil {
+		return nil, err
+	}
+	hooks, err := newWebhooks(o.webhooks)
+	if err != nil {
+		return nil, err
+	}
 
+	attachments, err := newAttachmentStore(cfg.AttachmentDir, cfg.MaxFileSize, cfg.UserQuota)
 	if err != nil {
-		log.Fatalf("Failed to listen on port 8080: %v", err)
+		return nil, fmt.Errorf("cannot use attachment folder %v: %w", cfg.AttachmentDir, err)
+	}
+
+	limiter := newRateLimiter(
+		bucketConfig{rate: cfg.UserRate, burst: cfg.UserBurst},
+		bucketConfig{rate: cfg.ChannelRate, burst: cfg.ChannelBurst},
+		o.identity,
+		o.now,
+	)
+	streamInterceptors := []grpc.StreamServerInterceptor{limiter.streamInterceptor}
+	var unaryInterceptors []grpc.UnaryServerInterceptor
+	if o.auth != nil {
+		streamInterceptors = append([]grpc.StreamServerInterceptor{o.auth.streamInterceptor}, streamInterceptors...)
+		unaryInterceptors = append(unaryInterceptors, o.auth.unaryInterceptor)
+	}
+
+	serverOpts := []grpc.ServerOption{
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+	}
+	grpcServer := grpc.NewServer(append(serverOpts, o.grpc...)...)
+
+	// Without a store of its own, the server keeps things in HistoryDir, or in memory
+	store, ownStore := o.store, o.store == nil
+	switch {
+	case o.store != nil:
+	case cfg.HistoryDir != "":
+		store, err = storage.OpenFile(cfg.HistoryDir)
+		if err != nil {
+			return nil, fmt.Errorf("cannot use history folder %v: %w", cfg.HistoryDir, err)
+		}
+	default:
+		store = storage.NewMemory()
 	}
-	fmt.Println("--- CHITTY CHAT ---")
 
-	var opts []grpc.ServerOption
-	grpcServer := grpc.NewServer(opts...)
-	pb.RegisterChatServiceServer(grpcServer, &chatServiceServer{
-		channel: make(map[string][]chan *pb.Message),
+	chat := &chatServiceServer{
+		channel:   make(map[string][]*clientStream),
+		importing: make(map[string]bool),
 		//Remote timestamp
-		Lamport: 0,
-	})
+		Lamport:    0,
+		limits:     &messageLimits{defaultMax: cfg.MaxLength, channelMax: cfg.ChannelMaxLength},
+		retention:  &retentionLimits{defaultRetention: cfg.Retention, channelRetention: cfg.ChannelRetention},
+		moderation: newModeration(o.now, store),
+		filters: newPipelines(&filterConfig{
+			defaultFilters: cfg.Filters,
+			channelFilters: cfg.ChannelFilters,
+			blocklist:      cfg.Blocklist,
+			now:            o.now,
+		}),
+		history:     newHistory(store),
+		mentions:    newMentionInbox(),
+		search:      newSearchIndex(),
+		attachments: attachments,
+		hooks:       o.hooks,
+		webhooks:    hooks,
+		limiter:     limiter,
+		auth:        o.auth,
+		identity:    o.identity,
+		now:         o.now,
+		output:      o.output,
+		store:       store,
+		started:     o.now(),
+	}
+	if err := chat.load(); err != nil {
+		if ownStore {
+			store.Close()
+		}
+		return nil, fmt.Errorf("cannot load what the server kept: %w", err)
+	}
+	pb.RegisterChatServiceServer(grpcServer, chat)
 
-	fmt.Printf("Server started at Lamport time: %v\n", 0)
-	log.Printf("Server started at Lamport time: %v\n", 0)
+	srv := &Server{grpc: grpcServer, chat: chat, addr: o.addr, lis: o.listener, bots: o.bots, gateway: o.gateway, webUI: o.webUI, ircAddr: o.ircAddr, irc: newIRCServer(chat), ownStore: ownStore, compactInterval: cfg.CompactInterval, stop: make(chan struct{}), done: make(chan struct{})}
+	if o.httpAddr != "" {
+		srv.http = &http.Server{Addr: o.httpAddr, Handler: srv.HTTPHandler()}
+	}
+	return srv, nil
+}
 
-	grpcServer.Serve(lis)
+// Start listens (unless the server was given a listener) and serves in the background.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return errors.New("server already started")
+	}
+	if s.lis == nil {
+		lis, err := net.Listen("tcp", s.addr)
+		if err != nil {
+			return err
+		}
+		s.lis = lis
+	}
+	if s.http != nil {
+		lis, err := net.Listen("tcp", s.http.Addr)
+		if err != nil {
+			s.lis.Close()
+			return err
+		}
+		go s.http.Serve(lis)
+	}
+	if s.ircAddr != "" {
+		lis, err := net.Listen("tcp", s.ircAddr)
+		if err != nil {
+			s.lis.Close()
+			if s.http != nil {
+				s.http.Close()
+			}
+			return err
+		}
+		s.irc.start(lis)
+	}
+	s.started = true
+
+	for _, bot := range s.bots {
+		s.chat.startBot(bot, s.stop)
+	}
+	if s.compactInterval > 0 {
+		go s.chat.compactor(s.compactInterval, s.stop)
+	}
+
+	go func() {
+		err := s.grpc.Serve(s.lis)
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		close(s.done)
+	}()
+	return nil
 }
 
-// sets the logger to use a log.txt file instead of the console
-func setLog() *os.File {
-	// Clears the log.txt file when a new server is started
-	if _, err := os.Open("Server.txt"); err == nil {
-		if err := os.Truncate("Server.txt", 0); err != nil {
-			log.Printf("Failed to truncate: %v", err)
+// Stop closes the listener and every client's connection. Clients are in their channels until they leave,
+// so there's nothing to wait for.
+func (s *Server) Stop() {
+	s.grpc.Stop()
+	if s.http != nil {
+		s.http.Close()
+	}
+	s.irc.stop()
+	s.mu.Lock()
+	started := s.started
+	if started {
+		select {
+		case <-s.stop:
+		default:
+			close(s.stop)
 		}
 	}
+	s.mu.Unlock()
+	if started {
+		<-s.done
+	}
+	if s.ownStore {
+		s.chat.store.Close()
+	}
+}
 
-	// This connects to the log file/changes the output of the log information to the log.txt file.
-	f, err := os.OpenFile("Server.txt", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		log.Fatalf("error opening file: %v", err)
+// HTTPHandler returns the HTTP handler for incoming webhooks and, when they're on, the gateway and the web client,
+// to serve them alongside other handlers instead of on their own address
+func (s *Server) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(webhookPath, s.chat.serveWebhook)
+	if s.gateway || s.webUI {
+		mux.HandleFunc(gatewayPath, s.chat.serveGateway)
+		mux.HandleFunc(gatewayPath+"/", s.chat.serveGateway)
+	}
+	if s.webUI {
+		mux.Handle("/", webUI())
+	}
+	return mux
+}
+
+// Wait blocks until the server stops serving, and returns why if it wasn't Stop
+func (s *Server) Wait() error {
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == grpc.ErrServerStopped {
+		return nil
 	}
-	log.SetOutput(f)
-	return f
+	return s.err
+}
+
+// Addr returns the address the server listens on, e.g. to find the port after listening on ":0"; nil before Start
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lis == nil {
+		return nil
+	}
+	return s.lis.Addr()
+}
+
+// IRCAddr returns the address IRC clients connect to, e.g. to find the port after WithIRCAddress("localhost:0");
+// nil without WithIRCAddress or before Start
+func (s *Server) IRCAddr() net.Addr {
+	return s.irc.addr()
+}
+
+// Lamport returns the server's Lamport time
+func (s *Server) Lamport() int32 {
+	return s.chat.lamport()
 }
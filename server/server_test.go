@@ -0,0 +1,846 @@
+package server_test
+
+import (
+	pb "ChittyChat/proto"
+	"ChittyChat/server"
+	"ChittyChat/storage"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Function to tell who's calling in tests: the "user" metadata, as given by as
+func testIdentity(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if users := md.Get("user"); len(users) > 0 {
+		return users[0], nil
+	}
+	return "", errors.New("no user")
+}
+
+// Function to get a context for calls made as user
+func as(user string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "user", user)
+}
+
+// Function to get the settings tests run with: limits high enough not to get in the way, and no filters
+func testConfig() server.Config {
+	cfg := server.DefaultConfig()
+	cfg.UserRate, cfg.UserBurst = 1000, 1000
+	cfg.ChannelRate, cfg.ChannelBurst = 1000, 1000
+	cfg.Filters = nil
+	return cfg
+}
+
+// Function to start a server on an in-process listener, with testConfig unless opts has its own, and connect to it
+func startServer(t *testing.T, opts ...server.Option) (*server.Server, pb.ChatServiceClient) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	opts = append([]server.Option{server.WithConfig(testConfig()), server.WithListener(lis)}, opts...)
+	srv, err := server.New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Stop)
+
+	dialer := grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	})
+	conn, err := grpc.Dial("bufnet", dialer, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return srv, pb.NewChatServiceClient(conn)
+}
+
+// Function to join channel as user; the stream ends with the test
+func join(t *testing.T, c pb.ChatServiceClient, channel, user string) pb.ChatService_JoinChannelClient {
+	t.Helper()
+	ctx, cancel := context.WithCancel(as(user))
+	t.Cleanup(cancel)
+	stream, err := c.JoinChannel(ctx, &pb.Channel{Name: channel, SendersName: user})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+// Function to send msg to its channel, returning the error the server answers with
+func send(c pb.ChatServiceClient, msg *pb.Message) error {
+	stream, err := c.SendMessage(as(msg.GetSender()))
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(msg); err != nil {
+		return err
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+func message(channel, user, text string) *pb.Message {
+	return &pb.Message{Sender: user, Message: text, Channel: &pb.Channel{Name: channel, SendersName: user}}
+}
+
+// Function to receive from stream until a message with the given text arrives, which it returns
+func receive(t *testing.T, stream pb.ChatService_JoinChannelClient, text string) *pb.Message {
+	t.Helper()
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("waiting for %q: %v", text, err)
+		}
+		if msg.GetMessage() == text {
+			return msg
+		}
+	}
+}
+
+// Function to join channel as user and wait until the server lists them in it
+func joined(t *testing.T, c pb.ChatServiceClient, channel, user string) pb.ChatService_JoinChannelClient {
+	t.Helper()
+	stream := join(t, c, channel, user)
+	listed(t, c, channel, user)
+	return stream
+}
+
+// Function to wait until the server lists user in channel
+func listed(t *testing.T, c pb.ChatServiceClient, channel, user string) {
+	t.Helper()
+	for i := 0; i < 500; i++ {
+		list, err := c.ListChannels(context.Background(), &pb.Channel{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, info := range list.GetChannels() {
+			if info.GetName() != channel {
+				continue
+			}
+			for _, member := range info.GetMembers() {
+				if member == user {
+					return
+				}
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%v never joined %v", user, channel)
+}
+
+func TestJoinSendKickStop(t *testing.T) {
+	srv, c := startServer(t, server.WithIdentity(testIdentity))
+
+	// Anon joins first, so owns the channel
+	anon := joined(t, c, "Eepy", "Anon")
+	bob := joined(t, c, "Eepy", "Bob")
+
+	if err := send(c, message("Eepy", "Anon", "hello Bob")); err != nil {
+		t.Fatal(err)
+	}
+	got := receive(t, bob, "hello Bob")
+	if got.GetSender() != "Anon" || got.GetId() == "" || got.GetTimestamp() == 0 {
+		t.Errorf("Bob received %v, want a message from Anon with an id and a Lamport time", got)
+	}
+	receive(t, anon, "hello Bob")
+
+	// Sending the owner's name isn't enough to moderate
+	kick := &pb.ModerationRequest{Channel: &pb.Channel{Name: "Eepy", SendersName: "Anon"}, Target: "Bob"}
+	if _, err := c.Kick(as("Mallory"), kick); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Kick as Mallory claiming to be Anon returned %v, want PermissionDenied", err)
+	}
+
+	if _, err := c.Kick(as("Anon"), kick); err != nil {
+		t.Fatalf("Kick: %v", err)
+	}
+	for {
+		_, err := bob.Recv()
+		if err != nil {
+			if status.Code(err) != codes.PermissionDenied {
+				t.Errorf("Bob's stream ended with %v, want PermissionDenied", err)
+			}
+			break
+		}
+	}
+	receive(t, anon, "Participant Bob was kicked by Anon")
+
+	// Stop ends the streams still open, and Wait returns without an error
+	srv.Stop()
+	for {
+		if _, err := anon.Recv(); err != nil {
+			break
+		}
+	}
+	done := make(chan error, 1)
+	go func() { done <- srv.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Wait after Stop returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait didn't return after Stop")
+	}
+}
+
+func TestModerationNeedsIdentity(t *testing.T) {
+	_, c := startServer(t)
+
+	joined(t, c, "Eepy", "Anon")
+	_, err := c.Ban(as("Anon"), &pb.ModerationRequest{Channel: &pb.Channel{Name: "Eepy", SendersName: "Anon"}, Target: "Bob"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Ban on a server without WithIdentity returned %v, want PermissionDenied", err)
+	}
+}
+
+func TestNewMessageCannotClaimEdits(t *testing.T) {
+	_, c := startServer(t)
+	anon := joined(t, c, "Eepy", "Anon")
+
+	forged := message("Eepy", "Anon", "never edited")
+	forged.Event = pb.Event_EDITED
+	forged.Edits = []*pb.Edit{{Previous: "something else", Editor: "Bob", Timestamp: 1}}
+	forged.Revision = 99
+	if err := send(c, forged); err != nil {
+		t.Fatal(err)
+	}
+	got := receive(t, anon, "never edited")
+	if got.GetEvent() != pb.Event_MESSAGE || len(got.GetEdits()) != 0 || got.GetRevision() == 99 {
+		t.Errorf("received %v, want a new message without edits", got)
+	}
+
+	history, err := c.GetHistory(context.Background(), &pb.HistoryRequest{Channel: &pb.Channel{Name: "Eepy", SendersName: "Anon"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range history.GetMessages() {
+		if msg.GetEvent() != pb.Event_MESSAGE || len(msg.GetEdits()) != 0 {
+			t.Errorf("history has %v, want it stored as a new message", msg)
+		}
+	}
+}
+
+func TestForgedReactionsAreDropped(t *testing.T) {
+	_, c := startServer(t)
+	anon := joined(t, c, "Eepy", "Anon")
+
+	forged := message("Eepy", "Anon", "popular")
+	forged.Reactions = []*pb.Reaction{{Emoji: "👍", Users: []string{"Bob", "Carol", "Dave", "Erin"}}}
+	if err := send(c, forged); err != nil {
+		t.Fatal(err)
+	}
+	got := receive(t, anon, "popular")
+	if len(got.GetReactions()) != 0 {
+		t.Errorf("received %v, want no reactions", got.GetReactions())
+	}
+
+	// Only reactions sent with React count
+	react := &pb.ReactionRequest{Channel: &pb.Channel{Name: "Eepy", SendersName: "Bob"}, Id: got.GetId(), Emoji: "👍"}
+	if _, err := c.React(context.Background(), react); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		event, err := anon.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.GetEvent() != pb.Event_REACTED {
+			continue
+		}
+		reactions := event.GetReactions()
+		if len(reactions) != 1 || reactions[0].GetEmoji() != "👍" || len(reactions[0].GetUsers()) != 1 || reactions[0].GetUsers()[0] != "Bob" {
+			t.Errorf("reactions are %v, want 👍 from Bob only", reactions)
+		}
+		break
+	}
+}
+
+// Function to get the text of the messages user was mentioned in
+func mentionsOf(t *testing.T, c pb.ChatServiceClient, user string) []string {
+	t.Helper()
+	mentions, err := c.ListMentions(as(user), &pb.MentionsRequest{User: user})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, msg := range mentions.GetMessages() {
+		texts = append(texts, msg.GetMessage())
+	}
+	return texts
+}
+
+func TestMentionsFollowEditsAndDeletes(t *testing.T) {
+	_, c := startServer(t)
+	anon := joined(t, c, "Eepy", "Anon")
+	joined(t, c, "Eepy", "Bob")
+	joined(t, c, "Eepy", "Carol")
+
+	if err := send(c, message("Eepy", "Anon", "secret for @Bob")); err != nil {
+		t.Fatal(err)
+	}
+	id := receive(t, anon, "secret for @Bob").GetId()
+	if got := mentionsOf(t, c, "Bob"); len(got) != 1 || got[0] != "secret for @Bob" {
+		t.Fatalf("Bob's mentions are %q, want the message", got)
+	}
+
+	// Edited to mention Carol instead: Bob loses it, Carol gets the new text
+	edit := &pb.EditRequest{Channel: &pb.Channel{Name: "Eepy", SendersName: "Anon"}, Id: id, Message: "never mind @Carol"}
+	if _, err := c.EditMessage(context.Background(), edit); err != nil {
+		t.Fatal(err)
+	}
+	if got := mentionsOf(t, c, "Bob"); len(got) != 0 {
+		t.Errorf("Bob's mentions after the edit are %q, want none", got)
+	}
+	if got := mentionsOf(t, c, "Carol"); len(got) != 1 || got[0] != "never mind @Carol" {
+		t.Errorf("Carol's mentions after the edit are %q, want the edited message", got)
+	}
+
+	// Deleted: its text can't be read through anyone's mentions anymore
+	if _, err := c.DeleteMessage(context.Background(), &pb.EditRequest{Channel: edit.Channel, Id: id}); err != nil {
+		t.Fatal(err)
+	}
+	if got := mentionsOf(t, c, "Carol"); len(got) != 0 {
+		t.Errorf("Carol's mentions after the delete are %q, want none", got)
+	}
+}
+
+// noCatsFilter is a filter from outside the server package, to check RegisterFilter
+type noCatsFilter struct{}
+
+func (noCatsFilter) Filter(msg *pb.Message) (server.Verdict, string) {
+	if strings.Contains(strings.ToLower(msg.GetMessage()), "cat") {
+		return server.Rejected, "no cats"
+	}
+	return server.Accepted, ""
+}
+
+func init() {
+	server.RegisterFilter("nocats", func(server.FilterSettings) server.Filter { return noCatsFilter{} })
+}
+
+func TestRegisteredFilter(t *testing.T) {
+	cfg := testConfig()
+	cfg.ChannelFilters = server.ChannelFilters{"Dogs": {"nocats"}}
+	_, c := startServer(t, server.WithConfig(cfg))
+	dogs := joined(t, c, "Dogs", "Anon")
+	joined(t, c, "Eepy", "Anon")
+
+	err := send(c, message("Dogs", "Anon", "look at my cat"))
+	if status.Code(err) != codes.InvalidArgument || !strings.Contains(status.Convert(err).Message(), "no cats") {
+		t.Errorf("sending a cat to Dogs returned %v, want it rejected by nocats", err)
+	}
+	if err := send(c, message("Dogs", "Anon", "look at my dog")); err != nil {
+		t.Errorf("sending a dog to Dogs returned %v", err)
+	}
+	receive(t, dogs, "look at my dog")
+
+	// Other channels don't run it
+	if err := send(c, message("Eepy", "Anon", "look at my cat")); err != nil {
+		t.Errorf("sending a cat to Eepy returned %v", err)
+	}
+}
+
+// Function to import an archive with the given header and messages into channel, as Anon
+func importArchive(c pb.ChatServiceClient, channel string, header *pb.ArchiveHeader, messages ...*pb.Message) error {
+	stream, err := c.ImportChannel(as("Anon"))
+	if err != nil {
+		return err
+	}
+	first := &pb.ImportChunk{Channel: &pb.Channel{Name: channel, SendersName: "Anon"}, Record: &pb.ArchiveRecord{Record: &pb.ArchiveRecord_Header{Header: header}}}
+	if err := stream.Send(first); err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		if err := stream.Send(&pb.ImportChunk{Record: &pb.ArchiveRecord{Record: &pb.ArchiveRecord_Message{Message: msg}}}); err != nil {
+			return err
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+func TestImportChecksMessages(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxLength = 10
+	_, c := startServer(t, server.WithConfig(cfg))
+	header := &pb.ArchiveHeader{Version: 1, Channel: "Old", Lamport: 5}
+
+	overflowing := &pb.ArchiveHeader{Version: 1, Channel: "Old", Lamport: math.MaxInt32}
+	if err := importArchive(c, "New", overflowing); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("importing a clock about to overflow returned %v, want InvalidArgument", err)
+	}
+	for why, msg := range map[string]*pb.Message{
+		"a message about to overflow the clock": {Sender: "Bob", Message: "hi", Timestamp: math.MaxInt32},
+		"a message too long for the channel":    {Sender: "Bob", Message: "far too long for ten", Timestamp: 1},
+		"a file that isn't on this server":      {Sender: "Bob", Message: "look", Timestamp: 1, Attachments: []*pb.Attachment{{Name: "a.png", Sha256: strings.Repeat("ab", 32)}}},
+		"an empty message":                      {Sender: "Bob", Message: "\x1b\x07", Timestamp: 1},
+		"an edit about to overflow the clock":   {Sender: "Bob", Message: "hi", Timestamp: 1, Event: pb.Event_EDITED, Edits: []*pb.Edit{{Editor: "Bob", Previous: "ho", Timestamp: math.MaxInt32}}},
+	} {
+		if err := importArchive(c, "New", header, msg); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("importing %v returned %v, want InvalidArgument", why, err)
+		}
+	}
+
+	// Control characters are stripped, as from live messages
+	if err := importArchive(c, "New", header, &pb.Message{Sender: "Bob", Message: "hi\x1b[2J", Timestamp: 1}); err != nil {
+		t.Fatal(err)
+	}
+	history, err := c.GetHistory(context.Background(), &pb.HistoryRequest{Channel: &pb.Channel{Name: "New", SendersName: "Anon"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs := history.GetMessages(); len(msgs) != 1 || msgs[0].GetMessage() != "hi[2J" {
+		t.Errorf("imported history is %v, want the message without the escape", msgs)
+	}
+}
+
+func TestOnlyAuthorOrModeratorEdits(t *testing.T) {
+	_, c := startServer(t, server.WithIdentity(testIdentity))
+	anon := joined(t, c, "Eepy", "Anon") // the owner
+	joined(t, c, "Eepy", "Bob")
+	joined(t, c, "Eepy", "Mallory")
+
+	if err := send(c, message("Eepy", "Bob", "Bob's words")); err != nil {
+		t.Fatal(err)
+	}
+	id := receive(t, anon, "Bob's words").GetId()
+	asBob := &pb.EditRequest{Channel: &pb.Channel{Name: "Eepy", SendersName: "Bob"}, Id: id, Message: "Mallory's words"}
+
+	// Sending Bob's name isn't enough to be him
+	if _, err := c.EditMessage(as("Mallory"), asBob); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Mallory editing as Bob returned %v, want PermissionDenied", err)
+	}
+	if _, err := c.DeleteMessage(as("Mallory"), asBob); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Mallory deleting as Bob returned %v, want PermissionDenied", err)
+	}
+	asMallory := &pb.EditRequest{Channel: &pb.Channel{Name: "Eepy", SendersName: "Mallory"}, Id: id, Message: "Mallory's words"}
+	if _, err := c.EditMessage(as("Mallory"), asMallory); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Mallory editing Bob's message returned %v, want PermissionDenied", err)
+	}
+
+	// Bob can edit his own
+	asBob.Message = "Bob's better words"
+	if _, err := c.EditMessage(as("Bob"), asBob); err != nil {
+		t.Errorf("Bob editing his message returned %v", err)
+	}
+
+	// And the owner can delete it
+	asOwner := &pb.EditRequest{Channel: &pb.Channel{Name: "Eepy", SendersName: "Anon"}, Id: id}
+	if _, err := c.DeleteMessage(as("Anon"), asOwner); err != nil {
+		t.Fatalf("the owner deleting Bob's message returned %v", err)
+	}
+	for {
+		msg, err := anon.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.GetId() == id && msg.GetEvent() == pb.Event_DELETED {
+			if lastEdit := msg.GetEdits()[len(msg.GetEdits())-1]; lastEdit.GetEditor() != "Anon" {
+				t.Errorf("deleted by %v, want Anon", lastEdit.GetEditor())
+			}
+			break
+		}
+	}
+}
+
+func TestMentionsAreOnlyForTheirUser(t *testing.T) {
+	_, c := startServer(t, server.WithIdentity(testIdentity))
+	anon := joined(t, c, "Eepy", "Anon")
+	joined(t, c, "Eepy", "Bob")
+	if err := send(c, message("Eepy", "Anon", "secret for @Bob")); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, anon, "secret for @Bob")
+
+	if _, err := c.ListMentions(as("Mallory"), &pb.MentionsRequest{User: "Bob"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Mallory listing Bob's mentions returned %v, want PermissionDenied", err)
+	}
+	if got := mentionsOf(t, c, "Bob"); len(got) != 1 || got[0] != "secret for @Bob" {
+		t.Errorf("Bob's mentions are %q, want the message", got)
+	}
+}
+
+func TestMentionsOutliveRestart(t *testing.T) {
+	store := storage.NewMemory()
+	srv, c := startServer(t, server.WithStore(store))
+	anon := joined(t, c, "Eepy", "Anon")
+	joined(t, c, "Eepy", "Bob")
+	for _, text := range []string{"for @Bob", "not for anyone", "for @Bob again"} {
+		if err := send(c, message("Eepy", "Anon", text)); err != nil {
+			t.Fatal(err)
+		}
+		receive(t, anon, text)
+	}
+	srv.Stop()
+
+	_, c = startServer(t, server.WithStore(store))
+	if got := mentionsOf(t, c, "Bob"); len(got) != 2 || got[0] != "for @Bob" || got[1] != "for @Bob again" {
+		t.Errorf("Bob's mentions after a restart are %q, want both messages mentioning him", got)
+	}
+}
+
+func TestBanHoldsUnderAnotherName(t *testing.T) {
+	_, c := startServer(t, server.WithIdentity(testIdentity))
+	anon := joined(t, c, "Eepy", "Anon")
+	joined(t, c, "Eepy", "Mallory")
+
+	mod := func(target string) *pb.ModerationRequest {
+		return &pb.ModerationRequest{Channel: &pb.Channel{Name: "Eepy", SendersName: "Anon"}, Target: target}
+	}
+	if _, err := c.Mute(as("Anon"), mod("Mallory")); err != nil {
+		t.Fatal(err)
+	}
+	sendAs := func(caller string, msg *pb.Message) error {
+		stream, err := c.SendMessage(as(caller))
+		if err != nil {
+			return err
+		}
+		stream.Send(msg)
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+	if err := sendAs("Mallory", message("Eepy", "Molly", "not Mallory")); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("muted Mallory sending as Molly returned %v, want PermissionDenied", err)
+	}
+
+	if _, err := c.Ban(as("Anon"), mod("Mallory")); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, anon, "Participant Mallory was banned by Anon")
+	stream, err := c.JoinChannel(as("Mallory"), &pb.Channel{Name: "Eepy", SendersName: "Molly"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("banned Mallory joining as Molly returned %v, want PermissionDenied", err)
+	}
+
+	// Someone else sending as Molly is fine
+	if err := sendAs("Molly", message("Eepy", "Molly", "the real Molly")); err != nil {
+		t.Errorf("Molly sending returned %v", err)
+	}
+}
+
+func TestBanDurationIsBounded(t *testing.T) {
+	_, c := startServer(t, server.WithIdentity(testIdentity))
+	joined(t, c, "Eepy", "Anon")
+	joined(t, c, "Eepy", "Bob")
+
+	for _, seconds := range []int64{-1, math.MaxInt64, math.MaxInt64/int64(time.Second) + 1} {
+		req := &pb.ModerationRequest{Channel: &pb.Channel{Name: "Eepy", SendersName: "Anon"}, Target: "Bob", DurationSeconds: seconds}
+		if _, err := c.Ban(as("Anon"), req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Ban for %v seconds returned %v, want InvalidArgument", seconds, err)
+		}
+	}
+	if err := send(c, message("Eepy", "Bob", "still here")); err != nil {
+		t.Errorf("Bob sending after the refused bans returned %v", err)
+	}
+}
+
+func TestImportChecksAuditLog(t *testing.T) {
+	header := &pb.ArchiveHeader{Version: 1, Channel: "Old", Lamport: 5}
+	importAudit := func(c pb.ChatServiceClient, entry *pb.AuditEntry) error {
+		stream, err := c.ImportChannel(as("Anon"))
+		if err != nil {
+			return err
+		}
+		stream.Send(&pb.ImportChunk{Channel: &pb.Channel{Name: "New", SendersName: "Anon"}, Record: &pb.ArchiveRecord{Record: &pb.ArchiveRecord_Header{Header: header}}})
+		stream.Send(&pb.ImportChunk{Record: &pb.ArchiveRecord{Record: &pb.ArchiveRecord_Audit{Audit: entry}}})
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+
+	_, c := startServer(t)
+	for why, entry := range map[string]*pb.AuditEntry{
+		"an entry about to overflow the clock": {Moderator: "Anon", Action: "ban", Target: "Bob", Timestamp: math.MaxInt32},
+		"an unknown action":                    {Moderator: "Anon", Action: "pardon", Target: "Bob", Timestamp: 1},
+		"a moderator with a bad name":          {Moderator: "Anon\x1b[2J", Action: "ban", Target: "Bob", Timestamp: 1},
+		"a target with a bad name":             {Moderator: "Anon", Action: "ban", Target: "Bob Smith", Timestamp: 1},
+	} {
+		if err := importAudit(c, entry); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("importing %v returned %v, want InvalidArgument", why, err)
+		}
+	}
+
+	// A good entry is kept, in the channel imported into, and the clock moves past it
+	srv, c := startServer(t, server.WithIdentity(testIdentity))
+	if err := importAudit(c, &pb.AuditEntry{Channel: "Elsewhere", Moderator: "Anon", Action: "ban", Target: "Bob", Reason: "spam\x07", Timestamp: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Lamport() <= 1000 {
+		t.Errorf("Lamport time after importing an entry at 1000 is %v", srv.Lamport())
+	}
+	audit, err := c.GetAuditLog(as("Anon"), &pb.Channel{Name: "New", SendersName: "Anon"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := audit.GetEntries(); len(entries) == 0 || entries[0].GetChannel() != "New" || entries[0].GetReason() != "spam" {
+		t.Errorf("audit log after the import is %v, want the ban in New, without the bell", entries)
+	}
+}
+
+func TestMutedUsersCannotReact(t *testing.T) {
+	_, c := startServer(t, server.WithIdentity(testIdentity))
+	anon := joined(t, c, "Eepy", "Anon")
+	joined(t, c, "Eepy", "Bob")
+	if err := send(c, message("Eepy", "Anon", "react to this")); err != nil {
+		t.Fatal(err)
+	}
+	id := receive(t, anon, "react to this").GetId()
+
+	if _, err := c.Mute(as("Anon"), &pb.ModerationRequest{Channel: &pb.Channel{Name: "Eepy", SendersName: "Anon"}, Target: "Bob"}); err != nil {
+		t.Fatal(err)
+	}
+	react := &pb.ReactionRequest{Channel: &pb.Channel{Name: "Eepy", SendersName: "Bob"}, Id: id, Emoji: "👍"}
+	if _, err := c.React(as("Bob"), react); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("muted Bob reacting returned %v, want PermissionDenied", err)
+	}
+}
+
+// Function to search as user, returning the texts found and the next page's token
+func searchFor(t *testing.T, c pb.ChatServiceClient, user string, req *pb.SearchRequest) ([]string, string) {
+	t.Helper()
+	if req.Channel == nil {
+		req.Channel = &pb.Channel{}
+	}
+	req.Channel.SendersName = user
+	results, err := c.Search(as(user), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, hit := range results.GetHits() {
+		texts = append(texts, hit.GetMessage().GetMessage())
+	}
+	return texts, results.GetNextPageToken()
+}
+
+func TestSearchPages(t *testing.T) {
+	_, c := startServer(t)
+	for i := 1; i <= 5; i++ {
+		if err := send(c, message("Eepy", "Anon", fmt.Sprintf("lunch %v", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Newest first, two at a time
+	var pages [][]string
+	req := &pb.SearchRequest{Query: "lunch", PageSize: 2, Context: 1}
+	for {
+		texts, next := searchFor(t, c, "Anon", req)
+		pages = append(pages, texts)
+		if next == "" {
+			break
+		}
+		req.PageToken = next
+	}
+	want := [][]string{{"lunch 5", "lunch 4"}, {"lunch 3", "lunch 2"}, {"lunch 1"}}
+	if fmt.Sprint(pages) != fmt.Sprint(want) {
+		t.Errorf("pages are %q, want %q", pages, want)
+	}
+
+	results, err := c.Search(as("Anon"), &pb.SearchRequest{Query: "lunch 3", Context: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits := results.GetHits(); len(hits) != 1 || len(hits[0].GetBefore()) != 1 || len(hits[0].GetAfter()) != 1 {
+		t.Errorf("searching for lunch 3 found %v, want it with one message on either side", hits)
+	}
+
+	if _, err := c.Search(as("Anon"), &pb.SearchRequest{Query: "lunch", PageToken: "soon"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("searching with a bad page token returned %v, want InvalidArgument", err)
+	}
+}
+
+func TestSearchLeavesOutBannedChannels(t *testing.T) {
+	_, c := startServer(t, server.WithIdentity(testIdentity))
+	joined(t, c, "Eepy", "Anon")
+	joined(t, c, "Dev", "Anon")
+	for _, channel := range []string{"Eepy", "Dev"} {
+		if err := send(c, message(channel, "Anon", "secret in "+channel)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.Ban(as("Anon"), &pb.ModerationRequest{Channel: &pb.Channel{Name: "Eepy", SendersName: "Anon"}, Target: "Mallory"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Search(as("Mallory"), &pb.SearchRequest{Query: "secret", Channel: &pb.Channel{Name: "Eepy", SendersName: "Molly"}}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Mallory searching Eepy returned %v, want PermissionDenied", err)
+	}
+	if texts, _ := searchFor(t, c, "Mallory", &pb.SearchRequest{Query: "secret"}); len(texts) != 1 || texts[0] != "secret in Dev" {
+		t.Errorf("Mallory searching every channel found %q, want only Dev's message", texts)
+	}
+	if texts, _ := searchFor(t, c, "Anon", &pb.SearchRequest{Query: "secret"}); len(texts) != 2 {
+		t.Errorf("Anon searching every channel found %q, want both messages", texts)
+	}
+}
+
+func TestInvalidMessagesAreRefused(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxLength = 10
+	cfg.ChannelMaxLength = server.ChannelLengths{"Long": 20}
+	_, c := startServer(t, server.WithConfig(cfg))
+	anon := joined(t, c, "Eepy", "Anon")
+
+	for why, msg := range map[string]*pb.Message{
+		"too long":      message("Eepy", "Anon", "far too long for ten"),
+		"empty":         message("Eepy", "Anon", "  "),
+		"a bad channel": message("Eepy Sleepy", "Anon", "hi"),
+		"a bad sender":  message("Eepy", "", "hi"),
+	} {
+		if err := send(c, msg); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("sending %v returned %v, want InvalidArgument", why, err)
+		}
+	}
+	if err := send(c, message("Long", "Anon", "long enough for 20")); err != nil {
+		t.Errorf("sending to a channel with its own limit returned %v", err)
+	}
+
+	// What gets through is cleaned up first
+	if err := send(c, message("Eepy", "Anon", "hi\x1b[2J")); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, anon, "hi[2J")
+}
+
+func TestThreads(t *testing.T) {
+	_, c := startServer(t, server.WithIdentity(testIdentity))
+	anon := joined(t, c, "Eepy", "Anon")
+	joined(t, c, "Dev", "Anon")
+
+	sendReply := func(channel, text, replyTo string) string {
+		t.Helper()
+		msg := message(channel, "Anon", text)
+		msg.ReplyTo = replyTo
+		if err := send(c, msg); err != nil {
+			t.Fatal(err)
+		}
+		return receive(t, anon, text).GetId()
+	}
+	root := sendReply("Eepy", "lunch?", "")
+	yes := sendReply("Eepy", "yes", root)
+	sendReply("Eepy", "unrelated", "")
+	where := sendReply("Eepy", "where?", yes)
+
+	// Any message in it gives the whole thread, the first message first
+	for _, id := range []string{root, yes, where} {
+		thread, err := c.GetThread(as("Anon"), &pb.MessageRef{Channel: &pb.Channel{Name: "Eepy", SendersName: "Anon"}, Id: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var texts []string
+		for _, msg := range thread.GetMessages() {
+			texts = append(texts, msg.GetMessage())
+		}
+		if strings.Join(texts, ",") != "lunch?,yes,where?" {
+			t.Errorf("thread of #%v is %q, want lunch?, yes, where?", id, texts)
+		}
+	}
+
+	// Replies must be to a message in the same channel
+	reply := message("Dev", "Anon", "over here")
+	reply.ReplyTo = root
+	if err := send(c, reply); status.Code(err) != codes.NotFound {
+		t.Errorf("replying across channels returned %v, want NotFound", err)
+	}
+	reply.Channel.Name, reply.ReplyTo = "Eepy", "9999"
+	if err := send(c, reply); status.Code(err) != codes.NotFound {
+		t.Errorf("replying to a message that isn't there returned %v, want NotFound", err)
+	}
+
+	// A deleted reply stays in the thread, without its text
+	if _, err := c.DeleteMessage(as("Anon"), &pb.EditRequest{Channel: &pb.Channel{Name: "Eepy", SendersName: "Anon"}, Id: yes}); err != nil {
+		t.Fatal(err)
+	}
+	thread, err := c.GetThread(as("Anon"), &pb.MessageRef{Channel: &pb.Channel{Name: "Eepy", SendersName: "Anon"}, Id: where})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs := thread.GetMessages(); len(msgs) != 3 || msgs[1].GetEvent() != pb.Event_DELETED || msgs[1].GetMessage() != "" || len(msgs[1].GetEdits()) != 0 {
+		t.Errorf("thread after deleting a reply is %v, want it emptied in place", msgs)
+	}
+}
+
+// Function to get what changed in channel since revision, as "text" or "-" for a deleted message, and the latest revision
+func changesSince(t *testing.T, c pb.ChatServiceClient, channel string, revision int64, limit int32) ([]string, int64) {
+	t.Helper()
+	history, err := c.GetHistory(as("Anon"), &pb.HistoryRequest{Channel: &pb.Channel{Name: channel, SendersName: "Anon"}, SinceRevision: revision, Limit: limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes []string
+	for _, msg := range history.GetMessages() {
+		if msg.GetEvent() == pb.Event_DELETED {
+			changes = append(changes, "-")
+		} else {
+			changes = append(changes, msg.GetMessage())
+		}
+	}
+	return changes, history.GetRevision()
+}
+
+func TestHistoryCatchUp(t *testing.T) {
+	_, c := startServer(t, server.WithIdentity(testIdentity))
+	anon := joined(t, c, "Eepy", "Anon")
+	ids := map[string]string{}
+	for _, text := range []string{"one", "two", "three"} {
+		if err := send(c, message("Eepy", "Anon", text)); err != nil {
+			t.Fatal(err)
+		}
+		ids[text] = receive(t, anon, text).GetId()
+	}
+
+	// A client that has nothing gets the last messages, up to the limit
+	got, seen := changesSince(t, c, "Eepy", 0, 0)
+	if strings.Join(got, ",") != "one,two,three" {
+		t.Fatalf("history is %q, want one, two, three", got)
+	}
+	if got, _ := changesSince(t, c, "Eepy", 0, 2); strings.Join(got, ",") != "two,three" {
+		t.Errorf("history limited to 2 is %q, want two, three", got)
+	}
+	if got, revision := changesSince(t, c, "Eepy", seen, 0); len(got) != 0 || revision != seen {
+		t.Errorf("nothing changed, but catching up gave %q at revision %v, want nothing at %v", got, revision, seen)
+	}
+
+	// While the client is away, one is edited, two deleted and four sent: catching up gets those, in the order they happened
+	channel := &pb.Channel{Name: "Eepy", SendersName: "Anon"}
+	if _, err := c.EditMessage(as("Anon"), &pb.EditRequest{Channel: channel, Id: ids["one"], Message: "one!"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.DeleteMessage(as("Anon"), &pb.EditRequest{Channel: channel, Id: ids["two"]}); err != nil {
+		t.Fatal(err)
+	}
+	if err := send(c, message("Eepy", "Anon", "four")); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, anon, "four")
+
+	got, latest := changesSince(t, c, "Eepy", seen, 0)
+	if strings.Join(got, ",") != "one!,-,four" || latest <= seen {
+		t.Errorf("catching up from %v gave %q at revision %v, want one!, -, four at a later revision", seen, got, latest)
+	}
+	if got, _ := changesSince(t, c, "Eepy", seen, 1); strings.Join(got, ",") != "four" {
+		t.Errorf("catching up limited to 1 gave %q, want the latest change", got)
+	}
+
+	// Someone new isn't told about the deleted message
+	if got, _ := changesSince(t, c, "Eepy", 0, 0); strings.Join(got, ",") != "one!,three,four" {
+		t.Errorf("history after the changes is %q, want one!, three, four", got)
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Longest user or channel name we accept
+const maxNameLength = 32
+
+// messageLimits holds the default maximum message length (in characters)
+// and any per-channel overrides.
+type messageLimits struct {
+	defaultMax int
+	channelMax ChannelLengths
+}
+
+// Function to get the maximum message length for a channel
+func (l *messageLimits) maxLength(channel string) int {
+	if max, ok := l.channelMax[channel]; ok {
+		return max
+	}
+	return l.defaultMax
+}
+
+// ChannelLengths maps a channel to its maximum message length, in characters.
+// String and Set let it be given as a flag, e.g. -channel-max-length Eepy=256,Dev=512
+type ChannelLengths map[string]int
+
+func (l ChannelLengths) String() string {
+	var parts []string
+	for name, max := range l {
+		parts = append(parts, fmt.Sprintf("%v=%v", name, max))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (l ChannelLengths) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		name, max, ok := strings.Cut(part, "=")
+		if !ok {
+			return fmt.Errorf("expected channel=length, got %q", part)
+		}
+		n, err := strconv.Atoi(max)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid length for channel %v: %q", name, max)
+		}
+		l[name] = n
+	}
+	return nil
+}
+
+// Function to check a name (user or channel) follows the naming rules:
+// 1 to 32 characters, only letters, digits, '-', '_' and '.'
+func validateName(kind, name string) error {
+	if name == "" {
+		return status.Errorf(codes.InvalidArgument, "%v name is empty", kind)
+	}
+	if utf8.RuneCountInString(name) > maxNameLength {
+		return status.Errorf(codes.InvalidArgument, "%v name %q is longer than %v characters", kind, name, maxNameLength)
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != '.' {
+			return status.Errorf(codes.InvalidArgument, "%v name %q may only contain letters, digits, '-', '_' and '.'", kind, name)
+		}
+	}
+	return nil
+}
+
+// Function to validate a channel join request
+func validateChannel(ch *pb.Channel) error {
+	if err := validateName("channel", ch.GetName()); err != nil {
+		return err
+	}
+	return validateName("user", ch.GetSendersName())
+}
+
+// Function to validate and clean up a message received from a client.
+// Control characters are stripped from the text before its length is checked.
+func (l *messageLimits) validateMessage(msg *pb.Message) error {
+	if msg.GetChannel() == nil {
+		return status.Error(codes.InvalidArgument, "message has no channel")
+	}
+	if err := validateName("channel", msg.GetChannel().GetName()); err != nil {
+		return err
+	}
+	if err := validateName("user", msg.GetSender()); err != nil {
+		return err
+	}
+	if !utf8.ValidString(msg.GetMessage()) {
+		return status.Error(codes.InvalidArgument, "message is not valid UTF-8")
+	}
+	if ttl := msg.GetTtlSeconds(); ttl < 0 || ttl > int64(maxTTL/time.Second) {
+		return status.Errorf(codes.InvalidArgument, "an ephemeral message may last at most %v", maxTTL)
+	}
+
+	// A message with files attached doesn't need any text
+	msg.Message = stripControl(msg.GetMessage())
+	if strings.TrimSpace(msg.GetMessage()) == "" && len(msg.GetAttachments()) == 0 {
+		return status.Error(codes.InvalidArgument, "message is empty")
+	}
+
+	// The join announcement is rewritten by the server, so its length doesn't count
+	if msg.GetMessage() == joinMessage {
+		return nil
+	}
+
+	max := l.maxLength(msg.GetChannel().GetName())
+	if length := utf8.RuneCountInString(msg.GetMessage()); length > max {
+		return status.Errorf(codes.InvalidArgument, "message is %v characters, channel %v allows at most %v", length, msg.GetChannel().GetName(), max)
+	}
+	return nil
+}
+
+// Function to remove control characters; tabs become spaces, and line breaks are kept for messages of more than one line
+func stripControl(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return ' '
+		}
+		if r == '\n' {
+			return r
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
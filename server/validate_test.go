@@ -0,0 +1,80 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateName(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		ok   bool
+	}{
+		{"Anon", true},
+		{"anon_2.0-beta", true},
+		{"Åse", true},
+		{strings.Repeat("a", 32), true},
+		{"", false},
+		{strings.Repeat("a", 33), false},
+		{"Anon Bob", false},
+		{"Anon\x1b[2J", false},
+		{"@Anon", false},
+	} {
+		if err := validateName("user", tt.name); (err == nil) != tt.ok {
+			t.Errorf("validateName(%q) = %v, want ok: %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestValidateMessage(t *testing.T) {
+	limits := &messageLimits{defaultMax: 10, channelMax: ChannelLengths{"Long": 20}}
+	for _, tt := range []struct {
+		why  string
+		msg  *pb.Message
+		want string // the text after it's cleaned up, if it's accepted
+		ok   bool
+	}{
+		{why: "a message", msg: &pb.Message{Sender: "Anon", Message: "hi", Channel: &pb.Channel{Name: "Eepy"}}, want: "hi", ok: true},
+		{why: "control characters", msg: &pb.Message{Sender: "Anon", Message: "hi\x1b[2J\x07", Channel: &pb.Channel{Name: "Eepy"}}, want: "hi[2J", ok: true},
+		{why: "tabs and line breaks", msg: &pb.Message{Sender: "Anon", Message: "a\tb\r\nc", Channel: &pb.Channel{Name: "Eepy"}}, want: "a b\nc", ok: true},
+		{why: "a channel's own limit", msg: &pb.Message{Sender: "Anon", Message: strings.Repeat("x", 20), Channel: &pb.Channel{Name: "Long"}}, want: strings.Repeat("x", 20), ok: true},
+		{why: "characters, not bytes", msg: &pb.Message{Sender: "Anon", Message: strings.Repeat("ø", 10), Channel: &pb.Channel{Name: "Eepy"}}, want: strings.Repeat("ø", 10), ok: true},
+		{why: "a file without text", msg: &pb.Message{Sender: "Anon", Channel: &pb.Channel{Name: "Eepy"}, Attachments: []*pb.Attachment{{Name: "a.png"}}}, ok: true},
+		{why: "too long", msg: &pb.Message{Sender: "Anon", Message: strings.Repeat("x", 11), Channel: &pb.Channel{Name: "Eepy"}}},
+		{why: "empty", msg: &pb.Message{Sender: "Anon", Message: " \x07 ", Channel: &pb.Channel{Name: "Eepy"}}},
+		{why: "not UTF-8", msg: &pb.Message{Sender: "Anon", Message: "\xff", Channel: &pb.Channel{Name: "Eepy"}}},
+		{why: "no channel", msg: &pb.Message{Sender: "Anon", Message: "hi"}},
+		{why: "a bad sender", msg: &pb.Message{Sender: "A n o n", Message: "hi", Channel: &pb.Channel{Name: "Eepy"}}},
+		{why: "too long a TTL", msg: &pb.Message{Sender: "Anon", Message: "hi", Channel: &pb.Channel{Name: "Eepy"}, TtlSeconds: 8 * 24 * 60 * 60}},
+	} {
+		err := limits.validateMessage(tt.msg)
+		if tt.ok {
+			if err != nil {
+				t.Errorf("%v: %v", tt.why, err)
+			} else if tt.msg.GetMessage() != tt.want {
+				t.Errorf("%v: text is %q, want %q", tt.why, tt.msg.GetMessage(), tt.want)
+			}
+		} else if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%v: %v, want InvalidArgument", tt.why, err)
+		}
+	}
+}
+
+func TestChannelLengths(t *testing.T) {
+	lengths := make(ChannelLengths)
+	if err := lengths.Set("Eepy=256,Dev=512"); err != nil {
+		t.Fatal(err)
+	}
+	if got := lengths.String(); got != "Dev=512,Eepy=256" {
+		t.Errorf("String() = %q", got)
+	}
+	for _, value := range []string{"Eepy", "Eepy=0", "Eepy=long"} {
+		if err := lengths.Set(value); err == nil {
+			t.Errorf("Set(%q) succeeded", value)
+		}
+	}
+}
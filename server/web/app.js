@@ -0,0 +1,200 @@
+// The web client: it talks to the server through the gateway, a WebSocket for the channel it's in
+// and plain requests for the channel list and the last messages.
+
+const $ = (id) => document.getElementById(id);
+
+let user = localStorage.getItem("chitty-user") || "";
+let channel = "";
+let socket = null;
+let channels = [];
+
+// Function to start chatting once there's a name
+$("login").addEventListener("submit", (event) => {
+	event.preventDefault();
+	user = $("username").value.trim();
+	localStorage.setItem("chitty-user", user);
+	$("login").hidden = true;
+	$("chat").hidden = false;
+	join($("first-channel").value.trim());
+	refreshChannels();
+	setInterval(refreshChannels, 3000);
+});
+$("username").value = user;
+
+$("join").addEventListener("submit", (event) => {
+	event.preventDefault();
+	const name = $("join-channel").value.trim();
+	$("join-channel").value = "";
+	if (name) {
+		join(name);
+	}
+});
+
+$("compose").addEventListener("submit", (event) => {
+	event.preventDefault();
+	const text = $("text").value;
+	if (text.trim() === "" || !socket || socket.readyState !== WebSocket.OPEN) {
+		return;
+	}
+	socket.send(JSON.stringify({ message: text }));
+	$("text").value = "";
+});
+
+// Function to leave the current channel and join another one
+async function join(name) {
+	if (socket) {
+		socket.onclose = null;
+		socket.close();
+	}
+	channel = name;
+	$("messages").replaceChildren();
+	setStatus(`Joining ${name}...`);
+	renderChannels();
+
+	// The last messages first, then everything new from the live stream
+	const history = await fetchJSON(`/api/channels/${encodeURIComponent(name)}/messages?user=${encodeURIComponent(user)}`);
+	if (channel !== name) {
+		return;
+	}
+	if (history) {
+		(history.messages || []).forEach(show);
+	}
+
+	const scheme = location.protocol === "https:" ? "wss:" : "ws:";
+	socket = new WebSocket(`${scheme}//${location.host}/api/channels/${encodeURIComponent(name)}/live?user=${encodeURIComponent(user)}`);
+	socket.onopen = () => setStatus(`${name} as ${user}`);
+	socket.onmessage = (event) => {
+		const data = JSON.parse(event.data);
+		if (data.error) {
+			notice(data.error, "error");
+			// Kicked or banned: joining again wouldn't help
+			if (data.code === "PermissionDenied") {
+				socket.onclose = () => setStatus(`Removed from ${name}`);
+			}
+		} else {
+			show(data);
+		}
+	};
+	socket.onclose = () => {
+		setStatus(`Disconnected from ${name}, trying again...`);
+		setTimeout(() => channel === name && join(name), 3000);
+	};
+}
+
+// Function to show a message, or update it when it's an edit, deletion or reaction to one already shown
+function show(msg) {
+	if (!msg.id) {
+		notice(`[Lamport ${msg.timestamp || 0}] ${msg.message}`, "notice");
+		refreshChannels();
+		return;
+	}
+	let item = document.querySelector(`#messages li[data-id="${CSS.escape(msg.id)}"]`);
+	// Ephemeral messages are hidden once they expire, also before the server has deleted them
+	const expiresAt = Number(msg.expiresAt || 0) * 1000;
+	if (expiresAt && expiresAt <= Date.now()) {
+		if (item) {
+			item.remove();
+		}
+		return;
+	}
+	if (!item) {
+		if (msg.event) {
+			return;
+		}
+		item = document.createElement("li");
+		item.dataset.id = msg.id;
+		$("messages").append(item);
+	}
+	item.replaceChildren(
+		span(`[Lamport ${msg.timestamp || 0}] `, "lamport"),
+		span(`#${msg.id} `, "lamport"),
+		span(msg.sender, "sender"),
+		document.createTextNode(": "),
+	);
+	if (msg.event === "DELETED") {
+		item.append(span("message deleted", "deleted"));
+	} else {
+		item.append(document.createTextNode(msg.message));
+		if ((msg.edits || []).length > 0) {
+			item.append(span(" (edited)", "edited"));
+		}
+	}
+	const reactions = (msg.reactions || []).map((r) => `${r.emoji} ${(r.users || []).length}`).join("  ");
+	if (reactions) {
+		item.append(span(`  ${reactions}`, "edited"));
+	}
+	if (expiresAt) {
+		item.append(span(`  disappears at ${new Date(expiresAt).toLocaleTimeString()}`, "edited"));
+		clearTimeout(item.expiry);
+		item.expiry = setTimeout(() => item.remove(), expiresAt - Date.now());
+	}
+	scrollDown();
+}
+
+function notice(text, kind) {
+	const item = document.createElement("li");
+	item.append(span(text, kind));
+	$("messages").append(item);
+	scrollDown();
+}
+
+function span(text, kind) {
+	const element = document.createElement("span");
+	element.className = kind;
+	element.textContent = text;
+	return element;
+}
+
+function scrollDown() {
+	const list = $("messages");
+	list.scrollTop = list.scrollHeight;
+}
+
+function setStatus(text) {
+	$("status").textContent = text;
+}
+
+// Function to get the channels and who's in them, for the sidebar and the member list
+async function refreshChannels() {
+	const list = await fetchJSON("/api/channels");
+	if (list) {
+		channels = list.channels || [];
+		renderChannels();
+	}
+}
+
+function renderChannels() {
+	const names = channels.map((c) => c.name);
+	if (channel && !names.includes(channel)) {
+		names.push(channel);
+		names.sort();
+	}
+	$("channel-list").replaceChildren(...names.map((name) => {
+		const item = document.createElement("li");
+		const info = channels.find((c) => c.name === name);
+		item.textContent = `${name} (${info ? (info.members || []).length : 0})`;
+		item.className = name === channel ? "current" : "";
+		item.onclick = () => name !== channel && join(name);
+		return item;
+	}));
+
+	const current = channels.find((c) => c.name === channel);
+	$("member-list").replaceChildren(...((current && current.members) || []).map((name) => {
+		const item = document.createElement("li");
+		item.textContent = name === user ? `${name} (you)` : name;
+		return item;
+	}));
+}
+
+async function fetchJSON(url) {
+	try {
+		const response = await fetch(url);
+		if (!response.ok) {
+			notice(await response.text(), "error");
+			return null;
+		}
+		return await response.json();
+	} catch (err) {
+		return null;
+	}
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	pb "ChittyChat/proto"
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Webhooks connects channels to other programs over HTTP
+type Webhooks struct {
+	Incoming []IncomingWebhook `json:"incoming"`
+	Outgoing []OutgoingWebhook `json:"outgoing"`
+}
+
+// IncomingWebhook lets a program that knows Token post messages to Channel as Name,
+// by POSTing a JSON message like {"message": "Build passed"} to /webhooks/<token>
+type IncomingWebhook struct {
+	Name    string `json:"name"`
+	Channel string `json:"channel"`
+	Token   string `json:"token"`
+}
+
+// OutgoingWebhook POSTs the new messages in Channel whose text matches Match to URL, as JSON.
+// An empty Channel is every channel, an empty Match every message. URL has to be on this machine.
+type OutgoingWebhook struct {
+	Channel string `json:"channel"`
+	Match   string `json:"match"`
+	URL     string `json:"url"`
+}
+
+// Path incoming webhooks are posted to, followed by their token
+const webhookPath = "/webhooks/"
+
+// Largest body accepted by an incoming webhook
+const maxWebhookBody = 64 * 1024
+
+// How long an outgoing webhook's URL has to answer
+const webhookTimeout = 5 * time.Second
+
+// webhooks posts messages to the outgoing webhooks and takes them in from the incoming ones
+type webhooks struct {
+	incoming []IncomingWebhook
+	outgoing []outgoingWebhook
+	client   *http.Client
+}
+
+type outgoingWebhook struct {
+	channel string
+	match   *regexp.Regexp
+	url     string
+}
+
+func newWebhooks(cfg Webhooks) (*webhooks, error) {
+	w := &webhooks{client: &http.Client{Timeout: webhookTimeout}}
+	for _, hook := range cfg.Incoming {
+		if err := validateName("webhook", hook.Name); err != nil {
+			return nil, err
+		}
+		if err := validateName("channel", hook.Channel); err != nil {
+			return nil, err
+		}
+		if len(hook.Token) < 16 {
+			return nil, fmt.Errorf("token of webhook %v is shorter than 16 characters", hook.Name)
+		}
+		w.incoming = append(w.incoming, hook)
+	}
+	for _, hook := range cfg.Outgoing {
+		if err := checkLocalURL(hook.URL); err != nil {
+			return nil, err
+		}
+		match, err := regexp.Compile(hook.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match for webhook %v: %w", hook.URL, err)
+		}
+		w.outgoing = append(w.outgoing, outgoingWebhook{channel: hook.Channel, match: match, url: hook.URL})
+	}
+	return w, nil
+}
+
+// Function to check an outgoing webhook's URL points at this machine, so chat messages can't be sent just anywhere
+func checkLocalURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("webhook URL %q isn't http or https", raw)
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("webhook URL %q isn't on this machine", raw)
+	}
+	return nil
+}
+
+// Function to post a new message to the outgoing webhooks it matches
+func (w *webhooks) post(msg *pb.Message) {
+	if msg.GetId() == "" || msg.GetEvent() != pb.Event_MESSAGE {
+		return
+	}
+	var body []byte
+	for _, hook := range w.outgoing {
+		if hook.channel != "" && hook.channel != msg.GetChannel().GetName() {
+			continue
+		}
+		if !hook.match.MatchString(msg.GetMessage()) {
+			continue
+		}
+		if body == nil {
+			var err error
+			if body, err = protojson.Marshal(msg); err != nil {
+				log.Printf("Cannot encode message #%v for webhooks: %v\n", msg.GetId(), err)
+				return
+			}
+		}
+		go w.send(hook.url, body)
+	}
+}
+
+func (w *webhooks) send(url string, body []byte) {
+	resp, err := w.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Webhook %v failed: %v\n", url, err)
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Webhook %v answered %v\n", url, resp.Status)
+	}
+}
+
+// Function to find the incoming webhook a token belongs to
+func (w *webhooks) find(token string) (IncomingWebhook, bool) {
+	for _, hook := range w.incoming {
+		if subtle.ConstantTimeCompare([]byte(hook.Token), []byte(token)) == 1 {
+			return hook, true
+		}
+	}
+	return IncomingWebhook{}, false
+}
+
+// Function to handle a message POSTed to an incoming webhook. It's checked like a client's message,
+// stamped with the server's Lamport time and sent to the channel; the answer is the message as sent.
+func (s *chatServiceServer) serveWebhook(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		http.Error(rw, "webhooks take POST", http.StatusMethodNotAllowed)
+		return
+	}
+	hook, ok := s.webhooks.find(strings.TrimPrefix(req.URL.Path, webhookPath))
+	if !ok {
+		http.Error(rw, "unknown webhook", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(rw, req.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	var in pb.Message
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, &in); err != nil {
+		http.Error(rw, "invalid message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Only the text and what it replies to come from the caller; the rest is the webhook's
+	msg := &pb.Message{
+		Sender:  hook.Name,
+		Channel: &pb.Channel{Name: hook.Channel, SendersName: hook.Name},
+		Message: in.GetMessage(),
+		ReplyTo: in.GetReplyTo(),
+	}
+	if err := s.accept(msg); err != nil {
+		http.Error(rw, status.Convert(err).Message(), httpStatus(err))
+		return
+	}
+	s.publish(msg)
+
+	out, err := protojson.Marshal(msg)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(out)
+}
+
+// Function to turn the gRPC status of a refused message into an HTTP one
+func httpStatus(err error) int {
+	switch status.Code(err) {
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.Unimplemented:
+		return http.StatusMethodNotAllowed
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,115 @@
+package server_test
+
+import (
+	pb "ChittyChat/proto"
+	"ChittyChat/server"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const webhookToken = "0123456789abcdef"
+
+func TestIncomingWebhook(t *testing.T) {
+	hooks := server.Webhooks{Incoming: []server.IncomingWebhook{{Name: "CI", Channel: "Eepy", Token: webhookToken}}}
+	srv, c := startServer(t, server.WithWebhooks(hooks))
+	web := httptest.NewServer(srv.HTTPHandler())
+	t.Cleanup(web.Close)
+	anon := joined(t, c, "Eepy", "Anon")
+
+	// Only the text comes from the caller: it's sent as the webhook, to its channel
+	code, body := gatewayCall(t, http.MethodPost, web.URL+"/webhooks/"+webhookToken, "", `{"sender": "Anon", "channel": {"name": "Dev"}, "message": "Build passed"}`)
+	if code != http.StatusOK {
+		t.Fatalf("posting to the webhook returned %v: %v", code, body)
+	}
+	sent := &pb.Message{}
+	if err := protojson.Unmarshal([]byte(body), sent); err != nil || sent.GetSender() != "CI" || sent.GetTimestamp() == 0 {
+		t.Errorf("webhook answered %v, %v, want the message from CI with a Lamport time", body, err)
+	}
+	if got := receive(t, anon, "Build passed"); got.GetSender() != "CI" || got.GetChannel().GetName() != "Eepy" {
+		t.Errorf("channel received %v, want it from CI in Eepy", got)
+	}
+
+	for _, tt := range []struct {
+		why    string
+		method string
+		token  string
+		body   string
+		code   int
+	}{
+		{why: "wrong token", method: http.MethodPost, token: "fedcba9876543210", body: `{"message": "hi"}`, code: http.StatusNotFound},
+		{why: "no token", method: http.MethodPost, token: "", body: `{"message": "hi"}`, code: http.StatusNotFound},
+		{why: "GET", method: http.MethodGet, token: webhookToken, code: http.StatusMethodNotAllowed},
+		{why: "not JSON", method: http.MethodPost, token: webhookToken, body: "hi", code: http.StatusBadRequest},
+		{why: "empty message", method: http.MethodPost, token: webhookToken, body: `{"message": ""}`, code: http.StatusBadRequest},
+		{why: "too big", method: http.MethodPost, token: webhookToken, body: `{"message": "` + strings.Repeat("x", 100000) + `"}`, code: http.StatusRequestEntityTooLarge},
+	} {
+		if code, body := gatewayCall(t, tt.method, web.URL+"/webhooks/"+tt.token, "", tt.body); code != tt.code {
+			t.Errorf("%v: webhook returned %v (%v), want %v", tt.why, code, strings.TrimSpace(body), tt.code)
+		}
+	}
+}
+
+func TestOutgoingWebhook(t *testing.T) {
+	posted := make(chan string, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		data, _ := io.ReadAll(req.Body)
+		msg := &pb.Message{}
+		if err := protojson.Unmarshal(data, msg); err != nil {
+			t.Errorf("webhook posted %q: %v", data, err)
+		}
+		posted <- msg.GetMessage()
+	}))
+	t.Cleanup(receiver.Close)
+
+	hooks := server.Webhooks{Outgoing: []server.OutgoingWebhook{{Channel: "Eepy", Match: "^deploy", URL: receiver.URL}}}
+	_, c := startServer(t, server.WithWebhooks(hooks))
+	anon := joined(t, c, "Eepy", "Anon")
+	joined(t, c, "Dev", "Anon")
+	for _, msg := range []*pb.Message{
+		message("Eepy", "Anon", "hello"),
+		message("Dev", "Anon", "deploy from Dev"),
+		message("Eepy", "Anon", "deploy now"),
+	} {
+		if err := send(c, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	receive(t, anon, "deploy now")
+
+	select {
+	case got := <-posted:
+		if got != "deploy now" {
+			t.Errorf("webhook got %q, want only deploy now", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook got nothing")
+	}
+	select {
+	case got := <-posted:
+		t.Errorf("webhook also got %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhooksAreChecked(t *testing.T) {
+	for _, tt := range []struct {
+		why   string
+		hooks server.Webhooks
+	}{
+		{why: "short token", hooks: server.Webhooks{Incoming: []server.IncomingWebhook{{Name: "CI", Channel: "Eepy", Token: "secret"}}}},
+		{why: "invalid channel", hooks: server.Webhooks{Incoming: []server.IncomingWebhook{{Name: "CI", Channel: "#Eepy", Token: webhookToken}}}},
+		{why: "URL elsewhere", hooks: server.Webhooks{Outgoing: []server.OutgoingWebhook{{URL: "http://example.com/hook"}}}},
+		{why: "not HTTP", hooks: server.Webhooks{Outgoing: []server.OutgoingWebhook{{URL: "file:///etc/passwd"}}}},
+		{why: "invalid match", hooks: server.Webhooks{Outgoing: []server.OutgoingWebhook{{Match: "(", URL: "http://localhost/hook"}}}},
+	} {
+		if _, err := server.New(server.WithWebhooks(tt.hooks)); err == nil {
+			t.Errorf("%v: New accepted the webhooks", tt.why)
+		}
+	}
+}
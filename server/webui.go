@@ -0,0 +1,21 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// The web client's files, built into the server so there's nothing to install
+//
+//go:embed web
+var webFiles embed.FS
+
+// Function to serve the web client; it talks to the server through the gateway
+func webUI() http.Handler {
+	files, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServer(http.FS(files))
+}
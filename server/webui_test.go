@@ -0,0 +1,77 @@
+package server_test
+
+import (
+	pb "ChittyChat/proto"
+	"ChittyChat/server"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestWebUI(t *testing.T) {
+	srv, c := startServer(t, server.WithWebUI())
+	web := httptest.NewServer(srv.HTTPHandler())
+	t.Cleanup(web.Close)
+
+	for _, tt := range []struct {
+		path        string
+		contentType string
+		has         string
+	}{
+		{path: "/", contentType: "text/html", has: `<script src="app.js">`},
+		{path: "/app.js", contentType: "javascript", has: "api/channels"},
+		{path: "/style.css", contentType: "text/css", has: "{"},
+	} {
+		res, err := http.Get(web.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil || res.StatusCode != http.StatusOK {
+			t.Errorf("GET %v returned %v, %v", tt.path, res.Status, err)
+			continue
+		}
+		if got := res.Header.Get("Content-Type"); !strings.Contains(got, tt.contentType) {
+			t.Errorf("GET %v is %v, want %v", tt.path, got, tt.contentType)
+		}
+		if !strings.Contains(string(body), tt.has) {
+			t.Errorf("GET %v doesn't have %q", tt.path, tt.has)
+		}
+	}
+
+	// The page talks to the server through the gateway, which comes with it
+	joined(t, c, "Eepy", "Anon")
+	code, body := gatewayCall(t, http.MethodGet, web.URL+"/api/channels", "", "")
+	list := &pb.ChannelList{}
+	if err := protojson.Unmarshal([]byte(body), list); code != http.StatusOK || err != nil {
+		t.Fatalf("GET /api/channels returned %v, %v: %v", code, err, body)
+	}
+	if channels := list.GetChannels(); len(channels) != 1 || channels[0].GetName() != "Eepy" {
+		t.Errorf("channels are %v, want Eepy", channels)
+	}
+
+	// And joins over a WebSocket opened from the page
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(web.URL, "http")+"/api/channels/Eepy/live?user=Bob", "", web.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	listed(t, c, "Eepy", "Bob")
+}
+
+func TestNoWebUIUnlessAsked(t *testing.T) {
+	srv, _ := startServer(t)
+	web := httptest.NewServer(srv.HTTPHandler())
+	t.Cleanup(web.Close)
+	for _, path := range []string{"/", "/app.js", "/api/channels"} {
+		if code, _ := gatewayCall(t, http.MethodGet, web.URL+path, "", ""); code != http.StatusNotFound {
+			t.Errorf("GET %v without the web client returned %v, want 404", path, code)
+		}
+	}
+}
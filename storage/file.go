@@ -0,0 +1,523 @@
+package storage
+
+import (
+	pb "ChittyChat/proto"
+	"bufio"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// A file is written again without its old lines once they take up more than half of it,
+// and there are more than this many of them
+const compactSlack = 64
+
+// Longest line read back; messages with long edit histories make long lines
+const maxLine = 16 * 1024 * 1024
+
+// fileStore is a Store that keeps everything in a folder, as JSON Lines like the client's message store:
+// a file per channel with its messages, <channel>.jsonl, and channels.log, users.log and sessions.log.
+// A changed record is written again, and the last line with its key wins, so saving only ever appends.
+// The messages are read back from disk when they're asked for; everything else is kept in memory as well.
+type fileStore struct {
+	mu       sync.Mutex
+	dir      string
+	messages map[string]*messageFile
+	channels *table[*pb.ChannelRecord]
+	users    *table[*pb.UserRecord]
+	sessions *table[*pb.SessionRecord]
+}
+
+// OpenFile returns a Store that keeps everything in dir, making it if needed,
+// with what was kept there before
+func OpenFile(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &fileStore{dir: dir, messages: make(map[string]*messageFile)}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		channel, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(path), ".jsonl"))
+		if err != nil {
+			continue
+		}
+		f := &messageFile{path: path}
+		messages, err := f.read()
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		if err := f.rewriteIfStale(messages); err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.messages[channel] = f
+	}
+
+	if s.channels, err = openTable(filepath.Join(dir, "channels.log"),
+		func() *pb.ChannelRecord { return &pb.ChannelRecord{} },
+		(*pb.ChannelRecord).GetName, nil); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if s.users, err = openTable(filepath.Join(dir, "users.log"),
+		func() *pb.UserRecord { return &pb.UserRecord{} },
+		(*pb.UserRecord).GetName, nil); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if s.sessions, err = openTable(filepath.Join(dir, "sessions.log"),
+		func() *pb.SessionRecord { return &pb.SessionRecord{} },
+		(*pb.SessionRecord).GetId,
+		func(id string) *pb.SessionRecord { return &pb.SessionRecord{Id: id} }); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Function to get the file of a channel's messages, which needn't exist yet; s.mu must be held
+func (s *fileStore) messageFile(channel string) *messageFile {
+	f := s.messages[channel]
+	if f == nil {
+		f = &messageFile{path: filepath.Join(s.dir, url.PathEscape(channel)+".jsonl"), ids: make(map[string]bool)}
+		s.messages[channel] = f
+	}
+	return f
+}
+
+func (s *fileStore) SaveMessage(msg *pb.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messageFile(msg.GetChannel().GetName()).save(msg)
+}
+
+func (s *fileStore) Messages(channel string) ([]*pb.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.messages[channel]
+	if !ok {
+		return nil, nil
+	}
+	return f.read()
+}
+
+func (s *fileStore) DeleteMessages(channel string, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.messages[channel]
+	if !ok {
+		return nil
+	}
+	messages, err := f.read()
+	if err != nil {
+		return err
+	}
+	messages = without(messages, ids)
+	if len(messages) == 0 {
+		delete(s.messages, channel)
+		return f.remove()
+	}
+	return f.rewrite(messages)
+}
+
+func (s *fileStore) Compact(channel string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.messages[channel]
+	if !ok {
+		return nil
+	}
+	messages, err := f.read()
+	if err != nil {
+		return err
+	}
+	return f.rewrite(messages)
+}
+
+func (s *fileStore) SaveChannel(ch *pb.ChannelRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.channels.save(ch)
+}
+
+func (s *fileStore) Channel(name string) (*pb.ChannelRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.channels.get(name)
+}
+
+func (s *fileStore) Channels() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := s.channels.keys()
+	for name := range s.messages {
+		if _, ok := s.channels.records[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *fileStore) SaveUser(user *pb.UserRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.users.save(user)
+}
+
+func (s *fileStore) User(name string) (*pb.UserRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.users.get(name)
+}
+
+func (s *fileStore) Users() ([]*pb.UserRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.users.all(), nil
+}
+
+func (s *fileStore) SaveSession(session *pb.SessionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions.save(session)
+}
+
+func (s *fileStore) DeleteSession(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions.remove(id)
+}
+
+func (s *fileStore) Sessions() ([]*pb.SessionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions.all(), nil
+}
+
+func (s *fileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for _, f := range s.messages {
+		err = firstError(err, f.close())
+	}
+	err = firstError(err, s.channels.close())
+	err = firstError(err, s.users.close())
+	err = firstError(err, s.sessions.close())
+	return err
+}
+
+func firstError(err, next error) error {
+	if err != nil {
+		return err
+	}
+	return next
+}
+
+// messageFile is the file of a channel's messages. Only how many lines and messages it has is kept in memory,
+// to know when to write it again.
+type messageFile struct {
+	path  string
+	file  *os.File // opened for appending on the first save
+	lines int
+	ids   map[string]bool
+}
+
+// Function to read the messages, latest versions, in the order they were first written
+func (f *messageFile) read() ([]*pb.Message, error) {
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var messages []*pb.Message
+	at := make(map[string]int)
+	f.lines = 0
+	err = readLines(file, func(line []byte) {
+		f.lines++
+		msg := &pb.Message{}
+		// A line cut short by a crash is skipped, like one from a newer server
+		if err := protojson.Unmarshal(line, msg); err != nil || msg.GetId() == "" {
+			return
+		}
+		if i, ok := at[msg.GetId()]; ok {
+			messages[i] = msg
+		} else {
+			at[msg.GetId()] = len(messages)
+			messages = append(messages, msg)
+		}
+	})
+	f.ids = make(map[string]bool)
+	for id := range at {
+		f.ids[id] = true
+	}
+	return messages, err
+}
+
+func (f *messageFile) save(msg *pb.Message) error {
+	if f.file == nil {
+		file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		f.file = file
+	}
+	if err := writeLine(f.file, msg); err != nil {
+		return err
+	}
+	f.lines++
+	f.ids[msg.GetId()] = true
+	if f.lines > 2*len(f.ids)+compactSlack {
+		messages, err := f.read()
+		if err != nil {
+			return err
+		}
+		return f.rewrite(messages)
+	}
+	return nil
+}
+
+// Function to write the file again with only messages, if old lines take up most of it
+func (f *messageFile) rewriteIfStale(messages []*pb.Message) error {
+	if f.lines > 2*len(messages)+compactSlack {
+		return f.rewrite(messages)
+	}
+	return nil
+}
+
+func (f *messageFile) rewrite(messages []*pb.Message) error {
+	if err := f.close(); err != nil {
+		return err
+	}
+	records := make([]proto.Message, len(messages))
+	f.ids = make(map[string]bool)
+	for i, msg := range messages {
+		records[i] = msg
+		f.ids[msg.GetId()] = true
+	}
+	f.lines = len(messages)
+	return rewriteFile(f.path, records)
+}
+
+func (f *messageFile) remove() error {
+	if err := f.close(); err != nil {
+		return err
+	}
+	if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *messageFile) close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// table is a file of records of one kind, kept in memory as well. For tables records can be removed from,
+// blank makes a record with nothing but its key, which written after a record removes it.
+type table[T proto.Message] struct {
+	path    string
+	file    *os.File
+	lines   int
+	records map[string]T
+	key     func(T) string
+	blank   func(key string) T
+}
+
+func openTable[T proto.Message](path string, newRecord func() T, key func(T) string, blank func(string) T) (*table[T], error) {
+	t := &table[T]{path: path, records: make(map[string]T), key: key, blank: blank}
+	if file, err := os.Open(path); err == nil {
+		err = readLines(file, func(line []byte) {
+			t.lines++
+			record := newRecord()
+			if err := protojson.Unmarshal(line, record); err != nil || key(record) == "" {
+				return
+			}
+			if blank != nil && proto.Equal(record, blank(key(record))) {
+				delete(t.records, key(record))
+			} else {
+				t.records[key(record)] = record
+			}
+		})
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if t.lines > 2*len(t.records)+compactSlack {
+		if err := t.rewrite(); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	t.file = file
+	return t, nil
+}
+
+func (t *table[T]) save(record T) error {
+	if err := t.write(record); err != nil {
+		return err
+	}
+	t.records[t.key(record)] = proto.Clone(record).(T)
+	return t.compact()
+}
+
+func (t *table[T]) remove(key string) error {
+	if _, ok := t.records[key]; !ok {
+		return nil
+	}
+	if err := t.write(t.blank(key)); err != nil {
+		return err
+	}
+	delete(t.records, key)
+	return t.compact()
+}
+
+func (t *table[T]) write(record T) error {
+	if err := writeLine(t.file, record); err != nil {
+		return err
+	}
+	t.lines++
+	return nil
+}
+
+// Function to write the file again once old lines take up most of it
+func (t *table[T]) compact() error {
+	if t.lines <= 2*len(t.records)+compactSlack {
+		return nil
+	}
+	if err := t.file.Close(); err != nil {
+		return err
+	}
+	if err := t.rewrite(); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(t.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	t.file = file
+	return err
+}
+
+func (t *table[T]) rewrite() error {
+	var records []proto.Message
+	for _, key := range t.keys() {
+		records = append(records, t.records[key])
+	}
+	t.lines = len(records)
+	return rewriteFile(t.path, records)
+}
+
+func (t *table[T]) get(key string) (T, error) {
+	record, ok := t.records[key]
+	if !ok {
+		var none T
+		return none, ErrNotFound
+	}
+	return proto.Clone(record).(T), nil
+}
+
+// Function to get the keys of the records, sorted
+func (t *table[T]) keys() []string {
+	var keys []string
+	for key := range t.records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Function to get copies of the records, sorted by key
+func (t *table[T]) all() []T {
+	var records []T
+	for _, key := range t.keys() {
+		records = append(records, proto.Clone(t.records[key]).(T))
+	}
+	return records
+}
+
+func (t *table[T]) close() error {
+	if t == nil || t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
+
+// Function to call fn with every line of file
+func readLines(file *os.File, fn func(line []byte)) error {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLine)
+	for scanner.Scan() {
+		fn(scanner.Bytes())
+	}
+	return scanner.Err()
+}
+
+func writeLine(file *os.File, record proto.Message) error {
+	line, err := protojson.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// Function to write records to path, replacing what's there, through a temporary file so a crash doesn't lose it
+func rewriteFile(path string, records []proto.Message) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// A record that can't be written leaves the file as it was, instead of dropping the record
+	fail := func(err error) error {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, record := range records {
+		line, err := protojson.Marshal(record)
+		if err != nil {
+			return fail(err)
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return fail(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,28 @@
+package storage_test
+
+import (
+	"ChittyChat/storage"
+	"ChittyChat/storage/storagetest"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	// The folder each Store was opened on, to open it again there
+	dirs := make(map[storage.Store]string)
+
+	open := func(t *testing.T, dir string) storage.Store {
+		s, err := storage.OpenFile(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dirs[s] = dir
+		return s
+	}
+	reopen := func(t *testing.T, s storage.Store) storage.Store {
+		if err := s.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		return open(t, dirs[s])
+	}
+	storagetest.Run(t, func(t *testing.T) storage.Store { return open(t, t.TempDir()) }, reopen)
+}
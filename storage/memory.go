@@ -0,0 +1,183 @@
+package storage
+
+import (
+	pb "ChittyChat/proto"
+	"sort"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// memory is a Store that keeps everything in memory
+type memory struct {
+	mu       sync.Mutex
+	messages map[string][]*pb.Message  // by channel, in the order they were first saved
+	at       map[string]map[string]int // where each message is in its channel's messages, by id
+	channels map[string]*pb.ChannelRecord
+	users    map[string]*pb.UserRecord
+	sessions map[string]*pb.SessionRecord
+}
+
+// NewMemory returns a Store that keeps everything in memory, as the server always did:
+// it's all gone when the server stops
+func NewMemory() Store {
+	return &memory{
+		messages: make(map[string][]*pb.Message),
+		at:       make(map[string]map[string]int),
+		channels: make(map[string]*pb.ChannelRecord),
+		users:    make(map[string]*pb.UserRecord),
+		sessions: make(map[string]*pb.SessionRecord),
+	}
+}
+
+func (m *memory) SaveMessage(msg *pb.Message) error {
+	stored := proto.Clone(msg).(*pb.Message)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	channel := stored.GetChannel().GetName()
+	if i, ok := m.at[channel][stored.GetId()]; ok {
+		m.messages[channel][i] = stored
+		return nil
+	}
+	if m.at[channel] == nil {
+		m.at[channel] = make(map[string]int)
+	}
+	m.at[channel][stored.GetId()] = len(m.messages[channel])
+	m.messages[channel] = append(m.messages[channel], stored)
+	return nil
+}
+
+func (m *memory) Messages(channel string) ([]*pb.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var messages []*pb.Message
+	for _, msg := range m.messages[channel] {
+		messages = append(messages, proto.Clone(msg).(*pb.Message))
+	}
+	return messages, nil
+}
+
+func (m *memory) DeleteMessages(channel string, ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages[channel] = without(m.messages[channel], ids)
+	m.at[channel] = make(map[string]int)
+	for i, msg := range m.messages[channel] {
+		m.at[channel][msg.GetId()] = i
+	}
+	if len(m.messages[channel]) == 0 {
+		delete(m.messages, channel)
+		delete(m.at, channel)
+	}
+	return nil
+}
+
+// Function to get messages without the ones with the given ids
+func without(messages []*pb.Message, ids []string) []*pb.Message {
+	remove := make(map[string]bool)
+	for _, id := range ids {
+		remove[id] = true
+	}
+	var kept []*pb.Message
+	for _, msg := range messages {
+		if !remove[msg.GetId()] {
+			kept = append(kept, msg)
+		}
+	}
+	return kept
+}
+
+// Replaced versions aren't kept in memory, so there's nothing to drop
+func (m *memory) Compact(channel string) error {
+	return nil
+}
+
+func (m *memory) SaveChannel(ch *pb.ChannelRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.channels[ch.GetName()] = proto.Clone(ch).(*pb.ChannelRecord)
+	return nil
+}
+
+func (m *memory) Channel(name string) (*pb.ChannelRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ch, ok := m.channels[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return proto.Clone(ch).(*pb.ChannelRecord), nil
+}
+
+func (m *memory) Channels() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name := range m.channels {
+		names = append(names, name)
+	}
+	for name := range m.messages {
+		if _, ok := m.channels[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *memory) SaveUser(user *pb.UserRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.users[user.GetName()] = proto.Clone(user).(*pb.UserRecord)
+	return nil
+}
+
+func (m *memory) User(name string) (*pb.UserRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return proto.Clone(user).(*pb.UserRecord), nil
+}
+
+func (m *memory) Users() ([]*pb.UserRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var users []*pb.UserRecord
+	for _, user := range m.users {
+		users = append(users, proto.Clone(user).(*pb.UserRecord))
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].GetName() < users[j].GetName() })
+	return users, nil
+}
+
+func (m *memory) SaveSession(session *pb.SessionRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[session.GetId()] = proto.Clone(session).(*pb.SessionRecord)
+	return nil
+}
+
+func (m *memory) DeleteSession(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *memory) Sessions() ([]*pb.SessionRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sessions []*pb.SessionRecord
+	for _, session := range m.sessions {
+		sessions = append(sessions, proto.Clone(session).(*pb.SessionRecord))
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].GetId() < sessions[j].GetId() })
+	return sessions, nil
+}
+
+func (m *memory) Close() error {
+	return nil
+}
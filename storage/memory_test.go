@@ -0,0 +1,11 @@
+package storage_test
+
+import (
+	"ChittyChat/storage"
+	"ChittyChat/storage/storagetest"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store { return storage.NewMemory() }, nil)
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	pb "ChittyChat/proto"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRewriteKeepsFileOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.jsonl")
+	if err := rewriteFile(path, []proto.Message{&pb.UserRecord{Name: "Anon"}}); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// protojson refuses strings that aren't UTF-8
+	broken := []proto.Message{&pb.UserRecord{Name: "Bob"}, &pb.UserRecord{Name: "\xff"}}
+	if err := rewriteFile(path, broken); err == nil {
+		t.Fatal("rewriting with a record that can't be written succeeded")
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("file after the failed rewrite is %q, want %q as before", after, before)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("the temporary file is left behind: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+// Package storage is where a ChittyChat server keeps what should outlive it: the messages of every channel,
+// the channels' roles, bans, mutes and audit logs, the users it has seen and who's connected.
+//
+// The server keeps everything it needs in memory as well, and only writes to its Store as things change,
+// reading it back when it starts. A Store has to keep copies: what's passed in may change after it's saved,
+// and what's handed out may be changed by the caller.
+//
+// NewMemory keeps everything in memory, so it's gone when the server stops; OpenFile keeps it in a folder.
+// Other backends can be plugged in with server.WithStore, and should pass storagetest.Run.
+package storage
+
+import (
+	pb "ChittyChat/proto"
+	"errors"
+)
+
+// ErrNotFound is returned for a channel or user the Store doesn't have
+var ErrNotFound = errors.New("storage: not found")
+
+// Store keeps messages, channels, users and sessions. It's used from many goroutines at once.
+type Store interface {
+	// SaveMessage adds a message to its channel, or replaces the message with its id
+	SaveMessage(msg *pb.Message) error
+	// Messages returns the messages of a channel, latest versions, in the order they were first saved
+	Messages(channel string) ([]*pb.Message, error)
+	// DeleteMessages removes messages from a channel for good; ids it doesn't have are skipped
+	DeleteMessages(channel string, ids []string) error
+	// Compact drops what the Store still keeps of the versions of a channel's messages that have been replaced,
+	// e.g. the text of a message that has expired
+	Compact(channel string) error
+
+	// SaveChannel adds a channel, or replaces the one with its name
+	SaveChannel(ch *pb.ChannelRecord) error
+	// Channel returns a channel saved with SaveChannel, or ErrNotFound
+	Channel(name string) (*pb.ChannelRecord, error)
+	// Channels returns the names of the channels with messages or saved with SaveChannel, sorted
+	Channels() ([]string, error)
+
+	// SaveUser adds a user, or replaces the one with their name
+	SaveUser(user *pb.UserRecord) error
+	// User returns a user, or ErrNotFound
+	User(name string) (*pb.UserRecord, error)
+	// Users returns every user, sorted by name
+	Users() ([]*pb.UserRecord, error)
+
+	// SaveSession adds a session, or replaces the one with its id
+	SaveSession(session *pb.SessionRecord) error
+	// DeleteSession removes a session; an id it doesn't have is no error
+	DeleteSession(id string) error
+	// Sessions returns every session, sorted by id
+	Sessions() ([]*pb.SessionRecord, error)
+
+	// Close releases what the Store holds, like open files; it isn't used afterwards
+	Close() error
+}
@@ -0,0 +1,289 @@
+// Package storagetest checks a storage.Store behaves the way the server relies on.
+// Every backend should pass it, from a test of its own:
+//
+//	func TestStore(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storage.Store { return storage.NewMemory() }, nil)
+//	}
+//
+// Backends that keep things between runs also pass reopen, which closes a Store and opens it again on the
+// same data, so the suite can check nothing is lost.
+package storagetest
+
+import (
+	pb "ChittyChat/proto"
+	"ChittyChat/storage"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Opener returns a new, empty Store for a test
+type Opener func(t *testing.T) storage.Store
+
+// Reopener closes a Store and opens it again on what it kept
+type Reopener func(t *testing.T, s storage.Store) storage.Store
+
+// Run runs the conformance suite against the Stores open returns; reopen may be nil
+func Run(t *testing.T, open Opener, reopen Reopener) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s storage.Store) storage.Store
+	}{
+		{"Messages", testMessages},
+		{"ReplaceMessage", testReplaceMessage},
+		{"DeleteMessages", testDeleteMessages},
+		{"Compact", testCompact},
+		{"Copies", testCopies},
+		{"Channels", testChannels},
+		{"Users", testUsers},
+		{"Sessions", testSessions},
+		{"ManyChanges", testManyChanges},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := open(t)
+			s = tt.test(t, s)
+			if reopen != nil {
+				// Everything checked before has to be there after opening the Store again
+				t.Run("Reopened", func(t *testing.T) {
+					s = reopen(t, s)
+					tt.test(t, s)
+				})
+			}
+			if err := s.Close(); err != nil {
+				t.Errorf("Close: %v", err)
+			}
+		})
+	}
+}
+
+func message(channel, id, text string) *pb.Message {
+	return &pb.Message{Id: id, Sender: "Anon", Channel: &pb.Channel{Name: channel, SendersName: "Anon"}, Message: text}
+}
+
+// Function to check a Store returns want for channel, in order
+func checkMessages(t *testing.T, s storage.Store, channel string, want ...*pb.Message) {
+	t.Helper()
+	got, err := s.Messages(channel)
+	if err != nil {
+		t.Fatalf("Messages(%q): %v", channel, err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Messages(%q) returned %v messages, want %v", channel, len(got), len(want))
+	}
+	for i := range want {
+		if !proto.Equal(got[i], want[i]) {
+			t.Errorf("Messages(%q)[%v] = %v, want %v", channel, i, got[i], want[i])
+		}
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Tests return the Store they wrote to, to check again once it's been reopened; they must pass on either.
+// So they write only what isn't there yet.
+
+func testMessages(t *testing.T, s storage.Store) storage.Store {
+	a1, a2, b1 := message("a", "1", "one"), message("a", "3", "three"), message("b", "2", "two")
+	if got, _ := s.Messages("a"); len(got) == 0 {
+		must(t, s.SaveMessage(a1))
+		must(t, s.SaveMessage(b1))
+		must(t, s.SaveMessage(a2))
+	}
+	checkMessages(t, s, "a", a1, a2)
+	checkMessages(t, s, "b", b1)
+	checkMessages(t, s, "nothing")
+	return s
+}
+
+func testReplaceMessage(t *testing.T, s storage.Store) storage.Store {
+	first, second := message("a", "1", "first"), message("a", "2", "second")
+	edited := message("a", "1", "edited")
+	edited.Event = pb.Event_EDITED
+	edited.Edits = []*pb.Edit{{Previous: "first", Editor: "Anon", Timestamp: 3}}
+	if got, _ := s.Messages("a"); len(got) == 0 {
+		must(t, s.SaveMessage(first))
+		must(t, s.SaveMessage(second))
+		must(t, s.SaveMessage(edited))
+	}
+	// Replacing a message keeps its place
+	checkMessages(t, s, "a", edited, second)
+	return s
+}
+
+func testDeleteMessages(t *testing.T, s storage.Store) storage.Store {
+	m1, m2, m3 := message("a", "1", "one"), message("a", "2", "two"), message("a", "3", "three")
+	only := message("b", "4", "only")
+	if got, _ := s.Messages("a"); len(got) == 0 {
+		for _, msg := range []*pb.Message{m1, m2, m3, only} {
+			must(t, s.SaveMessage(msg))
+		}
+		must(t, s.DeleteMessages("a", []string{"1", "3", "unknown"}))
+		must(t, s.DeleteMessages("b", []string{"4"}))
+		must(t, s.DeleteMessages("nothing", []string{"1"}))
+	}
+	checkMessages(t, s, "a", m2)
+	checkMessages(t, s, "b")
+	names, err := s.Channels()
+	must(t, err)
+	for _, name := range names {
+		if name == "b" {
+			t.Errorf("Channels() = %v, b has no messages left", names)
+		}
+	}
+	return s
+}
+
+func testCompact(t *testing.T, s storage.Store) storage.Store {
+	gone := message("a", "1", "")
+	gone.Event = pb.Event_DELETED
+	kept := message("a", "2", "kept")
+	if got, _ := s.Messages("a"); len(got) == 0 {
+		must(t, s.SaveMessage(message("a", "1", "secret")))
+		must(t, s.SaveMessage(kept))
+		must(t, s.SaveMessage(gone))
+		must(t, s.Compact("a"))
+		must(t, s.Compact("nothing"))
+	}
+	checkMessages(t, s, "a", gone, kept)
+	return s
+}
+
+func testCopies(t *testing.T, s storage.Store) storage.Store {
+	saved := message("a", "1", "original")
+	if got, _ := s.Messages("a"); len(got) == 0 {
+		msg := proto.Clone(saved).(*pb.Message)
+		must(t, s.SaveMessage(msg))
+		// Changing what was saved, or what was handed out, mustn't change what's kept
+		msg.Message = "changed after saving"
+		got, err := s.Messages("a")
+		must(t, err)
+		got[0].Message = "changed after reading"
+
+		ch := &pb.ChannelRecord{Name: "a", Audit: []*pb.AuditEntry{{Channel: "a", Action: "kick"}}}
+		must(t, s.SaveChannel(ch))
+		ch.Audit[0].Action = "changed"
+		read, err := s.Channel("a")
+		must(t, err)
+		read.Audit = nil
+	}
+	checkMessages(t, s, "a", saved)
+	ch, err := s.Channel("a")
+	must(t, err)
+	if len(ch.GetAudit()) != 1 || ch.GetAudit()[0].GetAction() != "kick" {
+		t.Errorf("Channel(a) = %v, want the audit entry as saved", ch)
+	}
+	return s
+}
+
+func testChannels(t *testing.T, s storage.Store) storage.Store {
+	eepy := &pb.ChannelRecord{
+		Name:    "Eepy",
+		Members: []*pb.ArchiveMember{{Name: "Anon", Role: "owner"}, {Name: "Troll", Banned: true, BannedUntil: 1700000000}},
+		Audit:   []*pb.AuditEntry{{Channel: "Eepy", Moderator: "Anon", Action: "ban", Target: "Troll", Timestamp: 7}},
+	}
+	empty := &pb.ChannelRecord{Name: "Empty"}
+	if _, err := s.Channel("Eepy"); errors.Is(err, storage.ErrNotFound) {
+		must(t, s.SaveChannel(&pb.ChannelRecord{Name: "Eepy"}))
+		must(t, s.SaveChannel(eepy))
+		must(t, s.SaveChannel(empty))
+		must(t, s.SaveMessage(message("Chatty", "1", "hi")))
+	}
+
+	got, err := s.Channel("Eepy")
+	must(t, err)
+	if !proto.Equal(got, eepy) {
+		t.Errorf("Channel(Eepy) = %v, want %v", got, eepy)
+	}
+	if got, err := s.Channel("Empty"); err != nil || !proto.Equal(got, empty) {
+		t.Errorf("Channel(Empty) = %v, %v, want %v", got, err, empty)
+	}
+	if _, err := s.Channel("Unknown"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Channel(Unknown) returned %v, want ErrNotFound", err)
+	}
+
+	// Channels with messages count too, without being saved
+	names, err := s.Channels()
+	must(t, err)
+	if fmt.Sprint(names) != "[Chatty Eepy Empty]" {
+		t.Errorf("Channels() = %v, want [Chatty Eepy Empty]", names)
+	}
+	return s
+}
+
+func testUsers(t *testing.T, s storage.Store) storage.Store {
+	anon := &pb.UserRecord{Name: "Anon", FirstSeen: 100, LastSeen: 200}
+	bob := &pb.UserRecord{Name: "Bob"}
+	if _, err := s.User("Anon"); errors.Is(err, storage.ErrNotFound) {
+		must(t, s.SaveUser(&pb.UserRecord{Name: "Anon", FirstSeen: 100, LastSeen: 100}))
+		must(t, s.SaveUser(bob))
+		must(t, s.SaveUser(anon))
+	}
+	if got, err := s.User("Anon"); err != nil || !proto.Equal(got, anon) {
+		t.Errorf("User(Anon) = %v, %v, want %v", got, err, anon)
+	}
+	if _, err := s.User("Unknown"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("User(Unknown) returned %v, want ErrNotFound", err)
+	}
+	users, err := s.Users()
+	must(t, err)
+	if len(users) != 2 || !proto.Equal(users[0], anon) || !proto.Equal(users[1], bob) {
+		t.Errorf("Users() = %v, want [%v %v]", users, anon, bob)
+	}
+	return s
+}
+
+func testSessions(t *testing.T, s storage.Store) storage.Store {
+	kept := &pb.SessionRecord{Id: "2", User: "Bob", Channel: "Eepy", StartedAt: 200}
+	if sessions, _ := s.Sessions(); len(sessions) == 0 {
+		must(t, s.SaveSession(&pb.SessionRecord{Id: "1", User: "Anon", Channel: "Eepy", StartedAt: 100}))
+		must(t, s.SaveSession(kept))
+		must(t, s.SaveSession(&pb.SessionRecord{Id: "3", User: "Anon", Channel: "Dev", StartedAt: 300}))
+		must(t, s.DeleteSession("1"))
+		must(t, s.DeleteSession("3"))
+		must(t, s.DeleteSession("unknown"))
+	}
+	sessions, err := s.Sessions()
+	must(t, err)
+	if len(sessions) != 1 || !proto.Equal(sessions[0], kept) {
+		t.Errorf("Sessions() = %v, want [%v]", sessions, kept)
+	}
+	return s
+}
+
+// Lots of changes to a few things, as a long running server makes, which backends may compact as they go
+func testManyChanges(t *testing.T, s storage.Store) storage.Store {
+	const n = 500
+	if got, _ := s.Messages("busy"); len(got) == 0 {
+		for i := 0; i < n; i++ {
+			msg := message("busy", strconv.Itoa(i%10), fmt.Sprintf("version %v", i))
+			msg.Revision = int64(i)
+			must(t, s.SaveMessage(msg))
+			must(t, s.SaveUser(&pb.UserRecord{Name: "Anon", LastSeen: int64(i)}))
+			must(t, s.SaveSession(&pb.SessionRecord{Id: strconv.Itoa(i), User: "Anon", Channel: "busy"}))
+			must(t, s.DeleteSession(strconv.Itoa(i)))
+		}
+	}
+	var want []*pb.Message
+	for i := n - 10; i < n; i++ {
+		msg := message("busy", strconv.Itoa(i%10), fmt.Sprintf("version %v", i))
+		msg.Revision = int64(i)
+		want = append(want, msg)
+	}
+	checkMessages(t, s, "busy", want...)
+	if user, err := s.User("Anon"); err != nil || user.GetLastSeen() != n-1 {
+		t.Errorf("User(Anon) = %v, %v, want last seen %v", user, err, n-1)
+	}
+	if sessions, err := s.Sessions(); err != nil || len(sessions) != 0 {
+		t.Errorf("Sessions() = %v, %v, want none", sessions, err)
+	}
+	return s
+}